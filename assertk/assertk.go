@@ -0,0 +1,436 @@
+package assertk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const (
+	StateActive   = "active"
+	StateInactive = "inactive"
+
+	flowExpiredID = "self_service_flow_expired"
+
+	pollInterval = 100 * time.Millisecond
+)
+
+type tHelper interface {
+	Helper()
+}
+
+// VerifiedAddress asserts identity has verified address value.
+func VerifiedAddress(t assert.TestingT, identity *client.Identity, value string, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if identity == nil {
+		return assert.Fail(t, "identity is nil", msgAndArgs...)
+	}
+
+	if verified(identity, value) {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("identity %s has no verified address %q\nverifiable addresses: %s",
+		identity.Id, value, pretty(identity.VerifiableAddresses)), msgAndArgs...)
+}
+
+func verified(identity *client.Identity, value string) bool {
+	return slices.ContainsFunc(identity.VerifiableAddresses, func(addr client.VerifiableIdentityAddress) bool {
+		return addr.Value == value && addr.Verified
+	})
+}
+
+// EventuallyVerified asserts the identity with id, read through the admin
+// client, gets verified address value within waitFor.
+func EventuallyVerified(
+	t assert.TestingT,
+	admin *client.APIClient,
+	id, value string,
+	waitFor time.Duration,
+	msgAndArgs ...any,
+) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitFor)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var last *client.Identity
+
+	for {
+		identity, resp, err := admin.IdentityAPI.GetIdentity(ctx, id).Execute()
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		if err == nil {
+			if verified(identity, value) {
+				return true
+			}
+
+			last = identity
+		}
+
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				return assert.Fail(t, fmt.Sprintf("identity %s cant be read: %v", id, err), msgAndArgs...)
+			}
+
+			return VerifiedAddress(t, last, value, msgAndArgs...)
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecoveryAddress asserts identity has recovery address value.
+func RecoveryAddress(t assert.TestingT, identity *client.Identity, value string, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if identity == nil {
+		return assert.Fail(t, "identity is nil", msgAndArgs...)
+	}
+
+	for _, addr := range identity.RecoveryAddresses {
+		if addr.Value == value {
+			return true
+		}
+	}
+
+	return assert.Fail(t, fmt.Sprintf("identity %s has no recovery address %q\nrecovery addresses: %s",
+		identity.Id, value, pretty(identity.RecoveryAddresses)), msgAndArgs...)
+}
+
+// CredentialType asserts identity has credentials of kind, e.g. "password" or "oidc".
+func CredentialType(t assert.TestingT, identity *client.Identity, kind string, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if identity == nil {
+		return assert.Fail(t, "identity is nil", msgAndArgs...)
+	}
+
+	kinds := make([]string, 0)
+
+	if identity.Credentials != nil {
+		for known := range *identity.Credentials {
+			kinds = append(kinds, known)
+		}
+	}
+
+	slices.Sort(kinds)
+
+	if slices.Contains(kinds, kind) {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("identity %s has no %q credentials\ncredential types: %v",
+		identity.Id, kind, kinds), msgAndArgs...)
+}
+
+func IdentityState(t assert.TestingT, identity *client.Identity, state string, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if identity == nil {
+		return assert.Fail(t, "identity is nil", msgAndArgs...)
+	}
+
+	return assert.Equal(t, state, identity.GetState(), msgAndArgs...)
+}
+
+func Inactive(t assert.TestingT, identity *client.Identity, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return IdentityState(t, identity, StateInactive, msgAndArgs...)
+}
+
+// SessionActive asserts session is active at assurance level aal.
+func SessionActive(
+	t assert.TestingT,
+	session *client.Session,
+	aal client.AuthenticatorAssuranceLevel,
+	msgAndArgs ...any,
+) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if session == nil {
+		return assert.Fail(t, "session is nil", msgAndArgs...)
+	}
+
+	if !session.GetActive() {
+		return assert.Fail(t, fmt.Sprintf("session %s is not active", session.Id), msgAndArgs...)
+	}
+
+	return assert.Equal(t, aal, session.GetAuthenticatorAssuranceLevel(), msgAndArgs...)
+}
+
+// AssuranceLevel asserts session is at authenticator assurance level aal.
+func AssuranceLevel(
+	t assert.TestingT,
+	session *client.Session,
+	aal client.AuthenticatorAssuranceLevel,
+	msgAndArgs ...any,
+) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if session == nil {
+		return assert.Fail(t, "session is nil", msgAndArgs...)
+	}
+
+	return assert.Equal(t, aal, session.GetAuthenticatorAssuranceLevel(), msgAndArgs...)
+}
+
+// AuthenticatedWith asserts session lists every one of methods, e.g.
+// "password" and "totp", in its authentication_methods.
+func AuthenticatedWith(t assert.TestingT, session *client.Session, methods []string, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if session == nil {
+		return assert.Fail(t, "session is nil", msgAndArgs...)
+	}
+
+	completed := make([]string, 0, len(session.AuthenticationMethods))
+	for _, method := range session.AuthenticationMethods {
+		completed = append(completed, method.GetMethod())
+	}
+
+	for _, method := range methods {
+		if !slices.Contains(completed, method) {
+			return assert.Fail(t, fmt.Sprintf("session %s was not authenticated with %q\nauthentication methods: %s",
+				session.Id, method, pretty(session.AuthenticationMethods)), msgAndArgs...)
+		}
+	}
+
+	return true
+}
+
+// Extended asserts after, e.g. returned by ExtendSession, expires later than
+// before.
+func Extended(t assert.TestingT, before, after *client.Session, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if before == nil || after == nil {
+		return assert.Fail(t, "session is nil", msgAndArgs...)
+	}
+
+	if after.GetExpiresAt().After(before.GetExpiresAt()) {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("session %s was not extended: expires at %s, was %s",
+		after.Id, after.GetExpiresAt(), before.GetExpiresAt()), msgAndArgs...)
+}
+
+// UIMessage asserts ui carries a message with id on the container or any node.
+func UIMessage(t assert.TestingT, ui client.UiContainer, id int64, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	messages := append([]client.UiText(nil), ui.Messages...)
+
+	for _, node := range ui.Nodes {
+		messages = append(messages, node.Messages...)
+	}
+
+	return hasMessage(t, messages, id, msgAndArgs...)
+}
+
+func hasMessage(t assert.TestingT, messages []client.UiText, id int64, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	if slices.ContainsFunc(messages, func(msg client.UiText) bool { return msg.Id == id }) {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("ui has no message %d\nmessages: %s", id, pretty(messages)), msgAndArgs...)
+}
+
+// FlowFailed asserts err is a flow returned by Kratos with a ui message id,
+// e.g. 4000006 for invalid credentials.
+func FlowFailed(t assert.TestingT, err error, id int64, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	res, ok := kratoserr.Parse(err)
+	if !ok {
+		return assert.Fail(t, fmt.Sprintf("expected kratos api error, got: %v", err), msgAndArgs...)
+	}
+
+	if res.Flow == nil {
+		return assert.Fail(t, fmt.Sprintf("error is not a flow: %v", res), msgAndArgs...)
+	}
+
+	if res.HasMessage(id) {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("ui has no message %d\nmessages: %s", id, pretty(res.Messages())), msgAndArgs...)
+}
+
+// FlowExpired asserts err is Kratos refusing a flow past its lifespan.
+func FlowExpired(t assert.TestingT, err error, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	res, ok := kratoserr.Parse(err)
+	if !ok {
+		return assert.Fail(t, fmt.Sprintf("expected kratos api error, got: %v", err), msgAndArgs...)
+	}
+
+	if res.ID == flowExpiredID || res.Status == http.StatusGone {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("expected expired flow, got: %v", res), msgAndArgs...)
+}
+
+// SessionRejected asserts err is Kratos refusing a session, e.g. an expired
+// or revoked one passed to ToSession.
+func SessionRejected(t assert.TestingT, err error, msgAndArgs ...any) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	res, ok := kratoserr.Parse(err)
+	if !ok {
+		return assert.Fail(t, fmt.Sprintf("expected kratos api error, got: %v", err), msgAndArgs...)
+	}
+
+	if res.Status == http.StatusUnauthorized {
+		return true
+	}
+
+	return assert.Fail(t, fmt.Sprintf("expected rejected session, got: %v", res), msgAndArgs...)
+}
+
+// EventuallyTokenRejected asserts ToSession refuses session token within
+// waitFor, e.g. after logout or revocation.
+func EventuallyTokenRejected(
+	t assert.TestingT,
+	front *client.APIClient,
+	token string,
+	waitFor time.Duration,
+	msgAndArgs ...any,
+) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	return eventuallyRejected(t, waitFor, func(ctx context.Context) (*client.Session, *http.Response, error) {
+		return front.FrontendAPI.ToSession(ctx).XSessionToken(token).Execute()
+	}, msgAndArgs...)
+}
+
+// EventuallyCookieRejected asserts ToSession refuses session cookies within
+// waitFor, e.g. ones kept from a browser before it logged out.
+func EventuallyCookieRejected(
+	t assert.TestingT,
+	front *client.APIClient,
+	cookies []*http.Cookie,
+	waitFor time.Duration,
+	msgAndArgs ...any,
+) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	pairs := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		pairs = append(pairs, (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String())
+	}
+
+	header := strings.Join(pairs, "; ")
+
+	return eventuallyRejected(t, waitFor, func(ctx context.Context) (*client.Session, *http.Response, error) {
+		return front.FrontendAPI.ToSession(ctx).Cookie(header).Execute()
+	}, msgAndArgs...)
+}
+
+func eventuallyRejected(
+	t assert.TestingT,
+	waitFor time.Duration,
+	whoami func(ctx context.Context) (*client.Session, *http.Response, error),
+	msgAndArgs ...any,
+) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitFor)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var last error
+
+	for {
+		session, resp, err := whoami(ctx)
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		switch {
+		case resp != nil && resp.StatusCode == http.StatusUnauthorized:
+			return true
+		case err != nil:
+			// the deadline cancels the last request, keep what came before
+			if last == nil || ctx.Err() == nil {
+				last = err
+			}
+		default:
+			last = fmt.Errorf("session %s is still accepted", session.Id)
+		}
+
+		select {
+		case <-ctx.Done():
+			return assert.Fail(t, fmt.Sprintf("expected rejected session within %s, got: %v", waitFor, last), msgAndArgs...)
+		case <-ticker.C:
+		}
+	}
+}
+
+func pretty(val any) string {
+	raw, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", val)
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,428 @@
+package assertk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	messages []string
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+}
+
+func identity() *client.Identity {
+	return &client.Identity{
+		Id:    "id",
+		State: client.PtrString(StateInactive),
+		Credentials: &map[string]client.IdentityCredentials{
+			"password": {},
+		},
+		VerifiableAddresses: []client.VerifiableIdentityAddress{
+			*client.NewVerifiableIdentityAddress("completed", "verified@example.com", true, "email"),
+			*client.NewVerifiableIdentityAddress("pending", "pending@example.com", false, "email"),
+		},
+		RecoveryAddresses: []client.RecoveryIdentityAddress{
+			*client.NewRecoveryIdentityAddress("rid", "verified@example.com", "email"),
+		},
+	}
+}
+
+func flowError(t *testing.T, body string) error {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	addr, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	cfg := client.NewConfiguration()
+	cfg.Host = addr.Host
+	cfg.Scheme = addr.Scheme
+
+	_, _, err = client.NewAPIClient(cfg).FrontendAPI.UpdateLoginFlow(t.Context()).Flow("flow").
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+			UpdateLoginFlowWithPasswordMethod: client.NewUpdateLoginFlowWithPasswordMethod("id", "password", "pass"),
+		}).
+		Execute()
+	require.Error(t, err)
+
+	return err
+}
+
+func TestIdentityAssertions(t *testing.T) {
+	t.Run("should be able to pass", func(t *testing.T) {
+		rec := &recorder{}
+
+		assert.True(t, VerifiedAddress(rec, identity(), "verified@example.com"))
+		assert.True(t, RecoveryAddress(rec, identity(), "verified@example.com"))
+		assert.True(t, CredentialType(rec, identity(), "password"))
+		assert.True(t, Inactive(rec, identity()))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to fail", func(t *testing.T) {
+		t.Run("when address is not verified", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, VerifiedAddress(rec, identity(), "pending@example.com"))
+			require.Len(t, rec.messages, 1)
+			assert.Contains(t, rec.messages[0], `no verified address "pending@example.com"`)
+			assert.Contains(t, rec.messages[0], `"value": "pending@example.com"`)
+		})
+
+		t.Run("when recovery address is absent", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, RecoveryAddress(rec, identity(), "absent@example.com"))
+			assert.Contains(t, rec.messages[0], "no recovery address")
+		})
+
+		t.Run("when credential type is absent", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, CredentialType(rec, identity(), "oidc"))
+			assert.Contains(t, rec.messages[0], "credential types: [password]")
+		})
+
+		t.Run("when state differs", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, IdentityState(rec, identity(), StateActive))
+			assert.Contains(t, rec.messages[0], "Diff")
+		})
+
+		t.Run("when identity is nil", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, VerifiedAddress(rec, nil, "any"))
+			assert.False(t, RecoveryAddress(rec, nil, "any"))
+			assert.False(t, CredentialType(rec, nil, "any"))
+			assert.False(t, Inactive(rec, nil))
+			assert.Len(t, rec.messages, 4)
+		})
+	})
+}
+
+func TestSessionActive(t *testing.T) {
+	session := &client.Session{
+		Id:                          "sid",
+		Active:                      client.PtrBool(true),
+		AuthenticatorAssuranceLevel: client.AUTHENTICATORASSURANCELEVEL_AAL1.Ptr(),
+	}
+
+	t.Run("should be able to pass", func(t *testing.T) {
+		assert.True(t, SessionActive(&recorder{}, session, client.AUTHENTICATORASSURANCELEVEL_AAL1))
+	})
+
+	t.Run("should be able to fail", func(t *testing.T) {
+		t.Run("when level differs", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, SessionActive(rec, session, client.AUTHENTICATORASSURANCELEVEL_AAL2))
+			assert.Contains(t, rec.messages[0], "aal2")
+		})
+
+		t.Run("when session is inactive", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, SessionActive(rec, &client.Session{Id: "sid"}, client.AUTHENTICATORASSURANCELEVEL_AAL1))
+			assert.Contains(t, rec.messages[0], "session sid is not active")
+		})
+
+		t.Run("when session is nil", func(t *testing.T) {
+			assert.False(t, SessionActive(&recorder{}, nil, client.AUTHENTICATORASSURANCELEVEL_AAL1))
+		})
+	})
+}
+
+func TestAssuranceAssertions(t *testing.T) {
+	now := time.Now()
+	session := &client.Session{
+		Id:                          "sid",
+		AuthenticatorAssuranceLevel: client.AUTHENTICATORASSURANCELEVEL_AAL2.Ptr(),
+		AuthenticationMethods: []client.SessionAuthenticationMethod{
+			{Method: client.PtrString("password"), Aal: client.AUTHENTICATORASSURANCELEVEL_AAL1.Ptr()},
+			{Method: client.PtrString("totp"), Aal: client.AUTHENTICATORASSURANCELEVEL_AAL2.Ptr()},
+		},
+		ExpiresAt: &now,
+	}
+	later := now.Add(time.Hour)
+	extended := &client.Session{Id: "sid", ExpiresAt: &later}
+
+	t.Run("should be able to pass", func(t *testing.T) {
+		rec := &recorder{}
+
+		assert.True(t, AssuranceLevel(rec, session, client.AUTHENTICATORASSURANCELEVEL_AAL2))
+		assert.True(t, AuthenticatedWith(rec, session, []string{"password", "totp"}))
+		assert.True(t, Extended(rec, session, extended))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to fail", func(t *testing.T) {
+		t.Run("when level differs", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, AssuranceLevel(rec, session, client.AUTHENTICATORASSURANCELEVEL_AAL1))
+			assert.Contains(t, rec.messages[0], "aal1")
+		})
+
+		t.Run("when method is missing", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, AuthenticatedWith(rec, session, []string{"password", "webauthn"}))
+			assert.Contains(t, rec.messages[0], `session sid was not authenticated with "webauthn"`)
+		})
+
+		t.Run("when expiry did not move", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, Extended(rec, extended, session))
+			assert.Contains(t, rec.messages[0], "session sid was not extended")
+		})
+
+		t.Run("when session is nil", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, AssuranceLevel(rec, nil, client.AUTHENTICATORASSURANCELEVEL_AAL1))
+			assert.False(t, AuthenticatedWith(rec, nil, []string{"password"}))
+			assert.False(t, Extended(rec, session, nil))
+			assert.Len(t, rec.messages, 3)
+		})
+	})
+}
+
+func TestFlowFailed(t *testing.T) {
+	const body = `{"id":"flow","ui":{"action":"","method":"POST",
+		"messages":[{"id":4000006,"text":"invalid","type":"error"}],
+		"nodes":[{"type":"input","group":"password",
+		"attributes":{"node_type":"input","name":"password","type":"password"},
+		"messages":[{"id":4000002,"text":"required","type":"error"}],"meta":{}}]}}`
+
+	t.Run("should be able to find message in ui container", func(t *testing.T) {
+		ui := client.UiContainer{Nodes: []client.UiNode{{
+			Messages: []client.UiText{{Id: 1070001, Text: "info", Type: "info"}},
+		}}}
+
+		assert.True(t, UIMessage(&recorder{}, ui, 1070001))
+		assert.False(t, UIMessage(&recorder{}, ui, 4000006))
+	})
+
+	t.Run("should be able to find flow and node messages", func(t *testing.T) {
+		err := flowError(t, body)
+
+		assert.True(t, FlowFailed(&recorder{}, err, 4000006))
+		assert.True(t, FlowFailed(&recorder{}, fmt.Errorf("wrapped: %w", err), 4000002))
+	})
+
+	t.Run("should be able to fail", func(t *testing.T) {
+		t.Run("when message is absent", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, FlowFailed(rec, flowError(t, body), 4000010))
+			assert.Contains(t, rec.messages[0], "ui has no message 4000010")
+			assert.Contains(t, rec.messages[0], `"id": 4000006`)
+		})
+
+		t.Run("when error is not from kratos", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, FlowFailed(rec, errors.New("boom"), 4000006))
+			assert.Contains(t, rec.messages[0], "expected kratos api error")
+		})
+
+		t.Run("when body is not a flow", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, FlowFailed(rec, flowError(t, `{"error":{"code":400}}`), 4000006))
+			assert.Contains(t, rec.messages[0], "error is not a flow")
+		})
+	})
+}
+
+func TestExpiryAssertions(t *testing.T) {
+	t.Run("should be able to detect expired flow", func(t *testing.T) {
+		rec := &recorder{}
+
+		err := flowError(t, `{"error":{"id":"self_service_flow_expired","code":410,"reason":"expired"}}`)
+		assert.True(t, FlowExpired(rec, err))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to detect rejected session", func(t *testing.T) {
+		rec := &recorder{}
+
+		err := flowError(t, `{"error":{"id":"session_inactive","code":401,"reason":"no session"}}`)
+		assert.True(t, SessionRejected(rec, err))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to fail", func(t *testing.T) {
+		t.Run("when flow is not expired", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, FlowExpired(rec, flowError(t, `{"error":{"code":400,"reason":"bad"}}`)))
+			assert.Contains(t, rec.messages[0], "expected expired flow")
+		})
+
+		t.Run("when session is accepted", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, SessionRejected(rec, flowError(t, `{"error":{"code":403,"reason":"aal"}}`)))
+			assert.Contains(t, rec.messages[0], "expected rejected session")
+		})
+
+		t.Run("when error is not from kratos", func(t *testing.T) {
+			rec := &recorder{}
+			assert.False(t, FlowExpired(rec, errors.New("boom")))
+			assert.False(t, SessionRejected(rec, errors.New("boom")))
+			assert.Len(t, rec.messages, 2)
+		})
+	})
+}
+
+func TestEventuallyVerified(t *testing.T) {
+	admin := func(t *testing.T, verifyAfter int) *client.APIClient {
+		t.Helper()
+
+		var calls atomic.Int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/admin/identities/id" {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			verified := verifyAfter >= 0 && int(calls.Add(1)) > verifyAfter
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id":         "id",
+				"schema_id":  "user",
+				"schema_url": "http://localhost/schemas/user",
+				"traits":     map[string]any{},
+				"verifiable_addresses": []any{map[string]any{
+					"value": "pending@example.com", "verified": verified, "via": "email", "status": "pending",
+				}},
+			})
+		}))
+		t.Cleanup(srv.Close)
+
+		addr, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		cfg := client.NewConfiguration()
+		cfg.Host = addr.Host
+		cfg.Scheme = addr.Scheme
+
+		return client.NewAPIClient(cfg)
+	}
+
+	t.Run("should be able to wait for verification", func(t *testing.T) {
+		rec := &recorder{}
+
+		assert.True(t, EventuallyVerified(rec, admin(t, 2), "id", "pending@example.com", time.Second))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when address stays pending", func(t *testing.T) {
+			rec := &recorder{}
+
+			assert.False(t, EventuallyVerified(rec, admin(t, -1), "id", "pending@example.com", 3*pollInterval))
+			require.Len(t, rec.messages, 1)
+			assert.Contains(t, rec.messages[0], "pending@example.com")
+		})
+
+		t.Run("when identity is absent", func(t *testing.T) {
+			rec := &recorder{}
+
+			assert.False(t, EventuallyVerified(rec, admin(t, 0), "absent", "pending@example.com", pollInterval))
+			require.Len(t, rec.messages, 1)
+			assert.Contains(t, rec.messages[0], "cant be read")
+		})
+	})
+}
+
+func TestEventuallyRejected(t *testing.T) {
+	front := func(t *testing.T, rejectAfter int) *client.APIClient {
+		t.Helper()
+
+		var calls atomic.Int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorized := r.Header.Get("X-Session-Token") == "token"
+			if cookie, err := r.Cookie("ory_kratos_session"); err == nil {
+				authorized = cookie.Value == "token"
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+
+			if !authorized || (rejectAfter >= 0 && int(calls.Add(1)) > rejectAfter) {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":{"code":401,"status":"Unauthorized"}}`))
+
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]any{"id": "sid", "active": true})
+		}))
+		t.Cleanup(srv.Close)
+
+		addr, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+
+		cfg := client.NewConfiguration()
+		cfg.Host = addr.Host
+		cfg.Scheme = addr.Scheme
+
+		return client.NewAPIClient(cfg)
+	}
+
+	cookies := []*http.Cookie{{Name: "ory_kratos_session", Value: "token"}, {Name: "csrf_token", Value: "csrf"}}
+
+	t.Run("should be able to wait for rejected token", func(t *testing.T) {
+		rec := &recorder{}
+
+		assert.True(t, EventuallyTokenRejected(rec, front(t, 2), "token", time.Second))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to wait for rejected cookie", func(t *testing.T) {
+		rec := &recorder{}
+
+		assert.True(t, EventuallyCookieRejected(rec, front(t, 2), cookies, time.Second))
+		assert.Empty(t, rec.messages)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when token stays accepted", func(t *testing.T) {
+			rec := &recorder{}
+
+			assert.False(t, EventuallyTokenRejected(rec, front(t, -1), "token", 3*pollInterval))
+			require.Len(t, rec.messages, 1)
+			assert.Contains(t, rec.messages[0], "session sid is still accepted")
+		})
+
+		t.Run("when cookie stays accepted", func(t *testing.T) {
+			rec := &recorder{}
+
+			assert.False(t, EventuallyCookieRejected(rec, front(t, -1), cookies, 3*pollInterval))
+			require.Len(t, rec.messages, 1)
+		})
+
+		t.Run("when kratos is unreachable", func(t *testing.T) {
+			rec := &recorder{}
+			cfg := client.NewConfiguration()
+			cfg.Host = "127.0.0.1:1"
+			cfg.Scheme = "http"
+
+			assert.False(t, EventuallyTokenRejected(rec, client.NewAPIClient(cfg), "token", pollInterval))
+			require.Len(t, rec.messages, 1)
+			assert.Contains(t, rec.messages[0], "connection refused")
+		})
+	})
+}
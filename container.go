@@ -20,6 +20,7 @@ func newContainer[T any](
 		ctx:              ctx,
 		injectLabel:      cfg.injectLabel,
 		frontInjectLabel: cfg.frontInjectLabel,
+		image:            cfg.containerImage,
 	}
 
 	return container
@@ -28,21 +29,73 @@ func newContainer[T any](
 func (c *Container[T]) Injector(t *testing.T, to T) T {
 	t.Helper()
 
-	cfg := client.NewConfiguration()
-	cfg.Host = c.kratosContainer.AdminConnectionString(c.ctx)
-	cfg.Scheme = "http"
+	if c.restoreEachTest {
+		if err := c.snapshot.Restore(t.Context()); err != nil {
+			t.Fatalf("failed to restore kratos snapshot: %v", err)
+		}
+	}
 
-	adminClient := client.NewAPIClient(cfg)
+	handle := c.kratos(c.ctx)
 
-	res := generics.Injector(t, adminClient, to, c.injectLabel)
+	res := generics.Injector(t, handle.Admin, to, c.injectLabel)
+	res = generics.Injector(t, handle.Front, res, c.frontInjectLabel)
+	res = generics.Injector(t, handle, res, c.injectLabel+".kratos")
+	res = generics.Injector(t, handle.PublicURL, res, c.injectLabel+".url.public")
+	res = generics.Injector(t, handle.AdminURL, res, c.injectLabel+".url.admin")
 
-	cfgFront := client.NewConfiguration()
-	cfgFront.Host = c.kratosContainer.PublicConnectionString(c.ctx)
-	cfgFront.Scheme = "http"
+	if handle.InternalPublicURL != "" {
+		res = generics.Injector(t, handle.InternalPublicURL, res, c.injectLabel+".url.internal.public")
+	}
 
-	frontClient := client.NewAPIClient(cfg)
+	if handle.InternalAdminURL != "" {
+		res = generics.Injector(t, handle.InternalAdminURL, res, c.injectLabel+".url.internal.admin")
+	}
 
-	res = generics.Injector(t, frontClient, res, c.frontInjectLabel)
+	if handle.Hydra != nil {
+		res = generics.Injector(t, handle.Hydra, res, c.injectLabel+".hydra")
+	}
+
+	if handle.KetoRead != nil {
+		res = generics.Injector(t, handle.KetoRead, res, c.injectLabel+".keto.read")
+		res = generics.Injector(t, handle.KetoWrite, res, c.injectLabel+".keto.write")
+	}
+
+	if handle.OathkeeperURL != "" {
+		res = generics.Injector(t, handle.OathkeeperURL, res, c.injectLabel+".url.oathkeeper")
+	}
+
+	for id, prov := range handle.OIDC {
+		res = generics.Injector(t, prov, res, c.injectLabel+".oidc."+id)
+	}
+
+	if handle.Courier != nil {
+		res = generics.Injector(t, handle.Courier, res, c.injectLabel+".courier")
+	}
+
+	if handle.Webhooks != nil {
+		res = generics.Injector(t, handle.Webhooks, res, c.injectLabel+".webhooks")
+	}
+
+	if handle.Fixtures != nil {
+		res = generics.Injector(t, handle.Fixtures, res, c.injectLabel+".fixtures")
+	}
+
+	if handle.Snapshot != nil {
+		res = generics.Injector(t, handle.Snapshot, res, c.injectLabel+".snapshot")
+	}
+
+	res = generics.Injector(t, handle.Sessions, res, c.injectLabel+".sessions")
+	res = generics.Injector(t, handle.Jsonnet, res, c.injectLabel+".jsonnet")
 
 	return res
 }
+
+const apiScheme = "http"
+
+func newAPIClient(host string) *client.APIClient {
+	cfg := client.NewConfiguration()
+	cfg.Host = host
+	cfg.Scheme = apiScheme
+
+	return client.NewAPIClient(cfg)
+}
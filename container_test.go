@@ -0,0 +1,102 @@
+package grokratos
+
+import (
+	"context"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosversion"
+	"github.com/godepo/grokratos/pkg/sessionhttp"
+	"github.com/godepo/grokratos/pkg/webhook"
+)
+
+type injectDeps struct {
+	Admin      *client.APIClient    `groat:"kr"`
+	Front      *client.APIClient    `groat:"kr.front"`
+	Kratos     *Kratos              `groat:"kr.kratos"`
+	PublicURL  PublicURL            `groat:"kr.url.public"`
+	AdminURL   AdminURL             `groat:"kr.url.admin"`
+	Sessions   *sessionhttp.Factory `groat:"kr.sessions"`
+	Hooks      *webhook.Receiver    `groat:"kr.webhooks"`
+	Internal   PublicURL            `groat:"kr.url.internal.public"`
+	Oathkeeper OathkeeperURL        `groat:"kr.url.oathkeeper"`
+}
+
+type networkedStub struct {
+	stubContainer
+}
+
+func (networkedStub) InternalPublicConnectionString(context.Context) string {
+	return "kratos:4433"
+}
+
+func (networkedStub) InternalAdminConnectionString(context.Context) string {
+	return "kratos:4434"
+}
+
+type versionedStub struct {
+	stubContainer
+}
+
+func (versionedStub) KratosVersion(context.Context) kratosversion.Version {
+	return kratosversion.MustParse("v1.2.0")
+}
+
+func TestContainer_Injector(t *testing.T) {
+	t.Run("should be able to inject urls and kratos handle", func(t *testing.T) {
+		container := newContainer[injectDeps](t.Context(), stubContainer{admin: "127.0.0.1:4434"}, config{
+			containerImage:   "oryd/kratos:v1.3.1",
+			injectLabel:      "kr",
+			frontInjectLabel: "kr.front",
+		})
+
+		deps := container.Injector(t, injectDeps{})
+
+		assert.Equal(t, "oryd/kratos:v1.3.1", deps.Kratos.Image)
+		assert.Equal(t, "v1.3.1", deps.Kratos.Version.String())
+		assert.Equal(t, PublicURL("http://127.0.0.1:4434"), deps.PublicURL)
+		assert.Equal(t, "http://127.0.0.1:4434", deps.AdminURL.String())
+		require.NotNil(t, deps.Kratos)
+		assert.Same(t, deps.Admin, deps.Kratos.Admin)
+		assert.Same(t, deps.Front, deps.Kratos.Front)
+		assert.Same(t, deps.Sessions, deps.Kratos.Sessions)
+		assert.Equal(t, deps.PublicURL, deps.Kratos.PublicURL)
+		assert.Equal(t, stubContainer{admin: "127.0.0.1:4434"}, deps.Kratos.Container)
+		assert.Nil(t, deps.Hooks)
+		assert.Nil(t, deps.Kratos.Snapshot)
+		assert.Empty(t, deps.Internal)
+
+		browser, err := deps.Kratos.Browser()
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:4434", browser.Public.GetConfig().Host)
+	})
+
+	t.Run("should be able to prefer reported version over image tag", func(t *testing.T) {
+		container := newContainer[injectDeps](t.Context(), versionedStub{}, config{
+			containerImage:   "oryd/kratos:latest",
+			injectLabel:      "kr",
+			frontInjectLabel: "kr.front",
+		})
+
+		deps := container.Injector(t, injectDeps{})
+
+		assert.Equal(t, "v1.2.0", deps.Kratos.Version.String())
+	})
+
+	t.Run("should be able to inject in-network urls", func(t *testing.T) {
+		container := newContainer[injectDeps](t.Context(), networkedStub{stubContainer{admin: "127.0.0.1:4434"}}, config{
+			injectLabel:      "kr",
+			frontInjectLabel: "kr.front",
+		})
+
+		deps := container.Injector(t, injectDeps{})
+
+		assert.Equal(t, PublicURL("http://kratos:4433"), deps.Internal)
+		assert.Equal(t, deps.Internal, deps.Kratos.InternalPublicURL)
+		assert.Equal(t, AdminURL("http://kratos:4434"), deps.Kratos.InternalAdminURL)
+		assert.Equal(t, PublicURL("http://127.0.0.1:4434"), deps.PublicURL)
+	})
+}
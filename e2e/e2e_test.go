@@ -1,8 +1,18 @@
 package e2e
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/godepo/groat"
 	"github.com/godepo/groat/integration"
@@ -10,15 +20,43 @@ import (
 	client "github.com/ory/kratos-client-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/network"
+	"github.com/testcontainers/testcontainers-go/wait"
 
 	"github.com/godepo/grokratos"
+	"github.com/godepo/grokratos/assertk"
+	"github.com/godepo/grokratos/pkg/expiry"
+	"github.com/godepo/grokratos/pkg/fixtures"
+	"github.com/godepo/grokratos/pkg/jsonnettest"
+	"github.com/godepo/grokratos/pkg/keto"
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	"github.com/godepo/grokratos/pkg/kratoserr"
+	"github.com/godepo/grokratos/pkg/mockoidc"
+	"github.com/godepo/grokratos/pkg/selfservice"
+	"github.com/godepo/grokratos/pkg/sessionhttp"
+	"github.com/godepo/grokratos/pkg/snapshot"
+	tcketo "github.com/godepo/grokratos/pkg/tc-keto"
+	tcoathkeeper "github.com/godepo/grokratos/pkg/tc-oathkeeper"
+	"github.com/godepo/grokratos/pkg/webhook"
 )
 
 type (
 	Deps struct {
-		Client *client.APIClient `groat:"grokratos"`
-		Front  *client.APIClient `groat:"grokratos.front"`
-		Faker  faker.Faker
+		Client    *client.APIClient       `groat:"grokratos"`
+		Front     *client.APIClient       `groat:"grokratos.front"`
+		Hooks     *webhook.Receiver       `groat:"grokratos.webhooks"`
+		Jsonnet   *jsonnettest.Harness    `groat:"grokratos.jsonnet"`
+		Social    *mockoidc.Provider      `groat:"grokratos.oidc.social"`
+		Fixtures  *fixtures.Set           `groat:"grokratos.fixtures"`
+		Snapshot  *snapshot.Snapshot      `groat:"grokratos.snapshot"`
+		Sessions  *sessionhttp.Factory    `groat:"grokratos.sessions"`
+		Kratos    *grokratos.Kratos       `groat:"grokratos.kratos"`
+		Internal  grokratos.PublicURL     `groat:"grokratos.url.internal.public"`
+		Edge      grokratos.OathkeeperURL `groat:"grokratos.url.oathkeeper"`
+		KetoRead  *keto.ReadClient        `groat:"grokratos.keto.read"`
+		KetoWrite *keto.WriteClient       `groat:"grokratos.keto.write"`
+		Faker     faker.Faker
 	}
 	State struct {
 	}
@@ -27,9 +65,25 @@ type (
 	}
 )
 
-var suite *integration.Container[Deps, State, *Service]
+var (
+	suite      *integration.Container[Deps, State, *Service]
+	sutNetwork *testcontainers.DockerNetwork
+)
 
 func TestMain(m *testing.M) {
+	nw, err := network.New(context.Background())
+	if err != nil {
+		log.Fatalf("failed to create network: %v", err)
+	}
+
+	sutNetwork = nw
+
+	// upstream behind oathkeeper echoes the subject the header mutator passes on
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("X-User")))
+	}))
+	upstreamPort := upstream.Listener.Addr().(*net.TCPAddr).Port
+
 	suite = integration.New[Deps, State, *Service](
 		m,
 		func(t *testing.T) *groat.Case[Deps, State, *Service] {
@@ -45,9 +99,43 @@ func TestMain(m *testing.M) {
 			grokratos.WithFrontInjectLabel("grokratos.front"),
 			grokratos.WithUserSchemaPath("../pkg/tc-kratos/etc/user.schema.json"),
 			grokratos.WithConfig("../pkg/tc-kratos/etc/kratos.yaml"),
+			grokratos.WithWebhooks(webhook.Hook{
+				Name:         "registration",
+				Flow:         "registration",
+				Method:       "password",
+				CanInterrupt: true,
+			}, webhook.Hook{
+				Name:    "mapper",
+				Flow:    "registration",
+				Method:  "password",
+				BodyURL: "file:///etc/config/kratos/registration.jsonnet",
+			}),
+			grokratos.WithJsonnet("testdata/registration.jsonnet"),
+			grokratos.WithOIDCProvider("social", "testdata/social.jsonnet"),
+			grokratos.WithFixtures("testdata/fixtures.yaml"),
+			grokratos.WithSnapshot(),
+			grokratos.WithNetwork(nw.Name),
+			grokratos.WithOathkeeper(
+				tcoathkeeper.WithHostAccessPorts(upstreamPort),
+				tcoathkeeper.WithRules(tcoathkeeper.Protect(
+					"upstream",
+					"http://<**>/api/<**>",
+					"http://host.testcontainers.internal:"+strconv.Itoa(upstreamPort),
+					http.MethodGet,
+				)),
+			),
+			grokratos.WithKeto(tcketo.WithNamespaces("documents")),
+			grokratos.WithHydra(),
 		),
 	)
-	os.Exit(suite.Go())
+
+	code := suite.Go()
+
+	upstream.Close()
+
+	_ = nw.Remove(context.Background())
+
+	os.Exit(code)
 }
 
 func TestCreateUser(t *testing.T) {
@@ -115,3 +203,686 @@ func TestCreateUser(t *testing.T) {
 		assert.Equal(t, id.Id, loginResult.GetSession().Identity.Id)
 	})
 }
+
+func register(t *testing.T, front *client.APIClient, email string) (*selfservice.Registered, error) {
+	t.Helper()
+
+	return selfservice.Register(t.Context(), front, selfservice.Registration{
+		Traits:   map[string]any{"email": email},
+		Password: faker.New().Internet().Password() + "Aa1!",
+	})
+}
+
+func TestRegistrationWebhook(t *testing.T) {
+	t.Run("should be able to capture registration payload", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		email := faker.New().Internet().Email()
+
+		_, err := register(t, tc.Deps.Front, email)
+		require.NoError(t, err)
+
+		req, err := tc.Deps.Hooks.WaitFor(t.Context(), "registration")
+		require.NoError(t, err)
+
+		var payload struct {
+			Identity client.Identity `json:"identity"`
+		}
+		require.NoError(t, req.Decode(&payload))
+		assert.Equal(t, email, payload.Identity.Traits.(map[string]interface{})["email"])
+	})
+
+	t.Run("should be able to interrupt registration", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		tc.Deps.Hooks.Respond(t, "registration", webhook.Interrupt(http.StatusBadRequest, "#/traits/email",
+			webhook.Message{ID: 4000042, Text: "email is blocked"}))
+
+		_, err := register(t, tc.Deps.Front, faker.New().Internet().Email())
+		require.Error(t, err)
+
+		var kerr *kratoserr.Error
+		require.ErrorAs(t, kratoserr.From(err), &kerr)
+		assert.True(t, kerr.HasMessage(4000042), kerr.Error())
+		require.NotEmpty(t, kerr.Field("traits.email"))
+		assert.Equal(t, "email is blocked", kerr.Field("traits.email")[0].Text)
+	})
+}
+
+func TestJsonnetMappers(t *testing.T) {
+	t.Run("should be able to render webhook body", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		got, err := tc.Deps.Jsonnet.Webhook(t.Context(), "mapper", func(context.Context) error {
+			_, err := register(t, tc.Deps.Front, "golden@example.com")
+
+			return err
+		})
+		require.NoError(t, err)
+
+		jsonnettest.Golden(t, "testdata/registration.golden.json", got)
+	})
+
+	t.Run("should be able to render oidc claims mapper", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		identity, err := tc.Deps.Jsonnet.OIDC(t.Context(), tc.Deps.Social, mockoidc.User{
+			Subject: "social-user",
+			Claims: map[string]any{
+				"email":  "social@example.com",
+				"groups": []string{"admins", "staff"},
+			},
+		})
+		require.NoError(t, err)
+
+		got, err := json.Marshal(map[string]any{
+			"traits":          identity.Traits,
+			"metadata_public": identity.MetadataPublic,
+		})
+		require.NoError(t, err)
+
+		jsonnettest.Golden(t, "testdata/social.golden.json", got)
+	})
+}
+
+func login(t *testing.T, front *client.APIClient, identifier, password string) (*client.SuccessfulNativeLogin, error) {
+	t.Helper()
+
+	flow, _, err := front.FrontendAPI.CreateNativeLoginFlow(t.Context()).Execute()
+	require.NoError(t, err)
+
+	res, _, err := front.FrontendAPI.UpdateLoginFlow(t.Context()).Flow(flow.Id).
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+			UpdateLoginFlowWithPasswordMethod: &client.UpdateLoginFlowWithPasswordMethod{
+				Method:     "password",
+				Identifier: identifier,
+				Password:   password,
+			},
+		}).
+		Execute()
+
+	return res, err
+}
+
+func TestFixtures(t *testing.T) {
+	t.Run("should be able to login as fixture", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+		require.NotNil(t, admin.Identity)
+		assert.Equal(t, map[string]interface{}{"role": "admin"}, admin.MetadataPublic)
+		assertk.VerifiedAddress(t, admin.Identity, "admin@fixtures.example.com")
+		assertk.RecoveryAddress(t, admin.Identity, "admin@fixtures.example.com")
+
+		res, err := login(t, tc.Deps.Front, "admin@fixtures.example.com", admin.Password)
+		require.NoError(t, err)
+		assert.Equal(t, admin.Id, res.Session.Identity.Id)
+		assertk.SessionActive(t, &res.Session, client.AUTHENTICATORASSURANCELEVEL_AAL1)
+	})
+
+	t.Run("should be able to reject wrong password", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		_, err := login(t, tc.Deps.Front, "admin@fixtures.example.com", "wrong-Passw0rd!")
+		assertk.FlowFailed(t, err, 4000006)
+	})
+
+	t.Run("should be able to login with imported hash", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		res, err := login(t, tc.Deps.Front, "legacy@fixtures.example.com", "legacy-Passw0rd!")
+		require.NoError(t, err)
+		assert.Equal(t, tc.Deps.Fixtures.Get(t, "legacy").Id, res.Session.Identity.Id)
+	})
+
+	t.Run("should be able to keep fixture inactive", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		locked := tc.Deps.Fixtures.Get(t, "locked")
+		assertk.Inactive(t, locked.Identity)
+		assertk.CredentialType(t, locked.Identity, "password")
+
+		_, err := login(t, tc.Deps.Front, "locked@fixtures.example.com", locked.Password)
+		require.Error(t, err)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("should be able to restore fixtures", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+
+		_, _, err := tc.Deps.Client.IdentityAPI.UpdateIdentity(t.Context(), admin.Id).
+			UpdateIdentityBody(client.UpdateIdentityBody{
+				SchemaId: admin.SchemaId,
+				State:    "inactive",
+				Traits:   map[string]interface{}{"email": "renamed@fixtures.example.com"},
+			}).
+			Execute()
+		require.NoError(t, err)
+
+		extra, err := register(t, tc.Deps.Front, faker.New().Internet().Email())
+		require.NoError(t, err)
+
+		require.NoError(t, tc.Deps.Snapshot.Restore(t.Context()))
+
+		res, err := login(t, tc.Deps.Front, "admin@fixtures.example.com", admin.Password)
+		require.NoError(t, err)
+		assert.Equal(t, admin.Id, res.Session.Identity.Id)
+
+		_, _, err = tc.Deps.Client.IdentityAPI.GetIdentity(t.Context(), extra.Identity.Id).Execute()
+		require.Error(t, err)
+	})
+
+	t.Run("should be able to follow recreated fixture", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		legacy := tc.Deps.Fixtures.Get(t, "legacy")
+
+		_, err := tc.Deps.Client.IdentityAPI.DeleteIdentity(t.Context(), legacy.Id).Execute()
+		require.NoError(t, err)
+
+		require.NoError(t, tc.Deps.Snapshot.Restore(t.Context()))
+
+		recreated := tc.Deps.Fixtures.Get(t, "legacy")
+		assert.NotEqual(t, legacy.Id, recreated.Id)
+
+		res, err := login(t, tc.Deps.Front, "legacy@fixtures.example.com", "legacy-Passw0rd!")
+		require.NoError(t, err)
+		assert.Equal(t, recreated.Id, res.Session.Identity.Id)
+	})
+}
+
+// whoami is a handler authenticating callers the way a service behind Kratos does.
+func whoami(front *client.APIClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := front.FrontendAPI.ToSession(r.Context())
+		if token := r.Header.Get(sessionhttp.SessionTokenHeader); token != "" {
+			req = req.XSessionToken(token)
+		}
+
+		if cookies := r.Header.Get("Cookie"); cookies != "" {
+			req = req.Cookie(cookies)
+		}
+
+		session, _, err := req.Execute()
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(session.Identity)
+	})
+}
+
+func TestSessionClients(t *testing.T) {
+	t.Run("should be able to call service as fixture", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		sut := httptest.NewServer(whoami(tc.Deps.Front))
+		defer sut.Close()
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+
+		for _, session := range []*sessionhttp.Session{
+			tc.Deps.Sessions.As(t, "admin@fixtures.example.com", admin.Password),
+			tc.Deps.Sessions.AsBrowser(t, "admin@fixtures.example.com", admin.Password),
+		} {
+			resp, err := session.Client().Get(sut.URL)
+			require.NoError(t, err)
+
+			var identity client.Identity
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&identity))
+			_ = resp.Body.Close()
+
+			assert.Equal(t, admin.Id, identity.Id)
+		}
+	})
+
+	t.Run("should be able to reject anonymous call", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		sut := httptest.NewServer(whoami(tc.Deps.Front))
+		defer sut.Close()
+
+		resp, err := http.Get(sut.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestReconfigure(t *testing.T) {
+	t.Run("should be able to disable registration for one test", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		t.Run("with registration disabled", func(t *testing.T) {
+			err := tc.Deps.Kratos.ReconfigureUntil(t, func(ctx context.Context) error {
+				_, _, err := tc.Deps.Front.FrontendAPI.CreateNativeRegistrationFlow(ctx).Execute()
+				if err == nil {
+					return errors.New("registration is still enabled")
+				}
+
+				return nil
+			}, func(cfg *kratosconf.Config) error {
+				return cfg.Set("selfservice.flows.registration.enabled", false)
+			})
+			require.NoError(t, err)
+		})
+
+		_, err := register(t, tc.Deps.Front, faker.New().Internet().Email())
+		require.NoError(t, err)
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	t.Run("should be able to expire flows and sessions", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		require.NoError(t, tc.Deps.Kratos.Reconfigure(t, expiry.Lifespans(3*time.Second, 2*time.Second)))
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+
+		flow, _, err := tc.Deps.Front.FrontendAPI.CreateNativeLoginFlow(t.Context()).Execute()
+		require.NoError(t, err)
+		require.NoError(t, expiry.WaitFlow(t.Context(), flow))
+
+		_, resp, err := tc.Deps.Front.FrontendAPI.UpdateLoginFlow(t.Context()).Flow(flow.Id).
+			UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+				UpdateLoginFlowWithPasswordMethod: client.NewUpdateLoginFlowWithPasswordMethod(
+					"admin@fixtures.example.com", "password", admin.Password),
+			}).
+			Execute()
+		assertk.FlowExpired(t, kratoserr.FromResponse(resp, err))
+
+		res, err := login(t, tc.Deps.Front, "admin@fixtures.example.com", admin.Password)
+		require.NoError(t, err)
+		require.NoError(t, expiry.WaitSession(t.Context(), &res.Session))
+
+		_, resp, err = tc.Deps.Front.FrontendAPI.ToSession(t.Context()).
+			XSessionToken(res.GetSessionToken()).
+			Execute()
+		assertk.SessionRejected(t, kratoserr.FromResponse(resp, err))
+	})
+}
+
+func TestNetwork(t *testing.T) {
+	t.Run("should be able to reach kratos from another container", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		require.Equal(t, grokratos.PublicURL("http://kratos:4433"), tc.Deps.Internal)
+
+		curl, err := testcontainers.GenericContainer(t.Context(), testcontainers.GenericContainerRequest{
+			ContainerRequest: testcontainers.ContainerRequest{
+				Image:      "curlimages/curl:8.10.1",
+				Cmd:        []string{"-sf", tc.Deps.Internal.String() + "/health/ready"},
+				Networks:   []string{sutNetwork.Name},
+				WaitingFor: wait.ForExit(),
+			},
+			Started: true,
+		})
+		testcontainers.CleanupContainer(t, curl)
+		require.NoError(t, err)
+
+		state, err := curl.State(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, 0, state.ExitCode)
+	})
+}
+
+func TestOathkeeper(t *testing.T) {
+	t.Run("should be able to pass identity to upstream", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+		session := tc.Deps.Sessions.As(t, "admin@fixtures.example.com", admin.Password)
+		browser := tc.Deps.Sessions.AsBrowser(t, "admin@fixtures.example.com", admin.Password)
+
+		for _, cl := range []*http.Client{browser.Client(), bearer(session.Token)} {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, tc.Deps.Edge.String()+"/api/me", nil)
+			require.NoError(t, err)
+
+			resp, err := cl.Do(req)
+			require.NoError(t, err)
+
+			raw, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, admin.Id, string(raw))
+		}
+	})
+
+	t.Run("should be able to reject anonymous requests", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, tc.Deps.Edge.String()+"/api/me", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+type bearerTransport string
+
+func (b bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+string(b))
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func bearer(token string) *http.Client {
+	return &http.Client{Transport: bearerTransport(token)}
+}
+
+func TestKeto(t *testing.T) {
+	viewer := func(id string) keto.RelationTuple {
+		return keto.RelationTuple{Namespace: "documents", Object: "readme", Relation: "viewer", SubjectID: id}
+	}
+
+	t.Run("should be able to grant relation to identity per test", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+
+		t.Run("with grant", func(t *testing.T) {
+			tc.Deps.KetoWrite.Grant(t, admin.Identity, "documents", "readme", "viewer")
+
+			allowed, err := tc.Deps.KetoRead.Check(t.Context(), viewer(admin.Id))
+			require.NoError(t, err)
+			assert.True(t, allowed)
+		})
+
+		allowed, err := tc.Deps.KetoRead.Check(t.Context(), viewer(admin.Id))
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+}
+
+func TestHydra(t *testing.T) {
+	t.Run("should be able to issue tokens for kratos identity", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		admin := tc.Deps.Fixtures.Get(t, "admin")
+		provider := tc.Deps.Kratos.Hydra
+
+		tokens, err := provider.AuthorizationCode(t.Context(), tc.Deps.Front, "admin@fixtures.example.com", admin.Password)
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.IDToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		info, err := provider.Introspect(t.Context(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.True(t, info.Active)
+		assert.Equal(t, admin.Id, info.Subject)
+	})
+
+	t.Run("should be able to reject wrong password", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		_, err := tc.Deps.Kratos.Hydra.AuthorizationCode(t.Context(), tc.Deps.Front, "admin@fixtures.example.com", "wrong")
+		require.Error(t, err)
+	})
+}
+
+func TestRegistrationFlows(t *testing.T) {
+	t.Run("should be able to register through native flow", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		email := tc.Deps.Faker.Internet().Email()
+
+		res, err := register(t, tc.Deps.Front, email)
+		require.NoError(t, err)
+		assert.Equal(t, email, res.Identity.Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to register through browser flow", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		browser, err := tc.Deps.Kratos.Browser()
+		require.NoError(t, err)
+
+		email := tc.Deps.Faker.Internet().Email()
+
+		res, err := browser.Register(t.Context(), selfservice.Registration{
+			Traits:   map[string]any{"email": email},
+			Password: tc.Deps.Faker.Internet().Password() + "Aa1!",
+		})
+		require.NoError(t, err)
+
+		_, _, err = tc.Deps.Client.IdentityAPI.GetIdentity(t.Context(), res.Identity.Id).Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("should be able to report schema violations", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		_, err := selfservice.Register(t.Context(), tc.Deps.Front, selfservice.Registration{
+			Traits:   map[string]any{"email": "not-an-email"},
+			Password: tc.Deps.Faker.Internet().Password() + "Aa1!",
+		})
+
+		var kerr *kratoserr.Error
+		require.ErrorAs(t, err, &kerr)
+		assert.Equal(t, http.StatusBadRequest, kerr.Status)
+		assert.NotEmpty(t, kerr.Field("traits.email"))
+	})
+}
+
+func TestSettingsFlows(t *testing.T) {
+	t.Run("should be able to update profile and password", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		email := tc.Deps.Faker.Internet().Email()
+		password := tc.Deps.Faker.Internet().Password() + "Aa1!"
+
+		_, err := selfservice.Register(t.Context(), tc.Deps.Front, selfservice.Registration{
+			Traits:   map[string]any{"email": email},
+			Password: password,
+		})
+		require.NoError(t, err)
+
+		// kratos.yaml has no session hook after registration
+		signin, err := login(t, tc.Deps.Front, email, password)
+		require.NoError(t, err)
+
+		token := signin.GetSessionToken()
+
+		renamed := tc.Deps.Faker.Internet().Email()
+
+		identity, err := selfservice.UpdateSettings(t.Context(), tc.Deps.Front, token, selfservice.Settings{
+			Traits: map[string]any{"email": renamed},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, renamed, identity.Traits.(map[string]any)["email"])
+
+		require.NoError(t, tc.Deps.Kratos.Reconfigure(t, func(cfg *kratosconf.Config) error {
+			return cfg.Set("selfservice.flows.settings.privileged_session_max_age", "1s")
+		}))
+
+		time.Sleep(2 * time.Second)
+
+		changed := tc.Deps.Faker.Internet().Password() + "Aa1!"
+
+		_, err = selfservice.UpdateSettings(t.Context(), tc.Deps.Front, token, selfservice.Settings{
+			Method:   selfservice.MethodPassword,
+			Password: changed,
+		})
+		require.ErrorIs(t, err, selfservice.ErrPrivilegedSessionRequired)
+
+		_, err = selfservice.UpdateSettings(t.Context(), tc.Deps.Front, token, selfservice.Settings{
+			Method:   selfservice.MethodPassword,
+			Password: changed,
+			Reauth:   &selfservice.Credentials{Identifier: renamed, Password: password},
+		})
+		require.NoError(t, err)
+
+		_, err = login(t, tc.Deps.Front, renamed, changed)
+		require.NoError(t, err)
+	})
+}
+
+func TestSessionRevocation(t *testing.T) {
+	// kratos.yaml has no session hook after registration
+	signedIn := func(t *testing.T, tc *groat.Case[Deps, State, *Service]) {
+		t.Helper()
+
+		require.NoError(t, tc.Deps.Kratos.Reconfigure(t, func(cfg *kratosconf.Config) error {
+			return cfg.Append("selfservice.flows.registration.after.password.hooks", map[string]any{"hook": "session"})
+		}))
+	}
+
+	signup := func(t *testing.T, tc *groat.Case[Deps, State, *Service]) (*selfservice.Registered, string) {
+		t.Helper()
+
+		signedIn(t, tc)
+
+		email := tc.Deps.Faker.Internet().Email()
+		password := tc.Deps.Faker.Internet().Password() + "Aa1!"
+
+		reg, err := selfservice.Register(t.Context(), tc.Deps.Front, selfservice.Registration{
+			Traits:   map[string]any{"email": email},
+			Password: password,
+		})
+		require.NoError(t, err)
+
+		return reg, password
+	}
+
+	t.Run("should be able to log out natively", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		reg, _ := signup(t, tc)
+
+		require.NoError(t, selfservice.Logout(t.Context(), tc.Deps.Front, reg.SessionToken))
+		assertk.EventuallyTokenRejected(t, tc.Deps.Front, reg.SessionToken, 5*time.Second)
+	})
+
+	t.Run("should be able to log out in browser", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		signedIn(t, tc)
+
+		browser, err := tc.Deps.Kratos.Browser()
+		require.NoError(t, err)
+
+		_, err = browser.Register(t.Context(), selfservice.Registration{
+			Traits:   map[string]any{"email": tc.Deps.Faker.Internet().Email()},
+			Password: tc.Deps.Faker.Internet().Password() + "Aa1!",
+		})
+		require.NoError(t, err)
+
+		cookies := browser.Cookies()
+
+		require.NoError(t, browser.Logout(t.Context()))
+		assertk.EventuallyCookieRejected(t, tc.Deps.Front, cookies, 5*time.Second)
+	})
+
+	t.Run("should be able to revoke other sessions", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		reg, password := signup(t, tc)
+		email := reg.Identity.Traits.(map[string]any)["email"].(string)
+
+		other, err := login(t, tc.Deps.Front, email, password)
+		require.NoError(t, err)
+
+		count, err := selfservice.RevokeOtherSessions(t.Context(), tc.Deps.Front, reg.SessionToken)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		assertk.EventuallyTokenRejected(t, tc.Deps.Front, other.GetSessionToken(), 5*time.Second)
+
+		_, _, err = tc.Deps.Front.FrontendAPI.ToSession(t.Context()).XSessionToken(reg.SessionToken).Execute()
+		require.NoError(t, err)
+	})
+
+	t.Run("should be able to revoke sessions through admin api", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		reg, password := signup(t, tc)
+		email := reg.Identity.Traits.(map[string]any)["email"].(string)
+
+		other, err := login(t, tc.Deps.Front, email, password)
+		require.NoError(t, err)
+
+		require.NoError(t, selfservice.RevokeSession(t.Context(), tc.Deps.Client, reg.Session.Id))
+		assertk.EventuallyTokenRejected(t, tc.Deps.Front, reg.SessionToken, 5*time.Second)
+
+		require.NoError(t, selfservice.RevokeIdentitySessions(t.Context(), tc.Deps.Client, reg.Identity.Id))
+		assertk.EventuallyTokenRejected(t, tc.Deps.Front, other.GetSessionToken(), 5*time.Second)
+	})
+}
+
+func TestSessionAssurance(t *testing.T) {
+	signin := func(t *testing.T, tc *groat.Case[Deps, State, *Service]) *client.SuccessfulNativeLogin {
+		t.Helper()
+
+		email := tc.Deps.Faker.Internet().Email()
+		password := tc.Deps.Faker.Internet().Password() + "Aa1!"
+
+		_, err := selfservice.Register(t.Context(), tc.Deps.Front, selfservice.Registration{
+			Traits:   map[string]any{"email": email},
+			Password: password,
+		})
+		require.NoError(t, err)
+
+		res, err := login(t, tc.Deps.Front, email, password)
+		require.NoError(t, err)
+
+		return res
+	}
+
+	t.Run("should be able to extend session", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		require.NoError(t, tc.Deps.Kratos.Reconfigure(t, expiry.EarliestExtend(24*time.Hour)))
+
+		res := signin(t, tc)
+
+		time.Sleep(time.Second)
+
+		extended, err := tc.Deps.Kratos.ExtendSession(t, res.Session.Id)
+		require.NoError(t, err)
+		assertk.Extended(t, &res.Session, extended)
+	})
+
+	t.Run("should be able to upgrade session to aal2 with totp", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		res := signin(t, tc)
+		assertk.AssuranceLevel(t, &res.Session, client.AUTHENTICATORASSURANCELEVEL_AAL1)
+
+		secret, err := selfservice.EnrollTOTP(t.Context(), tc.Deps.Front, res.GetSessionToken(), nil)
+		require.NoError(t, err)
+
+		session, err := selfservice.UpgradeAAL2(t.Context(), tc.Deps.Front, res.GetSessionToken(),
+			selfservice.TOTP(secret))
+		require.NoError(t, err)
+		assertk.AssuranceLevel(t, session, client.AUTHENTICATORASSURANCELEVEL_AAL2)
+		assertk.AuthenticatedWith(t, session, []string{selfservice.MethodPassword, selfservice.MethodTOTP})
+	})
+
+	t.Run("should be able to reject wrong second factor", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		res := signin(t, tc)
+
+		_, err := selfservice.EnrollTOTP(t.Context(), tc.Deps.Front, res.GetSessionToken(), nil)
+		require.NoError(t, err)
+
+		_, err = selfservice.UpgradeAAL2(t.Context(), tc.Deps.Front, res.GetSessionToken(),
+			func(context.Context) (string, error) { return "000000", nil })
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,103 @@
+package matrix
+
+import (
+	"os"
+	"testing"
+
+	"github.com/godepo/groat"
+	"github.com/godepo/groat/integration"
+	"github.com/jaswdr/faker/v2"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos"
+	"github.com/godepo/grokratos/pkg/kratosversion"
+	"github.com/godepo/grokratos/pkg/selfservice"
+	"github.com/godepo/grokratos/pkg/sessionhttp"
+)
+
+type (
+	Deps struct {
+		Admin  *client.APIClient `groat:"grokratos"`
+		Front  *client.APIClient `groat:"grokratos.front"`
+		Kratos *grokratos.Kratos `groat:"grokratos.kratos"`
+	}
+	State struct {
+	}
+)
+
+var suite *integration.Container[Deps, State, *client.APIClient]
+
+func TestMain(m *testing.M) {
+	if code, ok := grokratos.Matrix("oryd/kratos:v1.2.0", "oryd/kratos:v1.3.1"); ok {
+		os.Exit(code)
+	}
+
+	suite = integration.New[Deps, State, *client.APIClient](
+		m,
+		func(t *testing.T) *groat.Case[Deps, State, *client.APIClient] {
+			return groat.New[Deps, State, *client.APIClient](t, func(t *testing.T, deps Deps) *client.APIClient {
+				return deps.Front
+			})
+		},
+		grokratos.New[Deps](
+			grokratos.WithUserSchemaPath("../../pkg/tc-kratos/etc/user.schema.json"),
+			grokratos.WithConfig("../../pkg/tc-kratos/etc/kratos.yaml"),
+			grokratos.WithRecovery(selfservice.MethodCode),
+		),
+	)
+	os.Exit(suite.Go())
+}
+
+func TestSignIn(t *testing.T) {
+	t.Run("should be able to register and sign in on every version", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		email := faker.New().Internet().Email()
+		password := faker.New().Internet().Password() + "Aa1!"
+
+		_, err := selfservice.Register(t.Context(), tc.Deps.Front, selfservice.Registration{
+			Traits:   map[string]any{"email": email},
+			Password: password,
+		})
+		require.NoError(t, err)
+
+		session, err := tc.Deps.Kratos.Sessions.Login(t.Context(), email, password, sessionhttp.Token)
+		require.NoError(t, err)
+		assert.Equal(t, email, session.Identity.Traits.(map[string]any)["email"])
+	})
+}
+
+func TestAdminRecovery(t *testing.T) {
+	t.Run("should be able to recover with minted code", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		tc.Deps.Kratos.Require(t, kratosversion.AdminRecoveryCode)
+
+		created, _, err := tc.Deps.Admin.IdentityAPI.CreateIdentity(t.Context()).
+			CreateIdentityBody(client.CreateIdentityBody{
+				SchemaId: "user",
+				Traits:   map[string]any{"email": faker.New().Internet().Email()},
+			}).
+			Execute()
+		require.NoError(t, err)
+
+		res, err := selfservice.AdminRecover(t.Context(), tc.Deps.Front, tc.Deps.Admin, selfservice.AdminRecovery{
+			IdentityID: created.Id,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, created.Id, res.Session.GetIdentity().Id)
+	})
+}
+
+func TestVersionDetection(t *testing.T) {
+	t.Run("should be able to report running release", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		tagged, err := kratosversion.FromImage(tc.Deps.Kratos.Image)
+		require.NoError(t, err)
+		assert.Equal(t, tagged, tc.Deps.Kratos.Version)
+		assert.True(t, tc.Deps.Kratos.Supports(kratosversion.AdminSessions))
+	})
+}
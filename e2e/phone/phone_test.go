@@ -0,0 +1,91 @@
+package phone
+
+import (
+	"os"
+	"testing"
+
+	"github.com/godepo/groat"
+	"github.com/godepo/groat/integration"
+	"github.com/jaswdr/faker/v2"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos"
+	"github.com/godepo/grokratos/pkg/courier"
+)
+
+type (
+	Deps struct {
+		Admin  *client.APIClient `groat:"grokratos"`
+		Front  *client.APIClient `groat:"grokratos.front"`
+		Outbox *courier.Outbox   `groat:"grokratos.courier"`
+	}
+	State struct {
+	}
+)
+
+var suite *integration.Container[Deps, State, *client.APIClient]
+
+func TestMain(m *testing.M) {
+	suite = integration.New[Deps, State, *client.APIClient](
+		m,
+		func(t *testing.T) *groat.Case[Deps, State, *client.APIClient] {
+			return groat.New[Deps, State, *client.APIClient](t, func(t *testing.T, deps Deps) *client.APIClient {
+				return deps.Front
+			})
+		},
+		grokratos.New[Deps](
+			grokratos.WithUserSchemaPath("../../pkg/tc-kratos/etc/user.schema.json"),
+			grokratos.WithConfig("../../pkg/tc-kratos/etc/kratos.yaml"),
+			grokratos.WithSMSCourier(),
+			grokratos.WithPhoneSchema(),
+		),
+	)
+	os.Exit(suite.Go())
+}
+
+func TestPhoneCodeLogin(t *testing.T) {
+	t.Run("should be able to sign in with code sent by sms", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		phone := "+1555" + faker.New().Numerify("#######")
+
+		_, _, err := tc.Deps.Admin.IdentityAPI.
+			CreateIdentity(t.Context()).
+			CreateIdentityBody(client.CreateIdentityBody{
+				SchemaId: "phone",
+				Traits:   map[string]interface{}{"phone": phone},
+			}).
+			Execute()
+		require.NoError(t, err)
+
+		flow, _, err := tc.Deps.Front.FrontendAPI.CreateNativeLoginFlow(t.Context()).Execute()
+		require.NoError(t, err)
+
+		_, _, err = tc.Deps.Front.FrontendAPI.UpdateLoginFlow(t.Context()).Flow(flow.Id).
+			UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+				UpdateLoginFlowWithCodeMethod: &client.UpdateLoginFlowWithCodeMethod{
+					Method:     "code",
+					Identifier: client.PtrString(phone),
+				},
+			}).
+			Execute()
+		require.Error(t, err)
+
+		code, err := tc.Deps.Outbox.WaitForCode(t.Context(), phone)
+		require.NoError(t, err)
+
+		result, _, err := tc.Deps.Front.FrontendAPI.UpdateLoginFlow(t.Context()).Flow(flow.Id).
+			UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+				UpdateLoginFlowWithCodeMethod: &client.UpdateLoginFlowWithCodeMethod{
+					Method:     "code",
+					Identifier: client.PtrString(phone),
+					Code:       client.PtrString(code),
+				},
+			}).
+			Execute()
+		require.NoError(t, err)
+		assert.NotEmpty(t, result.GetSessionToken())
+	})
+}
@@ -0,0 +1,190 @@
+package recovery
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/godepo/groat"
+	"github.com/godepo/groat/integration"
+	"github.com/google/uuid"
+	"github.com/jaswdr/faker/v2"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos"
+	"github.com/godepo/grokratos/assertk"
+	"github.com/godepo/grokratos/pkg/courier"
+	"github.com/godepo/grokratos/pkg/selfservice"
+)
+
+type (
+	Deps struct {
+		Admin  *client.APIClient `groat:"grokratos"`
+		Front  *client.APIClient `groat:"grokratos.front"`
+		Outbox *courier.Outbox   `groat:"grokratos.courier"`
+		Kratos *grokratos.Kratos `groat:"grokratos.kratos"`
+	}
+	State struct {
+	}
+)
+
+var suite *integration.Container[Deps, State, *client.APIClient]
+
+func TestMain(m *testing.M) {
+	suite = integration.New[Deps, State, *client.APIClient](
+		m,
+		func(t *testing.T) *groat.Case[Deps, State, *client.APIClient] {
+			return groat.New[Deps, State, *client.APIClient](t, func(t *testing.T, deps Deps) *client.APIClient {
+				return deps.Front
+			})
+		},
+		grokratos.New[Deps](
+			grokratos.WithUserSchemaPath("../../pkg/tc-kratos/etc/user.schema.json"),
+			grokratos.WithConfig("../../pkg/tc-kratos/etc/kratos.yaml"),
+			grokratos.WithRecovery(selfservice.MethodCode),
+		),
+	)
+	os.Exit(suite.Go())
+}
+
+func identity(t *testing.T, admin *client.APIClient) (string, string) {
+	t.Helper()
+
+	email := faker.New().Internet().Email()
+
+	created, _, err := admin.IdentityAPI.CreateIdentity(t.Context()).
+		CreateIdentityBody(client.CreateIdentityBody{
+			SchemaId: "user",
+			Traits:   map[string]interface{}{"email": email},
+		}).
+		Execute()
+	require.NoError(t, err)
+
+	return created.Id, email
+}
+
+func TestRecovery(t *testing.T) {
+	t.Run("should be able to recover and set password", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		id, email := identity(t, tc.Deps.Admin)
+
+		res, err := selfservice.Recover(t.Context(), tc.Deps.Front, selfservice.Recovery{
+			Email: email,
+			Code:  tc.Deps.Outbox.CodeFor(email),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, id, res.Session.GetIdentity().Id)
+		assert.NotEmpty(t, res.SettingsFlow)
+
+		password := faker.New().Internet().Password() + "Aa1!"
+
+		_, err = selfservice.UpdateSettings(t.Context(), tc.Deps.Front, res.SessionToken, selfservice.Settings{
+			Method:   selfservice.MethodPassword,
+			Password: password,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("should be able to recover in browser", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		id, email := identity(t, tc.Deps.Admin)
+
+		browser, err := tc.Deps.Kratos.Browser()
+		require.NoError(t, err)
+
+		res, err := browser.Recover(t.Context(), selfservice.Recovery{
+			Email: email,
+			Code:  tc.Deps.Outbox.CodeFor(email),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, id, res.Session.GetIdentity().Id)
+	})
+
+	t.Run("should be able to reject wrong code", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		_, email := identity(t, tc.Deps.Admin)
+
+		_, err := selfservice.Recover(t.Context(), tc.Deps.Front, selfservice.Recovery{
+			Email: email,
+			Code: func(ctx context.Context) (string, error) {
+				if _, err := tc.Deps.Outbox.WaitFor(ctx, email); err != nil {
+					return "", err
+				}
+
+				return "000000", nil
+			},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestVerification(t *testing.T) {
+	t.Run("should be able to verify registered address", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		email := faker.New().Internet().Email()
+
+		reg, err := selfservice.Register(t.Context(), tc.Deps.Front, selfservice.Registration{
+			Traits:   map[string]any{"email": email},
+			Password: faker.New().Internet().Password() + "Aa1!",
+		})
+		require.NoError(t, err)
+
+		// registration mails a code of its own flow first
+		_, err = tc.Deps.Outbox.WaitFor(t.Context(), email)
+		require.NoError(t, err)
+
+		require.NoError(t, selfservice.Verify(t.Context(), tc.Deps.Front, selfservice.Verification{
+			Email: email,
+			Code:  tc.Deps.Outbox.CodeFor(email),
+		}))
+
+		assertk.EventuallyVerified(t, tc.Deps.Admin, reg.Identity.Id, email, 5*time.Second)
+	})
+}
+
+func TestAdminRecovery(t *testing.T) {
+	t.Run("should be able to recover with minted code", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		id, _ := identity(t, tc.Deps.Admin)
+
+		res, err := tc.Deps.Kratos.AdminRecover(t, selfservice.AdminRecovery{
+			IdentityID: id,
+			ExpiresIn:  "10m",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, id, res.Session.GetIdentity().Id)
+		assert.NotEmpty(t, res.SessionToken)
+	})
+
+	t.Run("should be able to recover with minted code in browser", func(t *testing.T) {
+		tc := suite.Case(t)
+
+		id, _ := identity(t, tc.Deps.Admin)
+
+		browser, err := tc.Deps.Kratos.Browser()
+		require.NoError(t, err)
+
+		res, err := browser.AdminRecover(t.Context(), tc.Deps.Admin, selfservice.AdminRecovery{IdentityID: id})
+		require.NoError(t, err)
+		assert.Equal(t, id, res.Session.GetIdentity().Id)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when identity is unknown", func(t *testing.T) {
+			tc := suite.Case(t)
+
+			_, err := tc.Deps.Kratos.AdminRecover(t, selfservice.AdminRecovery{
+				IdentityID: uuid.NewString(),
+			})
+			require.Error(t, err)
+		})
+	})
+}
@@ -11,6 +11,7 @@ require (
 	github.com/ory/kratos-client-go v1.3.8
 	github.com/stretchr/testify v1.10.0
 	github.com/testcontainers/testcontainers-go v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -102,7 +103,6 @@ require (
 	golang.org/x/tools v0.36.0 // indirect
 	google.golang.org/grpc v1.75.1 // indirect
 	google.golang.org/protobuf v1.36.10 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 tool github.com/vektra/mockery/v3
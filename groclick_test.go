@@ -3,7 +3,10 @@ package grokratos
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/selfservice"
 )
 
 func TestNew(t *testing.T) {
@@ -11,4 +14,22 @@ func TestNew(t *testing.T) {
 	require.NotNil(t, tc)
 	require.NotNil(t, tc.Deps.Admin)
 	require.NotNil(t, tc.Deps.Front)
+	require.NotNil(t, tc.Deps.OIDC)
+	require.NotNil(t, tc.Deps.Kratos)
+	assert.Same(t, tc.Deps.OIDC, tc.Deps.Kratos.OIDC["mock"])
+	assert.Equal(t, tc.Deps.Public, tc.Deps.Kratos.PublicURL)
+	assert.NotEmpty(t, tc.Deps.Public)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tc := suite.Case(t)
+
+	browser, err := selfservice.NewBrowser(tc.Deps.Front)
+	require.NoError(t, err)
+
+	session, err := browser.LoginWithOIDC(t.Context(), tc.Deps.OIDC.ID, "mock-user")
+	require.NoError(t, err)
+
+	traits := session.GetIdentity().Traits.(map[string]any)
+	assert.Equal(t, "mock-user@example.com", traits["email"])
 }
@@ -4,14 +4,28 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
+	"time"
 
 	"github.com/godepo/groat/integration"
 	"github.com/godepo/groat/pkg/ctxgroup"
 	"github.com/testcontainers/testcontainers-go"
 
 	"github.com/godepo/grokratos/internal/containersync"
+	"github.com/godepo/grokratos/pkg/courier"
+	"github.com/godepo/grokratos/pkg/expiry"
+	"github.com/godepo/grokratos/pkg/fixtures"
+	"github.com/godepo/grokratos/pkg/hydra"
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	"github.com/godepo/grokratos/pkg/mockoidc"
+	"github.com/godepo/grokratos/pkg/selfservice"
+	"github.com/godepo/grokratos/pkg/snapshot"
+	tchydra "github.com/godepo/grokratos/pkg/tc-hydra"
+	tcketo "github.com/godepo/grokratos/pkg/tc-keto"
 	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+	tcoathkeeper "github.com/godepo/grokratos/pkg/tc-oathkeeper"
+	"github.com/godepo/grokratos/pkg/webhook"
 )
 
 type (
@@ -29,9 +43,20 @@ type (
 	Container[T any] struct {
 		forks            *atomic.Int32
 		kratosContainer  KratosContainer
+		image            string
 		ctx              context.Context
 		injectLabel      string
 		frontInjectLabel string
+		oidcProviders    map[string]*mockoidc.Provider
+		outbox           *courier.Outbox
+		webhooks         *webhook.Receiver
+		fixtures         *fixtures.Set
+		snapshot         *snapshot.Snapshot
+		restoreEachTest  bool
+		config           *runtimeConfig
+		oathkeeper       OathkeeperContainer
+		keto             KetoContainer
+		hydra            *hydra.Provider
 	}
 	config struct {
 		containerImage   string
@@ -41,6 +66,37 @@ type (
 		runner           containerRunner
 		userSchemaPath   string
 		kratosConfig     string
+		oidcProviders    []oidcProvider
+		smsCourier       bool
+		emailCourier     bool
+		phoneSchema      bool
+		webhooks         []webhook.Hook
+		jsonnet          []string
+		fixtures         string
+		snapshot         bool
+		restoreEachTest  bool
+		containerOptions []tckratos.Option
+		logLevel         string
+		configPatches    []kratosconf.Patch
+		network          string
+
+		oathkeeper        bool
+		oathkeeperOptions []tcoathkeeper.Option
+		oathkeeperRunner  oathkeeperRunner
+
+		keto        bool
+		ketoOptions []tcketo.Option
+		ketoRunner  ketoRunner
+
+		hydra        bool
+		hydraOptions []tchydra.Option
+		hydraRunner  hydraRunner
+	}
+
+	oidcProvider struct {
+		id         string
+		mapperPath string
+		users      []mockoidc.User
 	}
 
 	Option func(*config)
@@ -76,10 +132,200 @@ func WithFrontInjectLabel(label string) Option {
 	}
 }
 
+// WithOIDCProvider runs a local OpenID Connect provider registered in Kratos
+// under id. An empty mapperPath selects a mapper copying the email claim into
+// traits. The provider is injected as *mockoidc.Provider under "<label>.oidc.<id>".
+func WithOIDCProvider(id, mapperPath string, users ...mockoidc.User) Option {
+	return func(c *config) {
+		c.oidcProviders = append(c.oidcProviders, oidcProvider{
+			id:         id,
+			mapperPath: mapperPath,
+			users:      users,
+		})
+	}
+}
+
+// WithSMSCourier captures text messages Kratos sends over the sms courier
+// channel. The outbox is injected as *courier.Outbox under "<label>.courier".
+func WithSMSCourier() Option {
+	return func(c *config) {
+		c.smsCourier = true
+	}
+}
+
+// WithEmailCourier captures emails Kratos sends by delivering them over http
+// into the same outbox as WithSMSCourier, injected under "<label>.courier".
+func WithEmailCourier() Option {
+	return func(c *config) {
+		c.emailCourier = true
+	}
+}
+
+// WithRecovery enables recovery and verification flows using method, code or
+// link, with their emails captured as by WithEmailCourier.
+func WithRecovery(method string) Option {
+	return func(c *config) {
+		c.emailCourier = true
+		c.configPatches = append(c.configPatches, selfservice.RecoveryPatch(method))
+	}
+}
+
+// WithPhoneSchema makes courier.PhoneSchema the default identity schema and
+// enables passwordless sign-in with codes sent by sms.
+func WithPhoneSchema() Option {
+	return func(c *config) {
+		c.phoneSchema = true
+	}
+}
+
+// WithWebhooks registers hooks as Kratos web_hook entries served by a local
+// receiver, injected as *webhook.Receiver under "<label>.webhooks".
+func WithWebhooks(hooks ...webhook.Hook) Option {
+	return func(c *config) {
+		c.webhooks = append(c.webhooks, hooks...)
+	}
+}
+
+// WithJsonnet mounts templates next to kratos.yaml so the config can refer to
+// them as file:///etc/config/kratos/<file name>.
+func WithJsonnet(paths ...string) Option {
+	return func(c *config) {
+		c.jsonnet = append(c.jsonnet, paths...)
+	}
+}
+
+// WithEnv sets an environment variable of the Kratos container, overriding
+// defaults like LOG_LEVEL. Reconfigure relies on Kratos logging applied config
+// changes and returns ErrReloadUnsupported with LOG_LEVEL above info.
+func WithEnv(key, value string) Option {
+	return func(c *config) {
+		if key == "LOG_LEVEL" {
+			c.logLevel = value
+		}
+
+		c.containerOptions = append(c.containerOptions, tckratos.WithEnv(key, value))
+	}
+}
+
+// WithArgs appends flags to the kratos serve command as given.
+func WithArgs(args ...string) Option {
+	return func(c *config) {
+		c.containerOptions = append(c.containerOptions, tckratos.WithArgs(args...))
+	}
+}
+
+// WithDevMode toggles the --dev flag, which is on by default. A --dev passed
+// through WithArgs turns it on regardless.
+func WithDevMode(enabled bool) Option {
+	return func(c *config) {
+		c.containerOptions = append(c.containerOptions, tckratos.WithDevMode(enabled))
+	}
+}
+
+// WithFile copies hostPath into the Kratos container at containerPath.
+func WithFile(hostPath, containerPath string) Option {
+	return func(c *config) {
+		c.containerOptions = append(c.containerOptions, tckratos.WithFile(hostPath, containerPath))
+	}
+}
+
+// WithFixtures imports identities declared in a YAML or JSON file once Kratos
+// is ready. The imported set is injected as *fixtures.Set under "<label>.fixtures".
+func WithFixtures(path string) Option {
+	return func(c *config) {
+		c.fixtures = path
+	}
+}
+
+// WithSnapshot captures state once fixtures are imported: a dump of the
+// database named by a DSN set through WithEnv, identities through the admin
+// API with the default memory DSN. The snapshot is injected as
+// *snapshot.Snapshot under "<label>.snapshot" for restoring on demand.
+func WithSnapshot() Option {
+	return func(c *config) {
+		c.snapshot = true
+	}
+}
+
+// WithRestoreEachTest captures a snapshot and restores it before every test
+// case. Tests sharing the container must not run in parallel.
+func WithRestoreEachTest() Option {
+	return func(c *config) {
+		c.snapshot = true
+		c.restoreEachTest = true
+	}
+}
+
+// WithNetwork attaches Kratos to an existing docker network so containers on
+// it, like the SUT or Oathkeeper, reach Kratos by alias. In-network base urls
+// are injected under "<label>.url.internal.public" and "<label>.url.internal.admin".
+func WithNetwork(name string, aliases ...string) Option {
+	return func(c *config) {
+		c.network = name
+		c.containerOptions = append(c.containerOptions, tckratos.WithNetwork(name, aliases...))
+	}
+}
+
+// WithNetworkBaseURLs makes Kratos advertise in-network urls in flows and
+// redirects, for flows driven from containers on the network. Clients
+// injected into tests keep using host ports.
+func WithNetworkBaseURLs() Option {
+	return func(c *config) {
+		c.containerOptions = append(c.containerOptions, tckratos.WithNetworkBaseURLs())
+	}
+}
+
+// WithOathkeeper starts Oathkeeper with cookie_session and bearer_token
+// authenticators checking sessions against this Kratos, joining the network
+// from WithNetwork when set. Access rules are passed with tcoathkeeper.WithRules;
+// the proxy url is injected as OathkeeperURL under "<label>.url.oathkeeper".
+func WithOathkeeper(opts ...tcoathkeeper.Option) Option {
+	return func(c *config) {
+		c.oathkeeper = true
+		c.oathkeeperOptions = append(c.oathkeeperOptions, opts...)
+	}
+}
+
+// WithKeto starts Keto for permission tests. Namespaces are passed with
+// tcketo.WithNamespaces or tcketo.WithOPL. Clients are injected as
+// *keto.ReadClient under "<label>.keto.read" and *keto.WriteClient under
+// "<label>.keto.write"; WriteClient.Grant relates identities per test.
+func WithKeto(opts ...tcketo.Option) Option {
+	return func(c *config) {
+		c.keto = true
+		c.ketoOptions = append(c.ketoOptions, opts...)
+	}
+}
+
+// WithHydra starts Hydra with Kratos as its login provider: Kratos gets
+// oauth2_provider.url and an in-process app grants consent. The provider is
+// injected as *hydra.Provider under "<label>.hydra"; its AuthorizationCode
+// runs the code flow with PKCE for an identity. Needs a config set with WithConfig.
+func WithHydra(opts ...tchydra.Option) Option {
+	return func(c *config) {
+		c.hydra = true
+		c.hydraOptions = append(c.hydraOptions, opts...)
+	}
+}
+
+// WithConfigPatch applies patches to the Kratos config before the container
+// starts. Patches need a config set with WithConfig.
+func WithConfigPatch(patches ...kratosconf.Patch) Option {
+	return func(c *config) {
+		c.configPatches = append(c.configPatches, patches...)
+	}
+}
+
+// WithLifespans shortens session and self-service flow lifespans so expiry can
+// be observed within a test; see the expiry package for waiting on it.
+func WithLifespans(session, flow time.Duration) Option {
+	return WithConfigPatch(expiry.Lifespans(session, flow))
+}
+
 func New[T any](options ...Option) integration.Bootstrap[T] {
 	cfg := config{
 		containerImage: "oryd/kratos:v1.3.1",
-		imageEnvValue:  "GROAT_I9N_KR_IMAGE",
+		imageEnvValue:  imageEnv,
 
 		injectLabel:      "grokratos",
 		frontInjectLabel: "grokratos.front",
@@ -89,6 +335,9 @@ func New[T any](options ...Option) integration.Bootstrap[T] {
 		) (KratosContainer, error) {
 			return tckratos.Run(ctx, opts...)
 		},
+		oathkeeperRunner: runOathkeeper,
+		ketoRunner:       runKeto,
+		hydraRunner:      runHydra,
 	}
 
 	for _, op := range options {
@@ -104,22 +353,151 @@ func New[T any](options ...Option) integration.Bootstrap[T] {
 
 func bootstrapper[T any](cfg config) integration.Bootstrap[T] {
 	return func(ctx context.Context) (integration.Injector[T], error) {
+		var seed *fixtures.Set
+
+		if cfg.fixtures != "" {
+			loaded, err := fixtures.Load(cfg.fixtures)
+			if err != nil {
+				return nil, fmt.Errorf("kratos fixtures: %w", err)
+			}
+
+			seed = loaded
+		}
+
+		side, err := startSidecars(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		kratosConfig, cleanup, err := renderConfig(cfg.kratosConfig, side.patches)
+		if err != nil {
+			side.Close()
+
+			return nil, err
+		}
+
+		runtime, err := loadRuntimeConfig(kratosConfig)
+		if err != nil {
+			cleanup()
+			side.Close()
+
+			return nil, err
+		}
+
+		runtime.logLevel = cfg.logLevel
+
 		kratosContainer, err := cfg.runner(
 			ctx,
-			tckratos.WithKratosConfig(cfg.kratosConfig),
-			tckratos.WithUserSchemaPath(cfg.userSchemaPath),
-			tckratos.WithKratosImage(cfg.containerImage),
+			append([]tckratos.Option{
+				tckratos.WithKratosConfig(kratosConfig),
+				tckratos.WithUserSchemaPath(cfg.userSchemaPath),
+				tckratos.WithKratosImage(cfg.containerImage),
+			}, containerOptions(cfg, side)...)...,
 		)
+
+		cleanup()
+
 		if err != nil {
+			side.Close()
+
 			return nil, fmt.Errorf("kratos container failed to run: %w", err)
 		}
 
 		ctxgroup.IncAt(ctx)
 
-		go containersync.Terminator(ctx, kratosContainer.Terminate)()
+		go containersync.Terminator(ctx, side.Terminate(kratosContainer.Terminate))()
 
 		container := newContainer[T](ctx, kratosContainer, cfg)
+		container.oidcProviders = side.oidc
+		container.outbox = side.outbox
+		container.webhooks = side.webhooks
+		container.config = runtime
+		container.hydra = side.hydra
+
+		if side.hydra != nil {
+			side.hydra.SetKratosURL(apiScheme + "://" + kratosContainer.PublicConnectionString(ctx))
+		}
+
+		admin := newAPIClient(kratosContainer.AdminConnectionString(ctx))
+
+		if seed != nil {
+			if err := seed.Import(ctx, admin); err != nil {
+				return nil, fmt.Errorf("kratos fixtures: %w", err)
+			}
+
+			container.fixtures = seed
+		}
+
+		if cfg.snapshot {
+			snapOpts, err := snapshotOptions(ctx, kratosContainer)
+			if err != nil {
+				return nil, err
+			}
+
+			snap, err := snapshot.Capture(ctx, admin, snapOpts...)
+			if err != nil {
+				return nil, fmt.Errorf("kratos snapshot: %w", err)
+			}
+
+			if seed != nil {
+				snap.OnRestore(func(ctx context.Context, snap *snapshot.Snapshot) error {
+					return seed.Rebind(ctx, admin, snap.ID)
+				})
+			}
+
+			container.snapshot = snap
+			container.restoreEachTest = cfg.restoreEachTest
+		}
+
+		if cfg.oathkeeper {
+			oathkeeper, err := startOathkeeper(ctx, cfg, kratosContainer)
+			if err != nil {
+				return nil, err
+			}
+
+			container.oathkeeper = oathkeeper
+		}
+
+		if cfg.keto {
+			ketoContainer, err := startKeto(ctx, cfg)
+			if err != nil {
+				return nil, err
+			}
+
+			container.keto = ketoContainer
+		}
 
 		return container.Injector, nil
 	}
 }
+
+func loadRuntimeConfig(path string) (*runtimeConfig, error) {
+	if path == "" {
+		return &runtimeConfig{current: kratosconf.New(), timeout: reloadTimeout}, nil
+	}
+
+	current, err := kratosconf.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("kratos runtime config: %w", err)
+	}
+
+	return &runtimeConfig{current: current, timeout: reloadTimeout}, nil
+}
+
+func containerOptions(cfg config, side *sidecars) []tckratos.Option {
+	res := make([]tckratos.Option, 0, len(side.options)+len(cfg.jsonnet)+len(cfg.containerOptions))
+	res = append(res, side.options...)
+	res = append(res, mounts(cfg.jsonnet)...)
+
+	return append(res, cfg.containerOptions...)
+}
+
+func mounts(paths []string) []tckratos.Option {
+	res := make([]tckratos.Option, 0, len(paths))
+
+	for _, path := range paths {
+		res = append(res, tckratos.WithFile(path, tckratos.ConfigDir+"/"+filepath.Base(path)))
+	}
+
+	return res
+}
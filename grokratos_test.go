@@ -3,13 +3,32 @@ package grokratos
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
 
 	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
 )
 
+type stubContainer struct {
+	admin string
+}
+
+func (s stubContainer) PublicConnectionString(context.Context) string {
+	return s.admin
+}
+
+func (s stubContainer) AdminConnectionString(context.Context) string {
+	return s.admin
+}
+
+func (s stubContainer) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return nil
+}
+
 func TestBootstrapper(t *testing.T) {
 	t.Run("should be able can't run", func(t *testing.T) {
 		t.Run("when is not specified config path", func(t *testing.T) {
@@ -22,5 +41,61 @@ func TestBootstrapper(t *testing.T) {
 			require.ErrorIs(t, err, exp)
 
 		})
+
+		t.Run("when oidc mapper is absent", func(t *testing.T) {
+			var cfg config
+			WithOIDCProvider("mock", filepath.Join(t.TempDir(), "absent.jsonnet"))(&cfg)
+
+			_, err := bootstrapper[Deps](cfg)(t.Context())
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+
+		t.Run("when kratos config is absent", func(t *testing.T) {
+			var cfg config
+			WithOIDCProvider("mock", "")(&cfg)
+			WithConfig(filepath.Join(t.TempDir(), "absent.yaml"))(&cfg)
+
+			_, err := bootstrapper[Deps](cfg)(t.Context())
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+
+		t.Run("when fixtures are absent", func(t *testing.T) {
+			var cfg config
+			WithFixtures(filepath.Join(t.TempDir(), "absent.yaml"))(&cfg)
+
+			_, err := bootstrapper[Deps](cfg)(t.Context())
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+
+		t.Run("when fixtures cant be imported", func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fixtures.yaml")
+			require.NoError(t, os.WriteFile(path, []byte("identities:\n  admin:\n    traits: {}\n"), 0o600))
+
+			var cfg config
+			WithFixtures(path)(&cfg)
+			cfg.runner = func(context.Context, ...tckratos.Option) (KratosContainer, error) {
+				return stubContainer{admin: "127.0.0.1:1"}, nil
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			_, err := bootstrapper[Deps](cfg)(ctx)
+			require.ErrorContains(t, err, "kratos fixtures")
+		})
+
+		t.Run("when snapshot cant be captured", func(t *testing.T) {
+			var cfg config
+			WithRestoreEachTest()(&cfg)
+			cfg.runner = func(context.Context, ...tckratos.Option) (KratosContainer, error) {
+				return stubContainer{admin: "127.0.0.1:1"}, nil
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			_, err := bootstrapper[Deps](cfg)(ctx)
+			require.ErrorContains(t, err, "kratos snapshot")
+		})
 	})
 }
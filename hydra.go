@@ -0,0 +1,89 @@
+package grokratos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/pkg/hydra"
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	tchydra "github.com/godepo/grokratos/pkg/tc-hydra"
+	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+)
+
+type (
+	HydraContainer interface {
+		PublicConnectionString(ctx context.Context) string
+		AdminConnectionString(ctx context.Context) string
+		Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error
+	}
+
+	hydraRunner func(ctx context.Context, opts ...tchydra.Option) (HydraContainer, error)
+
+	internalAdmin interface {
+		InternalAdminConnectionString(ctx context.Context) string
+	}
+
+	// terminator lets a container be closed together with the sidecars.
+	terminator struct {
+		terminate func(context.Context, ...testcontainers.TerminateOption) error
+	}
+)
+
+func runHydra(ctx context.Context, opts ...tchydra.Option) (HydraContainer, error) {
+	return tchydra.Run(ctx, opts...)
+}
+
+// startHydra runs the login and consent app and Hydra before Kratos, so that
+// Kratos is started with oauth2_provider.url pointing at the Hydra admin API.
+func (s *sidecars) startHydra(ctx context.Context, cfg config) error {
+	prov, err := hydra.New()
+	if err != nil {
+		return err
+	}
+
+	s.closers = append(s.closers, prov)
+
+	opts := []tchydra.Option{tchydra.WithLoginConsentURLs(prov.LoginURL(), prov.ConsentURL())}
+	if cfg.network != "" {
+		opts = append(opts, tchydra.WithNetwork(cfg.network))
+	}
+
+	hydraContainer, err := cfg.hydraRunner(ctx, append(opts, cfg.hydraOptions...)...)
+	if err != nil {
+		return fmt.Errorf("hydra container failed to run: %w", err)
+	}
+
+	s.closers = append(s.closers, terminator{terminate: hydraContainer.Terminate})
+
+	prov.Connect(
+		apiScheme+"://"+hydraContainer.PublicConnectionString(ctx),
+		apiScheme+"://"+hydraContainer.AdminConnectionString(ctx),
+	)
+
+	var adminURL string
+
+	if ic, ok := hydraContainer.(internalAdmin); ok && cfg.network != "" {
+		adminURL = apiScheme + "://" + ic.InternalAdminConnectionString(ctx)
+	} else {
+		url, port, err := viaHost(hydraContainer.AdminConnectionString(ctx))
+		if err != nil {
+			return fmt.Errorf("hydra admin port: %w", err)
+		}
+
+		adminURL = url
+		s.options = append(s.options, tckratos.WithHostAccessPorts(port))
+	}
+
+	s.hydra = prov
+	s.patches = append(s.patches, func(doc *kratosconf.Config) error {
+		return doc.Set("oauth2_provider.url", adminURL)
+	})
+
+	return nil
+}
+
+func (t terminator) Close() error {
+	return t.terminate(context.Background())
+}
@@ -0,0 +1,160 @@
+package grokratos
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/pkg/hydra"
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	tchydra "github.com/godepo/grokratos/pkg/tc-hydra"
+)
+
+type stubHydra struct {
+	terminated *bool
+}
+
+func (stubHydra) PublicConnectionString(context.Context) string {
+	return "localhost:4444"
+}
+
+func (stubHydra) AdminConnectionString(context.Context) string {
+	return "localhost:4445"
+}
+
+func (s stubHydra) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	*s.terminated = true
+
+	return nil
+}
+
+type networkedHydra struct {
+	stubHydra
+}
+
+func (networkedHydra) InternalAdminConnectionString(context.Context) string {
+	return "hydra:4445"
+}
+
+type hydraDeps struct {
+	Hydra *hydra.Provider `groat:"kr.hydra"`
+}
+
+func oauth2ProviderURL(t *testing.T, side *sidecars) any {
+	t.Helper()
+
+	doc := kratosconf.New()
+	require.NoError(t, doc.Apply(side.patches...))
+
+	val, _ := doc.Get("oauth2_provider.url")
+
+	return val
+}
+
+func TestStartHydra(t *testing.T) {
+	t.Run("should be able to reach hydra admin through host port", func(t *testing.T) {
+		var (
+			cfg        config
+			terminated bool
+		)
+
+		WithHydra(tchydra.WithImage("oryd/hydra:latest"))(&cfg)
+		cfg.hydraRunner = func(_ context.Context, opts ...tchydra.Option) (HydraContainer, error) {
+			assert.Len(t, opts, 2)
+
+			return stubHydra{terminated: &terminated}, nil
+		}
+
+		side, err := startSidecars(t.Context(), cfg)
+		require.NoError(t, err)
+
+		require.NotNil(t, side.hydra)
+		assert.Equal(t, "http://localhost:4444", side.hydra.PublicURL())
+		assert.Equal(t, "http://localhost:4445", side.hydra.AdminURL())
+		assert.Equal(t, "http://host.testcontainers.internal:4445", oauth2ProviderURL(t, side))
+		assert.Len(t, side.options, 1)
+
+		side.Close()
+		assert.True(t, terminated)
+	})
+
+	t.Run("should be able to reach hydra admin on network", func(t *testing.T) {
+		var (
+			cfg        config
+			terminated bool
+		)
+
+		WithNetwork("sut")(&cfg)
+		WithHydra()(&cfg)
+		cfg.hydraRunner = func(context.Context, ...tchydra.Option) (HydraContainer, error) {
+			return networkedHydra{stubHydra{terminated: &terminated}}, nil
+		}
+
+		side, err := startSidecars(t.Context(), cfg)
+		require.NoError(t, err)
+		t.Cleanup(side.Close)
+
+		assert.Equal(t, "http://hydra:4445", oauth2ProviderURL(t, side))
+		assert.Empty(t, side.options)
+	})
+
+	t.Run("should be able to inject provider", func(t *testing.T) {
+		prov, err := hydra.New()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = prov.Close()
+		})
+
+		container := newContainer[hydraDeps](t.Context(), stubContainer{admin: "127.0.0.1:4434"}, config{
+			injectLabel: "kr",
+		})
+		assert.Nil(t, container.Injector(t, hydraDeps{}).Hydra)
+
+		container.hydra = prov
+		assert.Same(t, prov, container.Injector(t, hydraDeps{}).Hydra)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when container cant run", func(t *testing.T) {
+			exp := errors.New("unexpected error")
+
+			var cfg config
+			WithHydra()(&cfg)
+			cfg.hydraRunner = func(context.Context, ...tchydra.Option) (HydraContainer, error) {
+				return nil, exp
+			}
+
+			_, err := bootstrapper[Deps](cfg)(t.Context())
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when hydra admin has no port", func(t *testing.T) {
+			var cfg config
+			WithHydra()(&cfg)
+			cfg.hydraRunner = func(context.Context, ...tchydra.Option) (HydraContainer, error) {
+				return badHydra{}, nil
+			}
+
+			_, err := startSidecars(t.Context(), cfg)
+			require.ErrorContains(t, err, "hydra admin port")
+		})
+	})
+}
+
+type badHydra struct{}
+
+func (badHydra) PublicConnectionString(context.Context) string {
+	return "localhost"
+}
+
+func (badHydra) AdminConnectionString(context.Context) string {
+	return "localhost"
+}
+
+func (badHydra) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package hostserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const readTimeout = 10 * time.Second
+
+type (
+	ListenerConstructor func(network string, address string) (net.Listener, error)
+
+	// Server is an http server on the test host that containers reach through
+	// testcontainers host access.
+	Server struct {
+		listener net.Listener
+		server   *http.Server
+	}
+)
+
+func Start(handler http.Handler, listen ListenerConstructor) (*Server, error) {
+	ln, err := listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	srv := &Server{
+		listener: ln,
+		server: &http.Server{
+			Handler:           handler,
+			ReadHeaderTimeout: readTimeout,
+		},
+	}
+
+	go func() {
+		_ = srv.server.Serve(ln)
+	}()
+
+	return srv, nil
+}
+
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// URL is the server address as seen from inside a container.
+func (s *Server) URL() string {
+	return "http://" + net.JoinHostPort(testcontainers.HostInternal, strconv.Itoa(s.Port()))
+}
+
+// LocalURL is the server address as seen from the test process.
+func (s *Server) LocalURL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	if err := s.server.Close(); err != nil {
+		return fmt.Errorf("failed to close host server: %w", err)
+	}
+
+	return nil
+}
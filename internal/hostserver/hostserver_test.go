@@ -0,0 +1,43 @@
+package hostserver
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestStart(t *testing.T) {
+	t.Run("should be able to serve handler", func(t *testing.T) {
+		srv, err := Start(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}), net.Listen)
+		require.NoError(t, err)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.LocalURL(), nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+		assert.Equal(t, "http://"+testcontainers.HostInternal+":"+strconv.Itoa(srv.Port()), srv.URL())
+		require.NoError(t, srv.Close())
+	})
+
+	t.Run("should be able to be failed when cant listen", func(t *testing.T) {
+		expErr := errors.New(uuid.NewString())
+		_, err := Start(http.NotFoundHandler(), func(string, string) (net.Listener, error) {
+			return nil, expErr
+		})
+		require.ErrorIs(t, err, expErr)
+	})
+}
@@ -0,0 +1,44 @@
+// Package kratostest serves fake Kratos APIs to package tests.
+package kratostest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+// Serve starts handler until the end of t and returns the server together with
+// a Kratos client talking to it. Handlers may be added to a mux afterwards, e.g.
+// ones linking to the server url.
+func Serve(t testing.TB, handler http.Handler) (*httptest.Server, *client.APIClient) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	addr, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to parse fake kratos url: %v", err)
+	}
+
+	return srv, Client(addr.Host)
+}
+
+// Client talks plain http to host, e.g. one nothing listens on.
+func Client(host string) *client.APIClient {
+	cfg := client.NewConfiguration()
+	cfg.Host = host
+	cfg.Scheme = "http"
+
+	return client.NewAPIClient(cfg)
+}
+
+func WriteJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
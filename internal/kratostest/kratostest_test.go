@@ -0,0 +1,33 @@
+package kratostest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServe(t *testing.T) {
+	t.Run("should be able to reach fake through client", func(t *testing.T) {
+		mux := http.NewServeMux()
+		srv, cl := Serve(t, mux)
+
+		mux.HandleFunc("GET /health/alive", func(w http.ResponseWriter, r *http.Request) {
+			WriteJSON(w, http.StatusOK, map[string]any{"status": "ok", "url": srv.URL})
+		})
+
+		res, resp, err := cl.MetadataAPI.IsAlive(t.Context()).Execute()
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "ok", res.Status)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when host is unreachable", func(t *testing.T) {
+			_, _, err := Client("127.0.0.1:1").MetadataAPI.IsAlive(t.Context()).Execute()
+			require.Error(t, err)
+		})
+	})
+}
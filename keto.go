@@ -0,0 +1,56 @@
+package grokratos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godepo/groat/pkg/ctxgroup"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/internal/containersync"
+	"github.com/godepo/grokratos/pkg/keto"
+	tcketo "github.com/godepo/grokratos/pkg/tc-keto"
+)
+
+type (
+	KetoContainer interface {
+		ReadConnectionString(ctx context.Context) string
+		WriteConnectionString(ctx context.Context) string
+		Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error
+	}
+
+	ketoRunner func(ctx context.Context, opts ...tcketo.Option) (KetoContainer, error)
+)
+
+func runKeto(ctx context.Context, opts ...tcketo.Option) (KetoContainer, error) {
+	return tcketo.Run(ctx, opts...)
+}
+
+// startKeto runs Keto on the network from WithNetwork, when set.
+func startKeto(ctx context.Context, cfg config) (KetoContainer, error) {
+	var opts []tcketo.Option
+
+	if cfg.network != "" {
+		opts = append(opts, tcketo.WithNetwork(cfg.network))
+	}
+
+	ketoContainer, err := cfg.ketoRunner(ctx, append(opts, cfg.ketoOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("keto container failed to run: %w", err)
+	}
+
+	ctxgroup.IncAt(ctx)
+
+	go containersync.Terminator(ctx, ketoContainer.Terminate)()
+
+	return ketoContainer, nil
+}
+
+func (c *Container[T]) ketoClients(ctx context.Context) (*keto.ReadClient, *keto.WriteClient) {
+	if c.keto == nil {
+		return nil, nil
+	}
+
+	return keto.NewReadClient(apiScheme + "://" + c.keto.ReadConnectionString(ctx)),
+		keto.NewWriteClient(apiScheme + "://" + c.keto.WriteConnectionString(ctx))
+}
@@ -0,0 +1,102 @@
+package grokratos
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/pkg/keto"
+	tcketo "github.com/godepo/grokratos/pkg/tc-keto"
+	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+)
+
+type stubKeto struct{}
+
+func (stubKeto) ReadConnectionString(context.Context) string {
+	return "127.0.0.1:4466"
+}
+
+func (stubKeto) WriteConnectionString(context.Context) string {
+	return "127.0.0.1:4467"
+}
+
+func (stubKeto) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return nil
+}
+
+type ketoDeps struct {
+	Read  *keto.ReadClient  `groat:"kr.keto.read"`
+	Write *keto.WriteClient `groat:"kr.keto.write"`
+}
+
+func TestStartKeto(t *testing.T) {
+	t.Run("should be able to join network", func(t *testing.T) {
+		var (
+			cfg config
+			req testcontainers.GenericContainerRequest
+		)
+
+		WithNetwork("sut")(&cfg)
+		WithKeto(tcketo.WithNamespaces("documents"))(&cfg)
+		cfg.ketoRunner = func(ctx context.Context, opts ...tcketo.Option) (KetoContainer, error) {
+			_, err := tcketo.Run(ctx, append(opts, tcketo.WithContainerConstructor(func(
+				_ context.Context, got testcontainers.GenericContainerRequest,
+			) (testcontainers.Container, error) {
+				req = got
+
+				return nil, nil
+			}))...)
+			if err != nil {
+				return nil, err
+			}
+
+			return stubKeto{}, nil
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		_, err := startKeto(ctx, cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sut"}, req.Networks)
+	})
+
+	t.Run("should be able to inject clients", func(t *testing.T) {
+		container := newContainer[ketoDeps](t.Context(), stubContainer{admin: "127.0.0.1:4434"}, config{
+			injectLabel: "kr",
+		})
+
+		assert.Nil(t, container.Injector(t, ketoDeps{}).Read)
+
+		container.keto = stubKeto{}
+
+		deps := container.Injector(t, ketoDeps{})
+		require.NotNil(t, deps.Read)
+		require.NotNil(t, deps.Write)
+		assert.Equal(t, "http://127.0.0.1:4466", deps.Read.URL)
+		assert.Equal(t, "http://127.0.0.1:4467", deps.Write.URL)
+	})
+
+	t.Run("should be able to be failed when container cant run", func(t *testing.T) {
+		exp := errors.New("unexpected error")
+
+		var cfg config
+		WithKeto()(&cfg)
+		cfg.runner = func(context.Context, ...tckratos.Option) (KratosContainer, error) {
+			return stubContainer{admin: "127.0.0.1:4433"}, nil
+		}
+		cfg.ketoRunner = func(context.Context, ...tcketo.Option) (KetoContainer, error) {
+			return nil, exp
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		_, err := bootstrapper[Deps](cfg)(ctx)
+		require.ErrorIs(t, err, exp)
+	})
+}
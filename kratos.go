@@ -0,0 +1,225 @@
+package grokratos
+
+import (
+	"context"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/courier"
+	"github.com/godepo/grokratos/pkg/fixtures"
+	"github.com/godepo/grokratos/pkg/hydra"
+	"github.com/godepo/grokratos/pkg/jsonnettest"
+	"github.com/godepo/grokratos/pkg/keto"
+	"github.com/godepo/grokratos/pkg/kratosversion"
+	"github.com/godepo/grokratos/pkg/mockoidc"
+	"github.com/godepo/grokratos/pkg/selfservice"
+	"github.com/godepo/grokratos/pkg/sessionhttp"
+	"github.com/godepo/grokratos/pkg/snapshot"
+	"github.com/godepo/grokratos/pkg/webhook"
+)
+
+type (
+	// PublicURL is the base url of the Kratos public API, injected under "<label>.url.public".
+	PublicURL string
+
+	// AdminURL is the base url of the Kratos admin API, injected under "<label>.url.admin".
+	AdminURL string
+
+	networkedContainer interface {
+		InternalPublicConnectionString(ctx context.Context) string
+		InternalAdminConnectionString(ctx context.Context) string
+	}
+
+	versionedContainer interface {
+		KratosVersion(ctx context.Context) kratosversion.Version
+	}
+
+	// Kratos bundles everything grokratos injects for one container. It is
+	// injected as *grokratos.Kratos under "<label>.kratos"; optional parts
+	// are nil unless enabled by options.
+	Kratos struct {
+		Admin     *client.APIClient
+		Front     *client.APIClient
+		PublicURL PublicURL
+		AdminURL  AdminURL
+		Container KratosContainer
+
+		// Image is the Kratos image the container runs and Version the release
+		// it reports, else its tag; zero when neither tells.
+		Image   string
+		Version kratosversion.Version
+
+		// InternalPublicURL and InternalAdminURL are the base urls containers on
+		// the network joined with WithNetwork use; empty without a network.
+		InternalPublicURL PublicURL
+		InternalAdminURL  AdminURL
+
+		// OathkeeperURL is the proxy of the Oathkeeper started by WithOathkeeper.
+		OathkeeperURL OathkeeperURL
+
+		// KetoRead and KetoWrite talk to the Keto started by WithKeto.
+		KetoRead  *keto.ReadClient
+		KetoWrite *keto.WriteClient
+
+		// Hydra is the login and consent app of the Hydra started by WithHydra.
+		Hydra *hydra.Provider
+
+		Sessions *sessionhttp.Factory
+		Jsonnet  *jsonnettest.Harness
+		OIDC     map[string]*mockoidc.Provider
+		Courier  *courier.Outbox
+		Webhooks *webhook.Receiver
+		Fixtures *fixtures.Set
+		Snapshot *snapshot.Snapshot
+
+		config *runtimeConfig
+	}
+)
+
+func (c *Container[T]) kratos(ctx context.Context) *Kratos {
+	publicHost := c.kratosContainer.PublicConnectionString(ctx)
+	adminHost := c.kratosContainer.AdminConnectionString(ctx)
+
+	admin := newAPIClient(adminHost)
+	front := newAPIClient(publicHost)
+
+	handle := &Kratos{
+		Admin:     admin,
+		Front:     front,
+		PublicURL: PublicURL(apiScheme + "://" + publicHost),
+		AdminURL:  AdminURL(apiScheme + "://" + adminHost),
+		Container: c.kratosContainer,
+		Image:     c.image,
+		Sessions:  sessionhttp.New(front),
+		Jsonnet:   &jsonnettest.Harness{Front: front, Admin: admin, Hooks: c.webhooks},
+		OIDC:      c.oidcProviders,
+		Courier:   c.outbox,
+		Webhooks:  c.webhooks,
+		Fixtures:  c.fixtures,
+		Snapshot:  c.snapshot,
+		Hydra:     c.hydra,
+		config:    c.config,
+	}
+
+	if vc, ok := c.kratosContainer.(versionedContainer); ok {
+		handle.Version = vc.KratosVersion(ctx)
+	}
+
+	if ver, err := kratosversion.FromImage(c.image); err == nil && handle.Version.IsZero() {
+		handle.Version = ver
+	}
+
+	if nc, ok := c.kratosContainer.(networkedContainer); ok {
+		if host := nc.InternalPublicConnectionString(ctx); host != "" {
+			handle.InternalPublicURL = PublicURL(apiScheme + "://" + host)
+		}
+
+		if host := nc.InternalAdminConnectionString(ctx); host != "" {
+			handle.InternalAdminURL = AdminURL(apiScheme + "://" + host)
+		}
+	}
+
+	handle.KetoRead, handle.KetoWrite = c.ketoClients(ctx)
+
+	if c.oathkeeper != nil {
+		handle.OathkeeperURL = OathkeeperURL(apiScheme + "://" + c.oathkeeper.ProxyConnectionString(ctx))
+	}
+
+	return handle
+}
+
+// RequireVersion skips t on Kratos releases older than minimum, e.g. "v1.2.0",
+// for features a matrix run can't exercise on every image. Images without a
+// version tag run everything.
+func (k *Kratos) RequireVersion(t testing.TB, minimum string) {
+	t.Helper()
+
+	if k.Version.IsZero() || k.Version.AtLeast(kratosversion.MustParse(minimum)) {
+		return
+	}
+
+	t.Skipf("requires kratos %s, running %s", minimum, k.Image)
+}
+
+// Supports reports whether the running Kratos ships c.
+func (k *Kratos) Supports(c kratosversion.Capability) bool {
+	return k.Version.Supports(c)
+}
+
+// Require skips t when the running Kratos lacks c.
+func (k *Kratos) Require(t testing.TB, c kratosversion.Capability) {
+	t.Helper()
+
+	if k.Supports(c) {
+		return
+	}
+
+	if since, ok := kratosversion.Since(c); ok {
+		t.Skipf("%s requires kratos %s, running %s", c, since, k.Version)
+	}
+
+	t.Skipf("%s is unknown to grokratos", c)
+}
+
+// ExtendSession is selfservice.ExtendSession skipping t on releases without
+// the admin session APIs.
+func (k *Kratos) ExtendSession(t testing.TB, id string) (*client.Session, error) {
+	t.Helper()
+	k.Require(t, kratosversion.AdminSessions)
+
+	return selfservice.ExtendSession(t.Context(), k.Admin, id)
+}
+
+// AdminRecover is selfservice.AdminRecover skipping t on releases without
+// admin recovery codes for native flows.
+func (k *Kratos) AdminRecover(t testing.TB, rec selfservice.AdminRecovery) (*selfservice.Recovered, error) {
+	t.Helper()
+	k.Require(t, kratosversion.AdminRecoveryCode)
+
+	return selfservice.AdminRecover(t.Context(), k.Front, k.Admin, rec)
+}
+
+// Register is selfservice.Register skipping t on releases without the method
+// of reg.
+func (k *Kratos) Register(t testing.TB, reg selfservice.Registration) (*selfservice.Registered, error) {
+	t.Helper()
+	k.requireMethod(t, reg.Method)
+
+	return selfservice.Register(t.Context(), k.Front, reg)
+}
+
+// RegisterInBrowser is b.Register skipping t on releases without the method
+// of reg, e.g. passkeys.
+func (k *Kratos) RegisterInBrowser(
+	t testing.TB, b *selfservice.Browser, reg selfservice.Registration,
+) (*selfservice.Registered, error) {
+	t.Helper()
+	k.requireMethod(t, reg.Method)
+
+	return b.Register(t.Context(), reg)
+}
+
+func (k *Kratos) requireMethod(t testing.TB, method string) {
+	t.Helper()
+
+	switch method {
+	case selfservice.MethodCode:
+		k.Require(t, kratosversion.CodeMethod)
+	case selfservice.MethodPasskey:
+		k.Require(t, kratosversion.Passkeys)
+	}
+}
+
+// Browser returns a fresh cookie-keeping client for browser flows.
+func (k *Kratos) Browser() (*selfservice.Browser, error) {
+	return selfservice.NewBrowser(k.Front)
+}
+
+func (u PublicURL) String() string {
+	return string(u)
+}
+
+func (u AdminURL) String() string {
+	return string(u)
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/godepo/groat"
 	"github.com/godepo/groat/integration"
 	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/mockoidc"
 )
 
 type (
@@ -16,8 +18,11 @@ type (
 	State struct {
 	}
 	Deps struct {
-		Front *client.APIClient `groat:"grokratos"`
-		Admin *client.APIClient `groat:"grokratos.front"`
+		Admin  *client.APIClient  `groat:"grokratos"`
+		Front  *client.APIClient  `groat:"grokratos.front"`
+		OIDC   *mockoidc.Provider `groat:"grokratos.oidc.mock"`
+		Kratos *Kratos            `groat:"grokratos.kratos"`
+		Public PublicURL          `groat:"grokratos.url.public"`
 	}
 )
 
@@ -40,6 +45,10 @@ func TestMain(m *testing.M) {
 			WithFrontInjectLabel("grokratos.front"),
 			WithUserSchemaPath("pkg/tc-kratos/etc/user.schema.json"),
 			WithConfig("pkg/tc-kratos/etc/kratos.yaml"),
+			WithOIDCProvider("mock", "", mockoidc.User{
+				Subject: "mock-user",
+				Claims:  map[string]any{"email": "mock-user@example.com"},
+			}),
 		),
 	)
 	os.Exit(suite.Go())
@@ -0,0 +1,119 @@
+package grokratos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	imageEnv  = "GROAT_I9N_KR_IMAGE"
+	imagesEnv = "GROAT_I9N_KR_IMAGES"
+)
+
+type (
+	// imageRun runs the suite against one Kratos image.
+	imageRun func(ctx context.Context, image string) error
+
+	matrix struct {
+		images []string
+		run    imageRun
+		out    io.Writer
+	}
+)
+
+// Matrix runs the test binary once per Kratos image, handing the image over in
+// GROAT_I9N_KR_IMAGE, and reports pass or fail per version. A comma separated
+// GROAT_I9N_KR_IMAGES replaces images, e.g. in CI before an upgrade. It
+// reports false inside those runs, when GROAT_I9N_KR_IMAGE pins one image and
+// when there are no images, so TestMain goes on to bootstrap as usual:
+//
+//	func TestMain(m *testing.M) {
+//		if code, ok := grokratos.Matrix("oryd/kratos:v1.2.0", "oryd/kratos:v1.3.1"); ok {
+//			os.Exit(code)
+//		}
+//		...
+//	}
+//
+// Flags like -run pass through, so selected tests run once per version.
+func Matrix(images ...string) (int, bool) {
+	if os.Getenv(imageEnv) != "" {
+		return 0, false
+	}
+
+	if env := os.Getenv(imagesEnv); env != "" {
+		images = splitImages(env)
+	}
+
+	if len(images) == 0 {
+		return 0, false
+	}
+
+	m := matrix{images: images, run: execImage(os.Args[0], os.Args[1:]...), out: os.Stdout}
+
+	return m.Go(context.Background()), true
+}
+
+func (m matrix) Go(ctx context.Context) int {
+	failed := make([]error, len(m.images))
+	elapsed := make([]time.Duration, len(m.images))
+
+	for i, image := range m.images {
+		_, _ = fmt.Fprintf(m.out, "=== GROAT kratos %s\n", image)
+
+		started := time.Now()
+		failed[i] = m.run(ctx, image)
+		elapsed[i] = time.Since(started)
+	}
+
+	_, _ = fmt.Fprintln(m.out, "=== GROAT kratos matrix")
+
+	code := 0
+
+	for i, image := range m.images {
+		if failed[i] != nil {
+			code = 1
+
+			_, _ = fmt.Fprintf(m.out, "--- FAIL: %s (%.2fs)\n    %v\n", image, elapsed[i].Seconds(), failed[i])
+
+			continue
+		}
+
+		_, _ = fmt.Fprintf(m.out, "--- PASS: %s (%.2fs)\n", image, elapsed[i].Seconds())
+	}
+
+	return code
+}
+
+// execImage runs binary with args and GROAT_I9N_KR_IMAGE set, sharing the
+// output of the current process.
+func execImage(binary string, args ...string) imageRun {
+	return func(ctx context.Context, image string) error {
+		cmd := exec.CommandContext(ctx, binary, args...)
+		cmd.Env = append(os.Environ(), imageEnv+"="+image)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("suite failed against %s: %w", image, err)
+		}
+
+		return nil
+	}
+}
+
+func splitImages(env string) []string {
+	res := make([]string, 0)
+
+	for _, image := range strings.Split(env, ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			res = append(res, image)
+		}
+	}
+
+	return res
+}
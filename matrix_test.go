@@ -0,0 +1,195 @@
+package grokratos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/internal/kratostest"
+	"github.com/godepo/grokratos/pkg/kratosversion"
+	"github.com/godepo/grokratos/pkg/selfservice"
+)
+
+func TestMatrix(t *testing.T) {
+	t.Run("should be able to run suite per image", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		ran := make([]string, 0)
+
+		code := matrix{
+			images: []string{"oryd/kratos:v1.2.0", "oryd/kratos:v1.3.1"},
+			run: func(_ context.Context, image string) error {
+				ran = append(ran, image)
+
+				return nil
+			},
+			out: out,
+		}.Go(t.Context())
+
+		assert.Equal(t, 0, code)
+		assert.Equal(t, []string{"oryd/kratos:v1.2.0", "oryd/kratos:v1.3.1"}, ran)
+		assert.Contains(t, out.String(), "=== GROAT kratos oryd/kratos:v1.2.0\n")
+		assert.Contains(t, out.String(), "--- PASS: oryd/kratos:v1.3.1")
+	})
+
+	t.Run("should be able to report failed versions", func(t *testing.T) {
+		out := &bytes.Buffer{}
+
+		code := matrix{
+			images: []string{"oryd/kratos:v1.2.0", "oryd/kratos:v1.3.1"},
+			run: func(_ context.Context, image string) error {
+				if image == "oryd/kratos:v1.2.0" {
+					return errors.New("exit status 1")
+				}
+
+				return nil
+			},
+			out: out,
+		}.Go(t.Context())
+
+		assert.Equal(t, 1, code)
+		assert.Contains(t, out.String(), "--- FAIL: oryd/kratos:v1.2.0")
+		assert.Contains(t, out.String(), "    exit status 1\n")
+		assert.Contains(t, out.String(), "--- PASS: oryd/kratos:v1.3.1")
+	})
+
+	t.Run("should be able to step aside", func(t *testing.T) {
+		t.Run("when image is pinned", func(t *testing.T) {
+			t.Setenv(imageEnv, "oryd/kratos:v1.3.1")
+			t.Setenv(imagesEnv, "oryd/kratos:v1.2.0")
+
+			_, ok := Matrix("oryd/kratos:v1.2.0")
+			assert.False(t, ok)
+		})
+
+		t.Run("when there are no images", func(t *testing.T) {
+			t.Setenv(imageEnv, "")
+			t.Setenv(imagesEnv, " , ")
+
+			_, ok := Matrix()
+			assert.False(t, ok)
+		})
+	})
+}
+
+func TestExecImage(t *testing.T) {
+	run := execImage("/bin/sh", "-c", `test "$`+imageEnv+`" = oryd/kratos:v1.3.1`)
+
+	require.NoError(t, run(t.Context(), "oryd/kratos:v1.3.1"))
+	require.ErrorContains(t, run(t.Context(), "oryd/kratos:v1.2.0"), "suite failed against oryd/kratos:v1.2.0")
+}
+
+func TestSplitImages(t *testing.T) {
+	assert.Equal(t, []string{"oryd/kratos:v1.2.0", "oryd/kratos:v1.3.1"},
+		splitImages(" oryd/kratos:v1.2.0,, oryd/kratos:v1.3.1 "))
+}
+
+func TestKratos_RequireVersion(t *testing.T) {
+	skipped := func(t *testing.T, k *Kratos, minimum string) bool {
+		t.Helper()
+
+		res := false
+
+		t.Run(minimum, func(t *testing.T) {
+			defer func() { res = t.Skipped() }()
+
+			k.RequireVersion(t, minimum)
+		})
+
+		return res
+	}
+
+	older := &Kratos{Image: "oryd/kratos:v1.2.0", Version: kratosversion.MustParse("v1.2.0")}
+
+	assert.False(t, skipped(t, older, "v1.2.0"))
+	assert.True(t, skipped(t, older, "v1.3.0"))
+	assert.False(t, skipped(t, &Kratos{Image: "oryd/kratos:latest"}, "v9.0.0"))
+}
+
+func TestKratos_Require(t *testing.T) {
+	skipped := func(t *testing.T, k *Kratos, c kratosversion.Capability) bool {
+		t.Helper()
+
+		res := false
+
+		t.Run(string(c), func(t *testing.T) {
+			defer func() { res = t.Skipped() }()
+
+			k.Require(t, c)
+		})
+
+		return res
+	}
+
+	older := &Kratos{Version: kratosversion.MustParse("v1.0.0")}
+
+	assert.True(t, older.Supports(kratosversion.AdminSessions))
+	assert.False(t, skipped(t, older, kratosversion.AdminSessions))
+	assert.True(t, skipped(t, older, kratosversion.Passkeys))
+	assert.True(t, skipped(t, older, "sms"))
+	assert.False(t, skipped(t, &Kratos{}, kratosversion.CodeMethod))
+}
+
+func TestKratos_CapabilityGates(t *testing.T) {
+	skipped := func(t *testing.T, name string, call func(t *testing.T)) bool {
+		t.Helper()
+
+		res := false
+
+		t.Run(name, func(t *testing.T) {
+			defer func() { res = t.Skipped() }()
+
+			call(t)
+		})
+
+		return res
+	}
+
+	helpers := map[string]func(t *testing.T, k *Kratos){
+		"extend session": func(t *testing.T, k *Kratos) {
+			_, _ = k.ExtendSession(t, "session-id")
+		},
+		"admin recovery": func(t *testing.T, k *Kratos) {
+			_, _ = k.AdminRecover(t, selfservice.AdminRecovery{IdentityID: "identity-id"})
+		},
+		"code registration": func(t *testing.T, k *Kratos) {
+			_, _ = k.Register(t, selfservice.Registration{Method: selfservice.MethodCode})
+		},
+		"passkey registration": func(t *testing.T, k *Kratos) {
+			browser, err := k.Browser()
+			require.NoError(t, err)
+
+			_, _ = k.RegisterInBrowser(t, browser, selfservice.Registration{Method: selfservice.MethodPasskey})
+		},
+	}
+
+	t.Run("should be able to skip helpers older releases lack", func(t *testing.T) {
+		older := &Kratos{Version: kratosversion.MustParse("v0.10.0"), Front: kratostest.Client("127.0.0.1:1")}
+
+		for name, call := range helpers {
+			assert.True(t, skipped(t, name, func(t *testing.T) { call(t, older) }), name)
+		}
+	})
+
+	t.Run("should be able to call helpers on releases shipping them", func(t *testing.T) {
+		_, api := kratostest.Serve(t, http.NotFoundHandler())
+		current := &Kratos{Version: kratosversion.MustParse("v1.3.1"), Admin: api, Front: api}
+
+		for name, call := range helpers {
+			assert.False(t, skipped(t, name, func(t *testing.T) { call(t, current) }), name)
+		}
+	})
+
+	t.Run("should be able to register with password on any release", func(t *testing.T) {
+		older := &Kratos{Version: kratosversion.MustParse("v0.10.0"), Front: kratostest.Client("127.0.0.1:1")}
+
+		assert.False(t, skipped(t, "password", func(t *testing.T) {
+			_, err := older.Register(t, selfservice.Registration{})
+			require.Error(t, err)
+		}))
+	})
+}
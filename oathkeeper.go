@@ -0,0 +1,64 @@
+package grokratos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/godepo/groat/pkg/ctxgroup"
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/internal/containersync"
+	tcoathkeeper "github.com/godepo/grokratos/pkg/tc-oathkeeper"
+)
+
+type (
+	// OathkeeperURL is the base url of the Oathkeeper proxy, injected under "<label>.url.oathkeeper".
+	OathkeeperURL string
+
+	OathkeeperContainer interface {
+		ProxyConnectionString(ctx context.Context) string
+		APIConnectionString(ctx context.Context) string
+		Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error
+	}
+
+	oathkeeperRunner func(ctx context.Context, opts ...tcoathkeeper.Option) (OathkeeperContainer, error)
+)
+
+func runOathkeeper(ctx context.Context, opts ...tcoathkeeper.Option) (OathkeeperContainer, error) {
+	return tcoathkeeper.Run(ctx, opts...)
+}
+
+// startOathkeeper runs Oathkeeper next to kratos: on the shared network when
+// there is one, otherwise reaching the Kratos host port through the host.
+func startOathkeeper(ctx context.Context, cfg config, kratos KratosContainer) (OathkeeperContainer, error) {
+	var opts []tcoathkeeper.Option
+
+	if nc, ok := kratos.(networkedContainer); ok && cfg.network != "" {
+		opts = append(opts,
+			tcoathkeeper.WithNetwork(cfg.network),
+			tcoathkeeper.WithKratosURL(apiScheme+"://"+nc.InternalPublicConnectionString(ctx)),
+		)
+	} else {
+		kratosURL, port, err := viaHost(kratos.PublicConnectionString(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("oathkeeper: kratos public port: %w", err)
+		}
+
+		opts = append(opts, tcoathkeeper.WithHostAccessPorts(port), tcoathkeeper.WithKratosURL(kratosURL))
+	}
+
+	oathkeeper, err := cfg.oathkeeperRunner(ctx, append(opts, cfg.oathkeeperOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("oathkeeper container failed to run: %w", err)
+	}
+
+	ctxgroup.IncAt(ctx)
+
+	go containersync.Terminator(ctx, oathkeeper.Terminate)()
+
+	return oathkeeper, nil
+}
+
+func (u OathkeeperURL) String() string {
+	return string(u)
+}
@@ -0,0 +1,135 @@
+package grokratos
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+
+	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+	tcoathkeeper "github.com/godepo/grokratos/pkg/tc-oathkeeper"
+)
+
+type stubOathkeeper struct{}
+
+func (stubOathkeeper) ProxyConnectionString(context.Context) string {
+	return "127.0.0.1:4455"
+}
+
+func (stubOathkeeper) APIConnectionString(context.Context) string {
+	return "127.0.0.1:4456"
+}
+
+func (stubOathkeeper) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return nil
+}
+
+// capture runs tcoathkeeper with a fake container and records its request.
+func capture(req *testcontainers.GenericContainerRequest) oathkeeperRunner {
+	return func(ctx context.Context, opts ...tcoathkeeper.Option) (OathkeeperContainer, error) {
+		_, err := tcoathkeeper.Run(ctx, append(opts, tcoathkeeper.WithContainerConstructor(func(
+			_ context.Context, got testcontainers.GenericContainerRequest,
+		) (testcontainers.Container, error) {
+			*req = got
+
+			return nil, nil
+		}))...)
+		if err != nil {
+			return nil, err
+		}
+
+		return stubOathkeeper{}, nil
+	}
+}
+
+func TestStartOathkeeper(t *testing.T) {
+	t.Run("should be able to reach kratos through host port", func(t *testing.T) {
+		var (
+			cfg config
+			req testcontainers.GenericContainerRequest
+		)
+
+		WithOathkeeper(tcoathkeeper.WithImage("oryd/oathkeeper:latest"))(&cfg)
+		cfg.oathkeeperRunner = capture(&req)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		_, err := startOathkeeper(ctx, cfg, stubContainer{admin: "localhost:4433"})
+		require.NoError(t, err)
+		assert.Equal(t, "oryd/oathkeeper:latest", req.Image)
+		assert.Equal(t, []int{4433}, req.HostAccessPorts)
+		assert.Empty(t, req.Networks)
+	})
+
+	t.Run("should be able to reach kratos on network", func(t *testing.T) {
+		var (
+			cfg config
+			req testcontainers.GenericContainerRequest
+		)
+
+		WithNetwork("sut")(&cfg)
+		WithOathkeeper()(&cfg)
+		cfg.oathkeeperRunner = capture(&req)
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		_, err := startOathkeeper(ctx, cfg, networkedStub{stubContainer{admin: "localhost:4433"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sut"}, req.Networks)
+		assert.Empty(t, req.HostAccessPorts)
+	})
+
+	t.Run("should be able to inject proxy url", func(t *testing.T) {
+		container := newContainer[injectDeps](t.Context(), stubContainer{admin: "127.0.0.1:4434"}, config{
+			injectLabel:      "kr",
+			frontInjectLabel: "kr.front",
+		})
+		container.oathkeeper = stubOathkeeper{}
+
+		deps := container.Injector(t, injectDeps{})
+		assert.Equal(t, OathkeeperURL("http://127.0.0.1:4455"), deps.Oathkeeper)
+		assert.Equal(t, deps.Oathkeeper, deps.Kratos.OathkeeperURL)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when kratos public url has no port", func(t *testing.T) {
+			var cfg config
+			WithOathkeeper()(&cfg)
+
+			_, err := startOathkeeper(t.Context(), cfg, stubContainer{admin: "localhost"})
+			require.ErrorContains(t, err, "kratos public port")
+		})
+
+		t.Run("when kratos public port is not a number", func(t *testing.T) {
+			var cfg config
+			WithOathkeeper()(&cfg)
+
+			_, err := startOathkeeper(t.Context(), cfg, stubContainer{admin: "localhost:http"})
+			require.ErrorContains(t, err, "kratos public port")
+		})
+
+		t.Run("when container cant run", func(t *testing.T) {
+			exp := errors.New("unexpected error")
+
+			var cfg config
+			WithOathkeeper()(&cfg)
+			cfg.runner = func(context.Context, ...tckratos.Option) (KratosContainer, error) {
+				return stubContainer{admin: "127.0.0.1:4433"}, nil
+			}
+			cfg.oathkeeperRunner = func(context.Context, ...tcoathkeeper.Option) (OathkeeperContainer, error) {
+				return nil, exp
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			_, err := bootstrapper[Deps](cfg)(ctx)
+			require.ErrorIs(t, err, exp)
+		})
+	})
+}
@@ -0,0 +1,92 @@
+package courier
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+var (
+	//go:embed etc/sms.jsonnet
+	smsBody []byte
+
+	//go:embed etc/email.jsonnet
+	emailBody []byte
+
+	//go:embed etc/phone.schema.json
+	PhoneSchema []byte
+)
+
+// SMSPatch routes the sms courier channel into the outbox.
+func (o *Outbox) SMSPatch() kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		err := cfg.Append("courier.channels", map[string]any{
+			"id":   "sms",
+			"type": "http",
+			"request_config": map[string]any{
+				"url":     o.URL() + "/sms",
+				"method":  "POST",
+				"body":    base64URL(smsBody),
+				"headers": map[string]any{"Content-Type": "application/json"},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register sms channel: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// EmailPatch delivers emails over http into the outbox instead of SMTP.
+func (o *Outbox) EmailPatch() kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		for path, val := range map[string]any{
+			"courier.delivery_strategy": "http",
+			"courier.http.request_config": map[string]any{
+				"url":     o.URL() + "/email",
+				"method":  "POST",
+				"body":    base64URL(emailBody),
+				"headers": map[string]any{"Content-Type": "application/json"},
+			},
+		} {
+			if err := cfg.Set(path, val); err != nil {
+				return fmt.Errorf("failed to register email delivery: %w", err)
+			}
+		}
+
+		return nil
+	}
+}
+
+// PhoneSchemaPatch registers PhoneSchema as the default "phone" schema and
+// enables passwordless sign-in with codes.
+func PhoneSchemaPatch() kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		err := cfg.Append("identity.schemas", map[string]any{
+			"id":  "phone",
+			"url": base64URL(PhoneSchema),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register phone schema: %w", err)
+		}
+
+		for path, val := range map[string]any{
+			"identity.default_schema_id":                    "phone",
+			"selfservice.methods.code.enabled":              true,
+			"selfservice.methods.code.passwordless_enabled": true,
+		} {
+			if err := cfg.Set(path, val); err != nil {
+				return fmt.Errorf("failed to enable code method: %w", err)
+			}
+		}
+
+		return nil
+	}
+}
+
+func base64URL(raw []byte) string {
+	return "base64://" + base64.StdEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,58 @@
+package courier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+func TestOutbox_SMSPatch(t *testing.T) {
+	box := newOutbox(t)
+
+	cfg := kratosconf.New()
+	require.NoError(t, cfg.Apply(box.SMSPatch()))
+
+	channels, ok := cfg.Get("courier.channels")
+	require.True(t, ok)
+
+	channel := channels.([]any)[0].(map[string]any)
+	assert.Equal(t, "sms", channel["id"])
+	assert.Equal(t, box.URL()+"/sms", channel["request_config"].(map[string]any)["url"])
+
+	require.NoError(t, cfg.Set("courier", "broken"))
+	require.ErrorIs(t, box.SMSPatch()(cfg), kratosconf.ErrNotObject)
+}
+
+func TestOutbox_EmailPatch(t *testing.T) {
+	box := newOutbox(t)
+
+	cfg := kratosconf.New()
+	require.NoError(t, cfg.Apply(box.EmailPatch()))
+
+	strategy, _ := cfg.Get("courier.delivery_strategy")
+	assert.Equal(t, "http", strategy)
+
+	url, _ := cfg.Get("courier.http.request_config.url")
+	assert.Equal(t, box.URL()+"/email", url)
+
+	require.NoError(t, cfg.Set("courier", "broken"))
+	require.ErrorIs(t, box.EmailPatch()(cfg), kratosconf.ErrNotObject)
+}
+
+func TestPhoneSchemaPatch(t *testing.T) {
+	cfg, err := kratosconf.Load("../tc-kratos/etc/kratos.yaml")
+	require.NoError(t, err)
+	require.NoError(t, cfg.Apply(PhoneSchemaPatch()))
+
+	schemas, _ := cfg.Get("identity.schemas")
+	assert.Len(t, schemas, 2)
+
+	def, _ := cfg.Get("identity.default_schema_id")
+	assert.Equal(t, "phone", def)
+
+	require.NoError(t, cfg.Set("identity", "broken"))
+	require.ErrorIs(t, PhoneSchemaPatch()(cfg), kratosconf.ErrNotObject)
+}
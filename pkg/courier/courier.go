@@ -0,0 +1,232 @@
+package courier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godepo/grokratos/internal/hostserver"
+)
+
+var (
+	ErrNoCode = errors.New("message does not contain a code")
+	ErrNoLink = errors.New("message does not contain a link")
+)
+
+const (
+	pollInterval = 50 * time.Millisecond
+)
+
+var (
+	codePattern = regexp.MustCompile(`\b\d{6}\b`)
+	linkPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+)
+
+type (
+	Message struct {
+		Channel      string         `json:"channel"`
+		Recipient    string         `json:"recipient"`
+		Subject      string         `json:"subject"`
+		Body         string         `json:"body"`
+		TemplateType string         `json:"template_type"`
+		TemplateData map[string]any `json:"template_data"`
+		ReceivedAt   time.Time      `json:"-"`
+	}
+
+	Option func(*Outbox)
+
+	// Outbox receives messages Kratos hands to its http courier channels.
+	Outbox struct {
+		listenerConstructor hostserver.ListenerConstructor
+		server              *hostserver.Server
+
+		mu       sync.Mutex
+		messages []Message
+		consumed []bool
+	}
+)
+
+func WithListenerConstructor(fn hostserver.ListenerConstructor) Option {
+	return func(o *Outbox) {
+		o.listenerConstructor = fn
+	}
+}
+
+func New(opts ...Option) (*Outbox, error) {
+	box := &Outbox{
+		listenerConstructor: net.Listen,
+	}
+
+	for _, op := range opts {
+		op(box)
+	}
+
+	srv, err := hostserver.Start(box.Handler(), box.listenerConstructor)
+	if err != nil {
+		return nil, fmt.Errorf("courier outbox: %w", err)
+	}
+
+	box.server = srv
+
+	return box, nil
+}
+
+func (o *Outbox) Port() int {
+	return o.server.Port()
+}
+
+// URL is the outbox address as seen from inside the Kratos container.
+func (o *Outbox) URL() string {
+	return o.server.URL()
+}
+
+func (o *Outbox) Close() error {
+	if err := o.server.Close(); err != nil {
+		return fmt.Errorf("courier outbox: %w", err)
+	}
+
+	return nil
+}
+
+func (o *Outbox) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{channel}", o.receive)
+
+	return mux
+}
+
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
+
+// WaitFor returns the oldest message to recipient not returned before.
+func (o *Outbox) WaitFor(ctx context.Context, recipient string) (Message, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if msg, ok := o.take(recipient); ok {
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return Message{}, fmt.Errorf("no message to %s: %w", recipient, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Outbox) WaitForCode(ctx context.Context, recipient string) (string, error) {
+	msg, err := o.WaitFor(ctx, recipient)
+	if err != nil {
+		return "", err
+	}
+
+	return msg.Code()
+}
+
+func (o *Outbox) WaitForLink(ctx context.Context, recipient string) (string, error) {
+	msg, err := o.WaitFor(ctx, recipient)
+	if err != nil {
+		return "", err
+	}
+
+	return msg.Link()
+}
+
+// CodeFor returns a source of codes sent to recipient, as used by selfservice
+// helpers.
+func (o *Outbox) CodeFor(recipient string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		return o.WaitForCode(ctx, recipient)
+	}
+}
+
+// LinkFor returns a source of links sent to recipient, as used by selfservice
+// helpers.
+func (o *Outbox) LinkFor(recipient string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		return o.WaitForLink(ctx, recipient)
+	}
+}
+
+func (o *Outbox) receive(w http.ResponseWriter, r *http.Request) {
+	var msg Message
+
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if msg.Channel == "" {
+		msg.Channel = r.PathValue("channel")
+	}
+
+	msg.ReceivedAt = time.Now()
+
+	o.mu.Lock()
+	o.messages = append(o.messages, msg)
+	o.consumed = append(o.consumed, false)
+	o.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (o *Outbox) take(recipient string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, msg := range o.messages {
+		if !o.consumed[i] && msg.Recipient == recipient {
+			o.consumed[i] = true
+
+			return msg, true
+		}
+	}
+
+	return Message{}, false
+}
+
+// Code extracts the one-time code from template data, falling back to the
+// first six digit number in the body.
+func (m Message) Code() (string, error) {
+	for key, val := range m.TemplateData {
+		if code, ok := val.(string); ok && strings.HasSuffix(key, "_code") && code != "" {
+			return code, nil
+		}
+	}
+
+	if code := codePattern.FindString(m.Body); code != "" {
+		return code, nil
+	}
+
+	return "", ErrNoCode
+}
+
+// Link extracts the recovery or verification link from template data, falling
+// back to the first url in the body.
+func (m Message) Link() (string, error) {
+	for key, val := range m.TemplateData {
+		if link, ok := val.(string); ok && strings.HasSuffix(key, "_url") && link != "" {
+			return link, nil
+		}
+	}
+
+	if link := linkPattern.FindString(m.Body); link != "" {
+		return link, nil
+	}
+
+	return "", ErrNoLink
+}
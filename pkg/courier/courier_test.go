@@ -0,0 +1,147 @@
+package courier
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOutbox(t *testing.T) *Outbox {
+	t.Helper()
+
+	box, err := New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = box.Close()
+	})
+
+	return box
+}
+
+func deliver(t *testing.T, box *Outbox, channel, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost,
+		box.server.LocalURL()+"/"+channel, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	_ = resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("should be able to hand out messages once in order", func(t *testing.T) {
+		box := newOutbox(t)
+
+		require.Equal(t, http.StatusOK, deliver(t, box, "sms",
+			`{"recipient":"+15550001","body":"first 111111","template_data":{"login_code":"222222"}}`))
+		require.Equal(t, http.StatusOK, deliver(t, box, "sms", `{"recipient":"+15550001","body":"second 333333"}`))
+
+		code, err := box.WaitForCode(t.Context(), "+15550001")
+		require.NoError(t, err)
+		assert.Equal(t, "222222", code)
+
+		code, err = box.WaitForCode(t.Context(), "+15550001")
+		require.NoError(t, err)
+		assert.Equal(t, "333333", code)
+
+		msgs := box.Messages()
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "sms", msgs[0].Channel)
+	})
+
+	t.Run("should be able to wait for late message", func(t *testing.T) {
+		box := newOutbox(t)
+
+		go func() {
+			time.Sleep(pollInterval * 2)
+			deliver(t, box, "sms", `{"recipient":"+15550002","body":"your code is 444444"}`)
+		}()
+
+		msg, err := box.WaitFor(t.Context(), "+15550002")
+		require.NoError(t, err)
+		assert.Equal(t, "your code is 444444", msg.Body)
+	})
+
+	t.Run("should be able to hand out links and codes by recipient", func(t *testing.T) {
+		box := newOutbox(t)
+
+		require.Equal(t, http.StatusOK, deliver(t, box, "email", `{"recipient":"first@example.com",`+
+			`"template_data":{"recovery_url":"http://localhost:4433/self-service/recovery?token=abc"}}`))
+		require.Equal(t, http.StatusOK, deliver(t, box, "email", `{"recipient":"first@example.com",`+
+			`"body":"open http://localhost:4433/verify?token=def to verify"}`))
+		require.Equal(t, http.StatusOK, deliver(t, box, "email", `{"recipient":"first@example.com",`+
+			`"template_data":{"verification_code":"555555"}}`))
+
+		link, err := box.LinkFor("first@example.com")(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:4433/self-service/recovery?token=abc", link)
+
+		link, err = box.WaitForLink(t.Context(), "first@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "http://localhost:4433/verify?token=def", link)
+
+		code, err := box.CodeFor("first@example.com")(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "555555", code)
+		assert.Equal(t, "email", box.Messages()[0].Channel)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when message has no link", func(t *testing.T) {
+			_, err := Message{Body: "hello"}.Link()
+			require.ErrorIs(t, err, ErrNoLink)
+		})
+
+		t.Run("when no link arrives", func(t *testing.T) {
+			box := newOutbox(t)
+
+			ctx, cancel := context.WithTimeout(t.Context(), pollInterval)
+			defer cancel()
+
+			_, err := box.WaitForLink(ctx, "first@example.com")
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+
+		t.Run("when body is not json", func(t *testing.T) {
+			box := newOutbox(t)
+			assert.Equal(t, http.StatusBadRequest, deliver(t, box, "sms", "not json"))
+		})
+
+		t.Run("when nothing arrives", func(t *testing.T) {
+			box := newOutbox(t)
+
+			ctx, cancel := context.WithTimeout(t.Context(), pollInterval)
+			defer cancel()
+
+			_, err := box.WaitForCode(ctx, "+15550003")
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+
+		t.Run("when message has no code", func(t *testing.T) {
+			_, err := Message{Body: "hello"}.Code()
+			require.ErrorIs(t, err, ErrNoCode)
+		})
+
+		t.Run("when cant listen", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := New(WithListenerConstructor(func(string, string) (net.Listener, error) {
+				return nil, expErr
+			}))
+			require.ErrorIs(t, err, expErr)
+		})
+	})
+}
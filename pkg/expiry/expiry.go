@@ -0,0 +1,88 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+var ErrNoExpiry = errors.New("kratos did not report an expiry time")
+
+// Skew is added to every wait to cover clock drift between the test process
+// and the container and the rounding Kratos applies to timestamps.
+const Skew = 500 * time.Millisecond
+
+// Flows lists self-service flows with a configurable lifespan.
+var Flows = []string{"login", "registration", "recovery", "verification", "settings"}
+
+// Lifespans shortens the session lifespan and the lifespan of every flow, so
+// expiry can be tested in seconds instead of hours.
+func Lifespans(session, flow time.Duration) kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		if session > 0 {
+			if err := cfg.Set("session.lifespan", session.String()); err != nil {
+				return fmt.Errorf("failed to set session lifespan: %w", err)
+			}
+		}
+
+		if flow <= 0 {
+			return nil
+		}
+
+		for _, name := range Flows {
+			if err := cfg.Set("selfservice.flows."+name+".lifespan", flow.String()); err != nil {
+				return fmt.Errorf("failed to set %s lifespan: %w", name, err)
+			}
+		}
+
+		return nil
+	}
+}
+
+// EarliestExtend lets sessions be extended once they are within window of
+// expiring. The shipped 1h against a 24h lifespan makes extension a no-op in
+// tests, a window as long as the lifespan allows it at any time.
+func EarliestExtend(window time.Duration) kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		if err := cfg.Set("session.earliest_possible_extend", window.String()); err != nil {
+			return fmt.Errorf("failed to set earliest possible extend: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// Wait blocks until deadline plus Skew has passed.
+func Wait(ctx context.Context, deadline time.Time) error {
+	timer := time.NewTimer(time.Until(deadline.Add(Skew)))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("expiry wait: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+func WaitSession(ctx context.Context, session *client.Session) error {
+	if session == nil || session.ExpiresAt == nil {
+		return ErrNoExpiry
+	}
+
+	return Wait(ctx, *session.ExpiresAt)
+}
+
+// WaitFlow waits for any flow, e.g. *client.LoginFlow, to expire.
+func WaitFlow(ctx context.Context, flow interface{ GetExpiresAt() time.Time }) error {
+	if flow == nil || flow.GetExpiresAt().IsZero() {
+		return ErrNoExpiry
+	}
+
+	return Wait(ctx, flow.GetExpiresAt())
+}
@@ -0,0 +1,103 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+func TestLifespans(t *testing.T) {
+	t.Run("should be able to shorten session and flows", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Apply(Lifespans(2*time.Second, time.Second)))
+
+		got, ok := cfg.Get("session.lifespan")
+		require.True(t, ok)
+		assert.Equal(t, "2s", got)
+
+		for _, name := range Flows {
+			got, ok := cfg.Get("selfservice.flows." + name + ".lifespan")
+			require.True(t, ok, name)
+			assert.Equal(t, "1s", got)
+		}
+	})
+
+	t.Run("should be able to keep zero lifespans untouched", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Apply(Lifespans(0, 0)))
+
+		_, ok := cfg.Get("session.lifespan")
+		assert.False(t, ok)
+
+		_, ok = cfg.Get("selfservice.flows.login.lifespan")
+		assert.False(t, ok)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when path is not an object", func(t *testing.T) {
+			cfg := kratosconf.New()
+			require.NoError(t, cfg.Set("session", "scalar"))
+			require.Error(t, cfg.Apply(Lifespans(time.Second, 0)))
+
+			cfg = kratosconf.New()
+			require.NoError(t, cfg.Set("selfservice", "scalar"))
+			require.Error(t, cfg.Apply(Lifespans(0, time.Second)))
+		})
+	})
+}
+
+func TestEarliestExtend(t *testing.T) {
+	t.Run("should be able to widen extension window", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Apply(EarliestExtend(24*time.Hour)))
+
+		got, ok := cfg.Get("session.earliest_possible_extend")
+		require.True(t, ok)
+		assert.Equal(t, "24h0m0s", got)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when path is not an object", func(t *testing.T) {
+			cfg := kratosconf.New()
+			require.NoError(t, cfg.Set("session", "scalar"))
+			require.Error(t, cfg.Apply(EarliestExtend(time.Hour)))
+		})
+	})
+}
+
+func TestWait(t *testing.T) {
+	t.Run("should be able to wait past deadline", func(t *testing.T) {
+		deadline := time.Now().Add(50 * time.Millisecond)
+
+		require.NoError(t, Wait(t.Context(), deadline))
+		assert.True(t, time.Now().After(deadline.Add(Skew)))
+	})
+
+	t.Run("should be able to wait for session and flow", func(t *testing.T) {
+		past := time.Now().Add(-Skew)
+
+		require.NoError(t, WaitSession(t.Context(), &client.Session{ExpiresAt: &past}))
+		require.NoError(t, WaitFlow(t.Context(), &client.LoginFlow{ExpiresAt: past}))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when context is done", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+
+			require.ErrorIs(t, Wait(ctx, time.Now().Add(time.Hour)), context.Canceled)
+		})
+
+		t.Run("when expiry is unknown", func(t *testing.T) {
+			require.ErrorIs(t, WaitSession(t.Context(), &client.Session{}), ErrNoExpiry)
+			require.ErrorIs(t, WaitSession(t.Context(), nil), ErrNoExpiry)
+			require.ErrorIs(t, WaitFlow(t.Context(), &client.LoginFlow{}), ErrNoExpiry)
+		})
+	})
+}
@@ -0,0 +1,279 @@
+package fixtures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrImportFailed = errors.New("failed to import fixture")
+	ErrNotImported  = errors.New("fixture was not imported")
+)
+
+const (
+	batchSize = 1000
+
+	addressVerified = "completed"
+	addressPending  = "pending"
+	addressViaEmail = "email"
+)
+
+type (
+	// Identity is a fixture entry. HashedPassword takes a hash in any format
+	// Kratos can import, Password a cleartext one hashed by Kratos. Verifiable
+	// addresses override the verification state of addresses from traits.
+	Identity struct {
+		SchemaID            string         `yaml:"schema_id"`
+		State               string         `yaml:"state"`
+		Traits              map[string]any `yaml:"traits"`
+		Password            string         `yaml:"password"`
+		HashedPassword      string         `yaml:"hashed_password"`
+		MetadataPublic      any            `yaml:"metadata_public"`
+		MetadataAdmin       any            `yaml:"metadata_admin"`
+		VerifiableAddresses []Address      `yaml:"verifiable_addresses"`
+	}
+
+	Address struct {
+		Value    string `yaml:"value"`
+		Via      string `yaml:"via"`
+		Verified bool   `yaml:"verified"`
+	}
+
+	// Fixture is an imported identity together with its cleartext password,
+	// when the fixture declared one.
+	Fixture struct {
+		*client.Identity
+
+		Key      string
+		Password string
+
+		imported string
+	}
+
+	Set struct {
+		declared map[string]Identity
+		imported map[string]Fixture
+	}
+
+	file struct {
+		Identities map[string]Identity `yaml:"identities"`
+	}
+)
+
+// Load reads fixtures from a YAML or JSON file.
+func Load(path string) (*Set, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	return Parse(raw)
+}
+
+func Parse(raw []byte) (*Set, error) {
+	var doc file
+
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+
+	return &Set{
+		declared: doc.Identities,
+		imported: make(map[string]Fixture, len(doc.Identities)),
+	}, nil
+}
+
+func (s *Set) Keys() []string {
+	keys := make([]string, 0, len(s.declared))
+
+	for key := range s.declared {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Get returns the imported fixture, failing t for keys that were not
+// imported. Use Lookup for optional ones.
+func (s *Set) Get(t testing.TB, key string) Fixture {
+	t.Helper()
+
+	fixture, ok := s.Lookup(key)
+	if !ok {
+		t.Fatalf("fixture %q was not imported, have %v", key, slices.Sorted(maps.Keys(s.imported)))
+	}
+
+	return fixture
+}
+
+func (s *Set) Lookup(key string) (Fixture, bool) {
+	fixture, ok := s.imported[key]
+
+	return fixture, ok
+}
+
+// Import creates the declared identities through the admin batch API.
+func (s *Set) Import(ctx context.Context, admin *client.APIClient) error {
+	keys := s.Keys()
+
+	for chunk := range slices.Chunk(keys, batchSize) {
+		if err := s.importChunk(ctx, admin, chunk); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		if err := s.fetch(ctx, admin, key, s.imported[key].Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rebind points fixtures at identities recreated under new ids. current maps
+// the id a fixture was imported with to its id now, e.g. snapshot.Snapshot.ID.
+func (s *Set) Rebind(ctx context.Context, admin *client.APIClient, current func(imported string) string) error {
+	for _, key := range s.Keys() {
+		fixture, ok := s.imported[key]
+		if !ok {
+			continue
+		}
+
+		if id := current(fixture.imported); id != fixture.Id {
+			if err := s.fetch(ctx, admin, key, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Set) fetch(ctx context.Context, admin *client.APIClient, key, id string) error {
+	identity, resp, err := admin.IdentityAPI.GetIdentity(ctx, id).Execute()
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get fixture %s: %w", key, err)
+	}
+
+	fixture := s.imported[key]
+	fixture.Identity = identity
+	s.imported[key] = fixture
+
+	return nil
+}
+
+func (s *Set) importChunk(ctx context.Context, admin *client.APIClient, keys []string) error {
+	patches := make([]client.IdentityPatch, 0, len(keys))
+	byPatch := make(map[string]string, len(keys))
+
+	for _, key := range keys {
+		patchID := uuid.NewString()
+		byPatch[patchID] = key
+
+		patches = append(patches, client.IdentityPatch{
+			PatchId: &patchID,
+			Create:  s.declared[key].body(),
+		})
+	}
+
+	resp, raw, err := admin.IdentityAPI.BatchPatchIdentities(ctx).
+		PatchIdentitiesBody(client.PatchIdentitiesBody{Identities: patches}).
+		Execute()
+	if raw != nil {
+		_ = raw.Body.Close()
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to import fixtures: %w", err)
+	}
+
+	for _, res := range resp.Identities {
+		key := byPatch[res.GetPatchId()]
+
+		if res.Error != nil || res.GetIdentity() == "" {
+			return fmt.Errorf("%w %s: %v", ErrImportFailed, key, res.Error)
+		}
+
+		s.imported[key] = Fixture{
+			Identity: &client.Identity{Id: res.GetIdentity()},
+			Key:      key,
+			Password: s.declared[key].Password,
+			imported: res.GetIdentity(),
+		}
+
+		delete(byPatch, res.GetPatchId())
+	}
+
+	for _, key := range byPatch {
+		return fmt.Errorf("%w: %s", ErrNotImported, key)
+	}
+
+	return nil
+}
+
+func (i Identity) body() *client.CreateIdentityBody {
+	body := &client.CreateIdentityBody{
+		SchemaId:       i.SchemaID,
+		Traits:         i.Traits,
+		MetadataPublic: i.MetadataPublic,
+		MetadataAdmin:  i.MetadataAdmin,
+	}
+
+	if body.Traits == nil {
+		body.Traits = map[string]any{}
+	}
+
+	if i.State != "" {
+		body.State = &i.State
+	}
+
+	if i.Password != "" || i.HashedPassword != "" {
+		pass := client.IdentityWithCredentialsPasswordConfig{}
+
+		if i.HashedPassword != "" {
+			pass.HashedPassword = &i.HashedPassword
+		} else {
+			pass.Password = &i.Password
+		}
+
+		body.Credentials = &client.IdentityWithCredentials{
+			Password: &client.IdentityWithCredentialsPassword{Config: &pass},
+		}
+	}
+
+	for _, addr := range i.VerifiableAddresses {
+		status := addressPending
+		if addr.Verified {
+			status = addressVerified
+		}
+
+		body.VerifiableAddresses = append(body.VerifiableAddresses,
+			*client.NewVerifiableIdentityAddress(status, addr.Value, addr.Verified, addr.via()))
+	}
+
+	return body
+}
+
+func (a Address) via() string {
+	if a.Via == "" {
+		return addressViaEmail
+	}
+
+	return a.Via
+}
@@ -0,0 +1,237 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/internal/kratostest"
+)
+
+const seed = `
+identities:
+  admin:
+    schema_id: user
+    traits:
+      email: admin@example.com
+    password: secret
+    metadata_public:
+      role: admin
+    verifiable_addresses:
+      - value: admin@example.com
+        verified: true
+  locked:
+    state: inactive
+    traits:
+      email: locked@example.com
+    hashed_password: "$2a$10$ZsCsoVQ3xfBG/K2z2XpBf.tm90GZmtOqtqWcB5.pYd5Eq8y7RlDyq"
+`
+
+type fakeAdmin struct {
+	created map[string]client.CreateIdentityBody
+	reply   func(patches []client.IdentityPatch) []map[string]any
+}
+
+func newFakeAdmin(t *testing.T) (*fakeAdmin, *client.APIClient) {
+	t.Helper()
+
+	fake := &fakeAdmin{created: map[string]client.CreateIdentityBody{}}
+	fake.reply = fake.create
+
+	mux := http.NewServeMux()
+	_, admin := kratostest.Serve(t, mux)
+
+	mux.HandleFunc("PATCH /admin/identities", func(w http.ResponseWriter, r *http.Request) {
+		var body client.PatchIdentitiesBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		kratostest.WriteJSON(w, http.StatusOK, map[string]any{"identities": fake.reply(body.Identities)})
+	})
+	mux.HandleFunc("GET /admin/identities/{id}", func(w http.ResponseWriter, r *http.Request) {
+		body, ok := fake.created[r.PathValue("id")]
+		if !ok {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		kratostest.WriteJSON(w, http.StatusOK, map[string]any{
+			"id":         r.PathValue("id"),
+			"schema_id":  body.SchemaId,
+			"schema_url": "http://localhost/schema",
+			"traits":     body.Traits,
+			"state":      body.GetState(),
+		})
+	})
+
+	return fake, admin
+}
+
+func (f *fakeAdmin) create(patches []client.IdentityPatch) []map[string]any {
+	res := make([]map[string]any, 0, len(patches))
+
+	for _, patch := range patches {
+		id := uuid.NewString()
+		f.created[id] = *patch.Create
+
+		res = append(res, map[string]any{"action": "create", "identity": id, "patch_id": patch.GetPatchId()})
+	}
+
+	return res
+}
+
+// fatalRecorder keeps what Fatalf was called with instead of stopping the test.
+type fatalRecorder struct {
+	testing.TB
+
+	fatal string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.fatal = fmt.Sprintf(format, args...)
+}
+
+func TestSet(t *testing.T) {
+	t.Run("should be able to import identities", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+
+		set, err := Parse([]byte(seed))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"admin", "locked"}, set.Keys())
+
+		require.NoError(t, set.Import(t.Context(), admin))
+
+		adm := set.Get(t, "admin")
+		require.NotNil(t, adm.Identity)
+		assert.Equal(t, "admin", adm.Key)
+		assert.Equal(t, "secret", adm.Password)
+		assert.Equal(t, "admin@example.com", adm.Traits.(map[string]any)["email"])
+
+		body := fake.created[adm.Id]
+		assert.Equal(t, "user", body.SchemaId)
+		assert.Equal(t, "secret", body.Credentials.Password.Config.GetPassword())
+		require.Len(t, body.VerifiableAddresses, 1)
+		assert.True(t, body.VerifiableAddresses[0].Verified)
+		assert.Equal(t, "completed", body.VerifiableAddresses[0].Status)
+		assert.Equal(t, "email", body.VerifiableAddresses[0].Via)
+
+		locked := set.Get(t, "locked")
+		assert.Equal(t, "inactive", locked.GetState())
+		assert.Empty(t, locked.Password)
+		assert.Contains(t, fake.created[locked.Id].Credentials.Password.Config.GetHashedPassword(), "$2a$10$")
+	})
+
+	t.Run("should be able to follow recreated identities", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+
+		set, err := Parse([]byte(seed))
+		require.NoError(t, err)
+		require.NoError(t, set.Import(t.Context(), admin))
+
+		before := set.Get(t, "admin").Id
+		recreated := uuid.NewString()
+		fake.created[recreated] = fake.created[before]
+
+		require.NoError(t, set.Rebind(t.Context(), admin, func(imported string) string {
+			if imported == before {
+				return recreated
+			}
+
+			return imported
+		}))
+
+		assert.Equal(t, recreated, set.Get(t, "admin").Id)
+		assert.Equal(t, "admin@example.com", set.Get(t, "admin").Traits.(map[string]any)["email"])
+
+		require.Error(t, set.Rebind(t.Context(), admin, func(string) string { return "absent" }))
+	})
+
+	t.Run("should be able to load json file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "fixtures.json")
+		require.NoError(t, os.WriteFile(path,
+			[]byte(`{"identities":{"user":{"traits":{"email":"user@example.com"}}}}`), 0o600))
+
+		set, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user"}, set.Keys())
+	})
+
+	t.Run("should be able to miss unknown key", func(t *testing.T) {
+		set, err := Parse([]byte(seed))
+		require.NoError(t, err)
+
+		_, ok := set.Lookup("admin")
+		assert.False(t, ok)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when file is absent", func(t *testing.T) {
+			_, err := Load(filepath.Join(t.TempDir(), "absent.yaml"))
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+
+		t.Run("when file is malformed", func(t *testing.T) {
+			_, err := Parse([]byte("identities: ["))
+			require.Error(t, err)
+		})
+
+		t.Run("when identity is rejected", func(t *testing.T) {
+			fake, admin := newFakeAdmin(t)
+			fake.reply = func(patches []client.IdentityPatch) []map[string]any {
+				return []map[string]any{{
+					"action":   "error",
+					"patch_id": patches[0].GetPatchId(),
+					"error":    map[string]any{"message": "conflict"},
+				}}
+			}
+
+			set, err := Parse([]byte(seed))
+			require.NoError(t, err)
+			require.ErrorIs(t, set.Import(t.Context(), admin), ErrImportFailed)
+		})
+
+		t.Run("when identity is not reported", func(t *testing.T) {
+			fake, admin := newFakeAdmin(t)
+			fake.reply = func(patches []client.IdentityPatch) []map[string]any {
+				return fake.create(patches[:1])
+			}
+
+			set, err := Parse([]byte(seed))
+			require.NoError(t, err)
+			require.ErrorIs(t, set.Import(t.Context(), admin), ErrNotImported)
+		})
+
+		t.Run("when admin api is unavailable", func(t *testing.T) {
+			set, err := Parse([]byte(seed))
+			require.NoError(t, err)
+			require.Error(t, set.Import(t.Context(), kratostest.Client("127.0.0.1:1")))
+		})
+
+		t.Run("when key was not imported", func(t *testing.T) {
+			_, admin := newFakeAdmin(t)
+
+			set, err := Parse([]byte(seed))
+			require.NoError(t, err)
+			require.NoError(t, set.Import(t.Context(), admin))
+
+			rec := &fatalRecorder{TB: t}
+			assert.Nil(t, set.Get(rec, "typo").Identity)
+			assert.Contains(t, rec.fatal, `"typo"`)
+			assert.Contains(t, rec.fatal, "[admin locked]")
+		})
+	})
+}
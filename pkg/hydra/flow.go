@@ -0,0 +1,209 @@
+package hydra
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+	"github.com/godepo/grokratos/pkg/selfservice"
+)
+
+var (
+	ErrNoLoginChallenge = errors.New("hydra did not request a login")
+	ErrNoCode           = errors.New("hydra did not return an authorization code")
+	ErrNotReturned      = errors.New("kratos did not return to hydra")
+	ErrStateMismatch    = errors.New("hydra returned a different state")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+const (
+	maxRedirects = 20
+	randomBytes  = 32
+)
+
+// PKCE is a code verifier with its S256 challenge.
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+func NewPKCE() PKCE {
+	verifier := randomString()
+	sum := sha256.Sum256([]byte(verifier))
+
+	return PKCE{Verifier: verifier, Challenge: base64.RawURLEncoding.EncodeToString(sum[:])}
+}
+
+// AuthorizationCode runs the authorization code flow with PKCE for the
+// identity signing in to Kratos behind front with the password method, and
+// exchanges the code for tokens. Scopes default to DefaultScopes.
+func (p *Provider) AuthorizationCode(
+	ctx context.Context,
+	front *client.APIClient,
+	identifier, password string,
+	scopes ...string,
+) (*Tokens, error) {
+	cl, err := p.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	browser, err := selfservice.NewBrowser(front)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+
+	walker := &http.Client{
+		Jar: browser.HTTP.Jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	pkce := NewPKCE()
+	state := randomString()
+
+	auth := p.PublicURL() + "/oauth2/auth?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cl.ID},
+		"redirect_uri":          {p.CallbackURL()},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {pkce.Challenge},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	loginAt, err := walk(ctx, walker, auth, func(u *url.URL) bool {
+		return u.Query().Has("login_challenge")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoLoginChallenge, err)
+	}
+
+	verified, err := kratosLogin(ctx, browser, loginAt.Query().Get("login_challenge"), identifier, password)
+	if err != nil {
+		return nil, err
+	}
+
+	callback, err := walk(ctx, walker, verified, func(u *url.URL) bool {
+		return strings.HasPrefix(u.String(), p.CallbackURL())
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoCode, err)
+	}
+
+	if callback.Query().Get("state") != state {
+		return nil, ErrStateMismatch
+	}
+
+	code := callback.Query().Get("code")
+	if code == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoCode, callback.Query().Get("error_description"))
+	}
+
+	return p.Exchange(ctx, cl, code, pkce.Verifier)
+}
+
+// Exchange trades an authorization code for tokens.
+func (p *Provider) Exchange(ctx context.Context, cl *Client, code, verifier string) (*Tokens, error) {
+	var res Tokens
+
+	err := p.do(ctx, http.MethodPost, p.PublicURL()+"/oauth2/token", formBody(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.CallbackURL()},
+		"client_id":     {cl.ID},
+		"code_verifier": {verifier},
+	}), &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	return &res, nil
+}
+
+// kratosLogin completes the Hydra login request through a Kratos browser
+// login flow and returns where Kratos sends the browser back to Hydra.
+func kratosLogin(
+	ctx context.Context, browser *selfservice.Browser, challenge, identifier, password string,
+) (string, error) {
+	flow, resp, err := browser.Public.FrontendAPI.CreateBrowserLoginFlow(ctx).LoginChallenge(challenge).Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to create oauth2 login flow: %w", kratoserr.FromResponse(resp, err))
+	}
+
+	_ = resp.Body.Close()
+
+	method := client.NewUpdateLoginFlowWithPasswordMethod(identifier, "password", password)
+	method.CsrfToken = client.PtrString(selfservice.CSRFToken(flow.Ui))
+
+	_, resp, err = browser.Public.FrontendAPI.UpdateLoginFlow(ctx).Flow(flow.Id).
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{UpdateLoginFlowWithPasswordMethod: method}).
+		Execute()
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err == nil {
+		return "", ErrNotReturned
+	}
+
+	res, ok := kratoserr.Parse(err)
+	if !ok || res.Redirect == "" {
+		return "", fmt.Errorf("%w: %w", ErrNotReturned, kratoserr.FromResponse(resp, err))
+	}
+
+	return res.Redirect, nil
+}
+
+// walk follows redirects from location until stop matches the next location.
+func walk(ctx context.Context, cl *http.Client, location string, stop func(*url.URL) bool) (*url.URL, error) {
+	for range maxRedirects {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build request: %w", err)
+		}
+
+		resp, err := cl.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to follow %s: %w", location, err)
+		}
+
+		raw, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		next, err := resp.Location()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s answered %d %s", ErrUnexpectedStatus, location, resp.StatusCode, raw)
+		}
+
+		if stop(next) {
+			return next, nil
+		}
+
+		location = next.String()
+	}
+
+	return nil, ErrTooManyRedirects
+}
+
+func randomString() string {
+	raw := make([]byte, randomBytes)
+	_, _ = rand.Read(raw)
+
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,335 @@
+package hydra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/godepo/grokratos/internal/hostserver"
+)
+
+var (
+	ErrUnexpectedStatus = errors.New("hydra returned unexpected status")
+	ErrNotConnected     = errors.New("hydra provider is not connected to hydra")
+)
+
+// DefaultScopes are granted to the client registered by Provider.Client.
+var DefaultScopes = []string{"openid", "offline_access", "offline", "email", "profile"}
+
+type (
+	Option func(*Provider)
+
+	// Provider is the login and consent app for Hydra. Logins are delegated
+	// to Kratos, consent is granted for every requested scope.
+	Provider struct {
+		HTTP *http.Client
+
+		listenerConstructor hostserver.ListenerConstructor
+		server              *hostserver.Server
+
+		mu        sync.Mutex
+		publicURL string
+		adminURL  string
+		kratosURL string
+		client    *Client
+	}
+
+	// Client is an OAuth2 client registered in Hydra.
+	Client struct {
+		ID                      string   `json:"client_id,omitempty"`
+		Name                    string   `json:"client_name,omitempty"`
+		GrantTypes              []string `json:"grant_types"`
+		ResponseTypes           []string `json:"response_types"`
+		RedirectURIs            []string `json:"redirect_uris"`
+		Scope                   string   `json:"scope"`
+		TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	}
+
+	Tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+
+	Introspection struct {
+		Active   bool   `json:"active"`
+		Subject  string `json:"sub"`
+		ClientID string `json:"client_id"`
+		Scope    string `json:"scope"`
+	}
+
+	consentRequest struct {
+		RequestedScope    []string `json:"requested_scope"`
+		RequestedAudience []string `json:"requested_access_token_audience"`
+	}
+
+	redirect struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+)
+
+func WithListenerConstructor(fn hostserver.ListenerConstructor) Option {
+	return func(p *Provider) {
+		p.listenerConstructor = fn
+	}
+}
+
+// New starts the login and consent app on a random local port. Hydra only
+// redirects browsers to it, so it is served to the test process.
+func New(opts ...Option) (*Provider, error) {
+	prov := &Provider{
+		HTTP:                http.DefaultClient,
+		listenerConstructor: net.Listen,
+	}
+
+	for _, op := range opts {
+		op(prov)
+	}
+
+	srv, err := hostserver.Start(prov.Handler(), prov.listenerConstructor)
+	if err != nil {
+		return nil, fmt.Errorf("hydra login app: %w", err)
+	}
+
+	prov.server = srv
+
+	return prov, nil
+}
+
+// Connect sets the Hydra public and admin base urls as seen from the test process.
+func (p *Provider) Connect(publicURL, adminURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.publicURL = strings.TrimSuffix(publicURL, "/")
+	p.adminURL = strings.TrimSuffix(adminURL, "/")
+}
+
+// SetKratosURL sets the Kratos public base url the login endpoint sends browsers to.
+func (p *Provider) SetKratosURL(kratosURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.kratosURL = strings.TrimSuffix(kratosURL, "/")
+}
+
+func (p *Provider) PublicURL() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.publicURL
+}
+
+func (p *Provider) AdminURL() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.adminURL
+}
+
+func (p *Provider) LoginURL() string {
+	return p.server.LocalURL() + "/login"
+}
+
+func (p *Provider) ConsentURL() string {
+	return p.server.LocalURL() + "/consent"
+}
+
+// CallbackURL is the redirect uri of the client registered by Client.
+func (p *Provider) CallbackURL() string {
+	return p.server.LocalURL() + "/callback"
+}
+
+func (p *Provider) Close() error {
+	return p.server.Close()
+}
+
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /login", p.login)
+	mux.HandleFunc("GET /consent", p.consent)
+	mux.HandleFunc("GET /callback", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return mux
+}
+
+// Client returns a public PKCE client with DefaultScopes, registering it on
+// first use.
+func (p *Provider) Client(ctx context.Context) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	cl, err := p.createClient(ctx, Client{
+		Name:                    "grokratos",
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code", "id_token"},
+		RedirectURIs:            []string{p.CallbackURL()},
+		Scope:                   strings.Join(DefaultScopes, " "),
+		TokenEndpointAuthMethod: "none",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p.client = cl
+
+	return cl, nil
+}
+
+// CreateClient registers cl in Hydra.
+func (p *Provider) CreateClient(ctx context.Context, cl Client) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.createClient(ctx, cl)
+}
+
+func (p *Provider) createClient(ctx context.Context, cl Client) (*Client, error) {
+	if p.adminURL == "" {
+		return nil, ErrNotConnected
+	}
+
+	var res Client
+
+	if err := p.do(ctx, http.MethodPost, p.adminURL+"/admin/clients", jsonBody(cl), &res); err != nil {
+		return nil, fmt.Errorf("failed to create oauth2 client: %w", err)
+	}
+
+	return &res, nil
+}
+
+// Introspect asks Hydra whether token is active and whom it was issued to.
+func (p *Provider) Introspect(ctx context.Context, token string) (*Introspection, error) {
+	admin := p.AdminURL()
+	if admin == "" {
+		return nil, ErrNotConnected
+	}
+
+	var res Introspection
+
+	err := p.do(ctx, http.MethodPost, admin+"/admin/oauth2/introspect", formBody(url.Values{"token": {token}}), &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+
+	return &res, nil
+}
+
+func (p *Provider) login(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	kratos := p.kratosURL
+	p.mu.Unlock()
+
+	if kratos == "" {
+		http.Error(w, "kratos url is not set", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	target := kratos + "/self-service/login/browser?" +
+		url.Values{"login_challenge": {r.URL.Query().Get("login_challenge")}}.Encode()
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (p *Provider) consent(w http.ResponseWriter, r *http.Request) {
+	admin := p.AdminURL()
+	query := url.Values{"consent_challenge": {r.URL.Query().Get("consent_challenge")}}.Encode()
+
+	var req consentRequest
+
+	err := p.do(r.Context(), http.MethodGet, admin+"/admin/oauth2/auth/requests/consent?"+query, nil, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	var res redirect
+
+	accept := admin + "/admin/oauth2/auth/requests/consent/accept?" + query
+
+	err = p.do(r.Context(), http.MethodPut, accept, jsonBody(map[string]any{
+		"grant_scope":                 req.RequestedScope,
+		"grant_access_token_audience": req.RequestedAudience,
+	}), &res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+
+		return
+	}
+
+	http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+}
+
+type body struct {
+	contentType string
+	raw         []byte
+}
+
+func jsonBody(val any) *body {
+	raw, _ := json.Marshal(val)
+
+	return &body{contentType: "application/json", raw: raw}
+}
+
+func formBody(values url.Values) *body {
+	return &body{contentType: "application/x-www-form-urlencoded", raw: []byte(values.Encode())}
+}
+
+func (p *Provider) do(ctx context.Context, method, target string, in *body, out any) error {
+	var reader io.Reader
+	if in != nil {
+		reader = bytes.NewReader(in.raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", in.contentType)
+	}
+
+	resp, err := p.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call hydra: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read hydra response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %d %s", ErrUnexpectedStatus, resp.StatusCode, raw)
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("failed to decode hydra response: %w", err)
+	}
+
+	return nil
+}
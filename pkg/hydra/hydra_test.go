@@ -0,0 +1,289 @@
+package hydra
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/internal/kratostest"
+)
+
+const (
+	fakeCSRF     = "fake-csrf"
+	fakePassword = "secret"
+	fakeSubject  = "identity-id"
+	// noRedirectPassword signs in without sending the browser back to Hydra.
+	noRedirectPassword = "no-redirect"
+)
+
+// newFakeHydra walks the browser through login, consent and callback
+// redirects, remembering the pending authorization request.
+func newFakeHydra(t *testing.T, prov *Provider) *httptest.Server {
+	t.Helper()
+
+	var (
+		mu      sync.Mutex
+		pending url.Values
+	)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("POST /admin/clients", func(w http.ResponseWriter, r *http.Request) {
+		var cl Client
+		_ = json.NewDecoder(r.Body).Decode(&cl)
+		cl.ID = "client-id"
+		kratostest.WriteJSON(w, http.StatusCreated, cl)
+	})
+	mux.HandleFunc("GET /oauth2/auth", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		query := r.URL.Query()
+
+		switch {
+		case query.Has("login_verifier"):
+			http.Redirect(w, r, prov.ConsentURL()+"?consent_challenge=cc", http.StatusFound)
+		case query.Has("consent_verifier"):
+			http.Redirect(w, r, pending.Get("redirect_uri")+"?"+url.Values{
+				"code":  {"code"},
+				"state": {pending.Get("state")},
+			}.Encode(), http.StatusFound)
+		default:
+			pending = query
+			http.Redirect(w, r, prov.LoginURL()+"?login_challenge=lc", http.StatusFound)
+		}
+	})
+	mux.HandleFunc("GET /admin/oauth2/auth/requests/consent", func(w http.ResponseWriter, _ *http.Request) {
+		kratostest.WriteJSON(w, http.StatusOK, map[string]any{"requested_scope": []string{"openid"}})
+	})
+	mux.HandleFunc("PUT /admin/oauth2/auth/requests/consent/accept", func(w http.ResponseWriter, _ *http.Request) {
+		kratostest.WriteJSON(w, http.StatusOK, map[string]any{"redirect_to": srv.URL + "/oauth2/auth?consent_verifier=cv"})
+	})
+	mux.HandleFunc("POST /oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != pending.Get("code_challenge") {
+			kratostest.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+
+			return
+		}
+
+		kratostest.WriteJSON(w, http.StatusOK, Tokens{AccessToken: "access", IDToken: "id", TokenType: "bearer"})
+	})
+	mux.HandleFunc("POST /admin/oauth2/introspect", func(w http.ResponseWriter, r *http.Request) {
+		kratostest.WriteJSON(w, http.StatusOK, Introspection{Active: r.FormValue("token") == "access", Subject: fakeSubject})
+	})
+
+	return srv
+}
+
+func newFakeKratos(t *testing.T, hydraURL string) *client.APIClient {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv, front := kratostest.Serve(t, mux)
+
+	mux.HandleFunc("GET /self-service/login/browser", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("login_challenge") != "lc" {
+			kratostest.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": 400}})
+
+			return
+		}
+
+		now := time.Now()
+
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: fakeCSRF, Path: "/"})
+		kratostest.WriteJSON(w, http.StatusOK, map[string]any{
+			"id": uuid.NewString(), "type": "browser", "state": "choose_method",
+			"issued_at": now, "expires_at": now.Add(time.Hour), "request_url": srv.URL,
+			"ui": map[string]any{"action": srv.URL, "method": http.MethodPost, "nodes": []any{map[string]any{
+				"type": "input", "group": "default", "messages": []any{}, "meta": map[string]any{},
+				"attributes": map[string]any{
+					"node_type": "input", "name": "csrf_token", "type": "hidden", "value": fakeCSRF, "disabled": false,
+				},
+			}}},
+		})
+	})
+	mux.HandleFunc("POST /self-service/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err == nil && body["password"] == noRedirectPassword {
+			kratostest.WriteJSON(w, http.StatusOK, map[string]any{
+				"session": map[string]any{"id": uuid.NewString()},
+			})
+
+			return
+		}
+
+		if body["password"] != fakePassword {
+			kratostest.WriteJSON(w, http.StatusBadRequest, map[string]any{
+				"error": map[string]any{"code": 400, "reason": "denied"},
+			})
+
+			return
+		}
+
+		kratostest.WriteJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":               map[string]any{"id": "browser_location_change_required", "code": 422},
+			"redirect_browser_to": hydraURL + "/oauth2/auth?login_verifier=lv",
+		})
+	})
+
+	return front
+}
+
+func newProvider(t *testing.T) (*Provider, *client.APIClient) {
+	t.Helper()
+
+	prov, err := New()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = prov.Close()
+	})
+
+	hydra := newFakeHydra(t, prov)
+	prov.Connect(hydra.URL+"/", hydra.URL)
+
+	return prov, newFakeKratos(t, hydra.URL)
+}
+
+func TestProvider(t *testing.T) {
+	t.Run("should be able to run authorization code flow with pkce", func(t *testing.T) {
+		prov, front := newProvider(t)
+
+		tokens, err := prov.AuthorizationCode(t.Context(), front, "user@example.com", fakePassword)
+		require.NoError(t, err)
+		assert.Equal(t, "access", tokens.AccessToken)
+		assert.Equal(t, "id", tokens.IDToken)
+
+		info, err := prov.Introspect(t.Context(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.True(t, info.Active)
+		assert.Equal(t, fakeSubject, info.Subject)
+	})
+
+	t.Run("should be able to register client once", func(t *testing.T) {
+		prov, _ := newProvider(t)
+
+		first, err := prov.Client(t.Context())
+		require.NoError(t, err)
+
+		second, err := prov.Client(t.Context())
+		require.NoError(t, err)
+
+		assert.Same(t, first, second)
+		assert.Equal(t, []string{prov.CallbackURL()}, first.RedirectURIs)
+		assert.Equal(t, "none", first.TokenEndpointAuthMethod)
+	})
+
+	t.Run("should be able to send login to kratos", func(t *testing.T) {
+		prov, _ := newProvider(t)
+		prov.SetKratosURL("http://kratos.example.com/")
+
+		cl := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+
+		resp, err := cl.Get(prov.LoginURL() + "?login_challenge=lc")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "http://kratos.example.com/self-service/login/browser?login_challenge=lc",
+			resp.Header.Get("Location"))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when password is wrong", func(t *testing.T) {
+			prov, front := newProvider(t)
+
+			_, err := prov.AuthorizationCode(t.Context(), front, "user@example.com", "wrong")
+			require.ErrorIs(t, err, ErrNotReturned)
+		})
+
+		t.Run("when kratos signs in without returning to hydra", func(t *testing.T) {
+			prov, front := newProvider(t)
+
+			_, err := prov.AuthorizationCode(t.Context(), front, "user@example.com", noRedirectPassword)
+			require.ErrorIs(t, err, ErrNotReturned)
+			assert.NotContains(t, err.Error(), "%!")
+		})
+
+		t.Run("when not connected", func(t *testing.T) {
+			prov, err := New()
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_ = prov.Close()
+			})
+
+			_, err = prov.Client(t.Context())
+			require.ErrorIs(t, err, ErrNotConnected)
+
+			_, err = prov.Introspect(t.Context(), "token")
+			require.ErrorIs(t, err, ErrNotConnected)
+
+			resp, err := http.Get(prov.LoginURL())
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		})
+
+		t.Run("when code exchange is rejected", func(t *testing.T) {
+			prov, _ := newProvider(t)
+
+			cl, err := prov.Client(t.Context())
+			require.NoError(t, err)
+
+			_, err = prov.Exchange(t.Context(), cl, "code", "wrong-verifier")
+			require.ErrorIs(t, err, ErrUnexpectedStatus)
+		})
+
+		t.Run("when hydra does not redirect", func(t *testing.T) {
+			srv := httptest.NewServer(http.NotFoundHandler())
+			t.Cleanup(srv.Close)
+
+			_, err := walk(t.Context(), http.DefaultClient, srv.URL, func(*url.URL) bool { return true })
+			require.ErrorIs(t, err, ErrUnexpectedStatus)
+		})
+
+		t.Run("when redirects loop", func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, srv.URL, http.StatusFound)
+			}))
+			t.Cleanup(srv.Close)
+
+			cl := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+
+			_, err := walk(t.Context(), cl, srv.URL, func(*url.URL) bool { return false })
+			require.ErrorIs(t, err, ErrTooManyRedirects)
+		})
+	})
+}
+
+func TestNewPKCE(t *testing.T) {
+	t.Run("should be able to derive s256 challenge", func(t *testing.T) {
+		pkce := NewPKCE()
+		sum := sha256.Sum256([]byte(pkce.Verifier))
+
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), pkce.Challenge)
+		assert.NotEqual(t, pkce.Verifier, NewPKCE().Verifier)
+	})
+}
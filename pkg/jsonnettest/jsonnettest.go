@@ -0,0 +1,115 @@
+package jsonnettest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/mockoidc"
+	"github.com/godepo/grokratos/pkg/selfservice"
+	"github.com/godepo/grokratos/pkg/webhook"
+)
+
+var ErrNoReceiver = errors.New("webhook receiver is not configured")
+
+// UpdateGoldenEnv rewrites golden files with the rendered output when set.
+const UpdateGoldenEnv = "GROKRATOS_UPDATE_GOLDEN"
+
+const goldenRights = 0o600
+
+// Harness renders Jsonnet templates through a running Kratos: webhook bodies
+// by triggering the flow that calls the hook, claims mappers by signing in
+// through a local OIDC provider.
+type Harness struct {
+	Front *client.APIClient
+	Admin *client.APIClient
+	Hooks *webhook.Receiver
+}
+
+// Webhook runs trigger and returns the body Kratos rendered for hook.
+func (h *Harness) Webhook(
+	ctx context.Context,
+	hook string,
+	trigger func(ctx context.Context) error,
+) (json.RawMessage, error) {
+	if h.Hooks == nil {
+		return nil, ErrNoReceiver
+	}
+
+	h.Hooks.Drain(hook)
+
+	if err := trigger(ctx); err != nil {
+		return nil, fmt.Errorf("failed to trigger %s: %w", hook, err)
+	}
+
+	req, err := h.Hooks.WaitFor(ctx, hook)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture %s: %w", hook, err)
+	}
+
+	return req.Body, nil
+}
+
+// OIDC signs user in through prov and returns the identity its claims mapper
+// produced. The identity is deleted afterwards so the same subject can be
+// rendered again.
+func (h *Harness) OIDC(ctx context.Context, prov *mockoidc.Provider, user mockoidc.User) (*client.Identity, error) {
+	prov.AddUser(user)
+
+	browser, err := selfservice.NewBrowser(h.Front)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := browser.LoginWithOIDC(ctx, prov.ID, user.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	id := session.GetIdentity().Id
+
+	identity, resp, err := h.Admin.IdentityAPI.GetIdentity(ctx, id).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mapped identity: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	resp, err = h.Admin.IdentityAPI.DeleteIdentity(ctx, id).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete mapped identity: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	return identity, nil
+}
+
+// Golden compares got with the JSON stored at path, ignoring formatting.
+// With GROKRATOS_UPDATE_GOLDEN set it writes got to path instead.
+func Golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+
+	var pretty bytes.Buffer
+	require.NoError(t, json.Indent(&pretty, got, "", "  "))
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, append(pretty.Bytes(), '\n'), goldenRights))
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run with %s=1 to create the golden file", UpdateGoldenEnv)
+	assert.JSONEq(t, string(want), pretty.String())
+}
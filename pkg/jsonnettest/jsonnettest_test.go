@@ -0,0 +1,87 @@
+package jsonnettest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/webhook"
+)
+
+func TestHarness_Webhook(t *testing.T) {
+	rcv, err := webhook.New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = rcv.Close()
+	})
+
+	call := func(body string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+				"http://127.0.0.1:"+strconv.Itoa(rcv.Port())+"/hooks/sync", strings.NewReader(body))
+			if err != nil {
+				return err
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+
+			return resp.Body.Close()
+		}
+	}
+
+	t.Run("should be able to return payload of triggered call", func(t *testing.T) {
+		harness := &Harness{Hooks: rcv}
+
+		require.NoError(t, call(`{"stale":true}`)(t.Context()))
+
+		got, err := harness.Webhook(t.Context(), "sync", call(`{"user":"x"}`))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"user":"x"}`, string(got))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when receiver is absent", func(t *testing.T) {
+			_, err := (&Harness{}).Webhook(t.Context(), "sync", call(`{}`))
+			require.ErrorIs(t, err, ErrNoReceiver)
+		})
+
+		t.Run("when trigger fails", func(t *testing.T) {
+			exp := errors.New("unexpected error")
+			_, err := (&Harness{Hooks: rcv}).Webhook(t.Context(), "sync", func(context.Context) error {
+				return exp
+			})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when hook is not called", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			cancel()
+
+			_, err := (&Harness{Hooks: rcv}).Webhook(ctx, "sync", func(context.Context) error {
+				return nil
+			})
+			require.ErrorIs(t, err, context.Canceled)
+		})
+	})
+}
+
+func TestGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "payload.json")
+
+	t.Setenv(UpdateGoldenEnv, "1")
+	Golden(t, path, []byte(`{"b":1,"a":[1,2]}`))
+
+	t.Setenv(UpdateGoldenEnv, "")
+	Golden(t, path, []byte(`{"a":[1,2],"b":1}`))
+}
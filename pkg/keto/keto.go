@@ -0,0 +1,225 @@
+package keto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+var ErrUnexpectedStatus = errors.New("keto returned unexpected status")
+
+type (
+	// RelationTuple relates a subject, either a Kratos identity id or a subject
+	// set, to an object in a namespace.
+	RelationTuple struct {
+		Namespace  string      `json:"namespace"`
+		Object     string      `json:"object"`
+		Relation   string      `json:"relation"`
+		SubjectID  string      `json:"subject_id,omitempty"`
+		SubjectSet *SubjectSet `json:"subject_set,omitempty"`
+	}
+
+	SubjectSet struct {
+		Namespace string `json:"namespace"`
+		Object    string `json:"object"`
+		Relation  string `json:"relation"`
+	}
+
+	// ReadClient talks to the Keto read API.
+	ReadClient struct {
+		URL  string
+		HTTP *http.Client
+	}
+
+	// WriteClient talks to the Keto write API.
+	WriteClient struct {
+		URL  string
+		HTTP *http.Client
+	}
+)
+
+func NewReadClient(baseURL string) *ReadClient {
+	return &ReadClient{URL: baseURL, HTTP: http.DefaultClient}
+}
+
+func NewWriteClient(baseURL string) *WriteClient {
+	return &WriteClient{URL: baseURL, HTTP: http.DefaultClient}
+}
+
+// Check reports whether the subject of tuple has the relation, following
+// subject sets and namespace rewrites.
+func (r *ReadClient) Check(ctx context.Context, tuple RelationTuple) (bool, error) {
+	var res struct {
+		Allowed bool `json:"allowed"`
+	}
+
+	if err := do(ctx, r.HTTP, http.MethodPost, r.URL+"/relation-tuples/check/openapi", tuple, &res); err != nil {
+		return false, fmt.Errorf("keto check: %w", err)
+	}
+
+	return res.Allowed, nil
+}
+
+// List returns tuples matching the non-empty fields of query.
+func (r *ReadClient) List(ctx context.Context, query RelationTuple) ([]RelationTuple, error) {
+	var (
+		res    []RelationTuple
+		params = query.values()
+	)
+
+	for {
+		var page struct {
+			RelationTuples []RelationTuple `json:"relation_tuples"`
+			NextPageToken  string          `json:"next_page_token"`
+		}
+
+		err := do(ctx, r.HTTP, http.MethodGet, r.URL+"/relation-tuples?"+params.Encode(), nil, &page)
+		if err != nil {
+			return nil, fmt.Errorf("keto list: %w", err)
+		}
+
+		res = append(res, page.RelationTuples...)
+
+		if page.NextPageToken == "" {
+			return res, nil
+		}
+
+		params.Set("page_token", page.NextPageToken)
+	}
+}
+
+func (w *WriteClient) Create(ctx context.Context, tuple RelationTuple) error {
+	if err := do(ctx, w.HTTP, http.MethodPut, w.URL+"/admin/relation-tuples", tuple, nil); err != nil {
+		return fmt.Errorf("keto create: %w", err)
+	}
+
+	return nil
+}
+
+func (w *WriteClient) Delete(ctx context.Context, tuple RelationTuple) error {
+	err := do(ctx, w.HTTP, http.MethodDelete, w.URL+"/admin/relation-tuples?"+tuple.values().Encode(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("keto delete: %w", err)
+	}
+
+	return nil
+}
+
+// GrantTuple creates tuple and deletes it in t.Cleanup.
+func (w *WriteClient) GrantTuple(t testing.TB, tuple RelationTuple) RelationTuple {
+	t.Helper()
+
+	if err := w.Create(t.Context(), tuple); err != nil {
+		t.Fatalf("failed to grant %s: %v", tuple, err)
+	}
+
+	t.Cleanup(func() {
+		if err := w.Delete(context.Background(), tuple); err != nil {
+			t.Errorf("failed to revoke %s: %v", tuple, err)
+		}
+	})
+
+	return tuple
+}
+
+// Grant relates identity to object for the duration of the test.
+func (w *WriteClient) Grant(t testing.TB, identity *client.Identity, namespace, object, relation string) RelationTuple {
+	t.Helper()
+
+	return w.GrantTuple(t, RelationTuple{
+		Namespace: namespace,
+		Object:    object,
+		Relation:  relation,
+		SubjectID: identity.Id,
+	})
+}
+
+func (r RelationTuple) String() string {
+	subject := r.SubjectID
+	if r.SubjectSet != nil {
+		subject = r.SubjectSet.Namespace + ":" + r.SubjectSet.Object + "#" + r.SubjectSet.Relation
+	}
+
+	return r.Namespace + ":" + r.Object + "#" + r.Relation + "@" + subject
+}
+
+func (r RelationTuple) values() url.Values {
+	res := url.Values{}
+
+	set := func(key, val string) {
+		if val != "" {
+			res.Set(key, val)
+		}
+	}
+
+	set("namespace", r.Namespace)
+	set("object", r.Object)
+	set("relation", r.Relation)
+	set("subject_id", r.SubjectID)
+
+	if r.SubjectSet != nil {
+		set("subject_set.namespace", r.SubjectSet.Namespace)
+		set("subject_set.object", r.SubjectSet.Object)
+		set("subject_set.relation", r.SubjectSet.Relation)
+	}
+
+	return res
+}
+
+func do(ctx context.Context, cl *http.Client, method, target string, body, out any) error {
+	var reader io.Reader
+
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call keto: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read keto response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w: %d %s", ErrUnexpectedStatus, resp.StatusCode, raw)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("failed to decode keto response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package keto
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKeto keeps tuples in memory and pages list results one by one.
+type fakeKeto struct {
+	mu     sync.Mutex
+	tuples []RelationTuple
+}
+
+func (f *fakeKeto) matches(q RelationTuple, tuple RelationTuple) bool {
+	return (q.Namespace == "" || q.Namespace == tuple.Namespace) &&
+		(q.Object == "" || q.Object == tuple.Object) &&
+		(q.Relation == "" || q.Relation == tuple.Relation) &&
+		(q.SubjectID == "" || q.SubjectID == tuple.SubjectID)
+}
+
+func query(r *http.Request) RelationTuple {
+	return RelationTuple{
+		Namespace: r.URL.Query().Get("namespace"),
+		Object:    r.URL.Query().Get("object"),
+		Relation:  r.URL.Query().Get("relation"),
+		SubjectID: r.URL.Query().Get("subject_id"),
+	}
+}
+
+func newFakeKeto(t *testing.T) (*fakeKeto, *ReadClient, *WriteClient) {
+	t.Helper()
+
+	fake := &fakeKeto{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("PUT /admin/relation-tuples", func(w http.ResponseWriter, r *http.Request) {
+		var tuple RelationTuple
+		if err := json.NewDecoder(r.Body).Decode(&tuple); err != nil || tuple.Namespace == "" {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		fake.mu.Lock()
+		fake.tuples = append(fake.tuples, tuple)
+		fake.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(tuple)
+	})
+	mux.HandleFunc("DELETE /admin/relation-tuples", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		fake.tuples = slices.DeleteFunc(fake.tuples, func(tuple RelationTuple) bool {
+			return fake.matches(query(r), tuple)
+		})
+		fake.mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /relation-tuples/check/openapi", func(w http.ResponseWriter, r *http.Request) {
+		var tuple RelationTuple
+		_ = json.NewDecoder(r.Body).Decode(&tuple)
+
+		fake.mu.Lock()
+		allowed := slices.Contains(fake.tuples, tuple)
+		fake.mu.Unlock()
+
+		_ = json.NewEncoder(w).Encode(map[string]bool{"allowed": allowed})
+	})
+	mux.HandleFunc("GET /relation-tuples", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		var found []RelationTuple
+
+		for _, tuple := range fake.tuples {
+			if fake.matches(query(r), tuple) {
+				found = append(found, tuple)
+			}
+		}
+
+		page := map[string]any{"relation_tuples": found}
+
+		if r.URL.Query().Get("page_token") == "" && len(found) > 1 {
+			page = map[string]any{"relation_tuples": found[:1], "next_page_token": "next"}
+		} else if len(found) > 1 {
+			page = map[string]any{"relation_tuples": found[1:]}
+		}
+
+		_ = json.NewEncoder(w).Encode(page)
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return fake, NewReadClient(srv.URL), NewWriteClient(srv.URL)
+}
+
+func TestClients(t *testing.T) {
+	t.Run("should be able to grant and revoke per test", func(t *testing.T) {
+		fake, read, write := newFakeKeto(t)
+		identity := &client.Identity{Id: "identity-id"}
+
+		t.Run("with grant", func(t *testing.T) {
+			tuple := write.Grant(t, identity, "documents", "readme", "viewer")
+			assert.Equal(t, "documents:readme#viewer@identity-id", tuple.String())
+
+			allowed, err := read.Check(t.Context(), tuple)
+			require.NoError(t, err)
+			assert.True(t, allowed)
+		})
+
+		assert.Empty(t, fake.tuples)
+
+		allowed, err := read.Check(t.Context(), RelationTuple{
+			Namespace: "documents", Object: "readme", Relation: "viewer", SubjectID: identity.Id,
+		})
+		require.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("should be able to list all pages", func(t *testing.T) {
+		_, read, write := newFakeKeto(t)
+
+		write.GrantTuple(t, RelationTuple{Namespace: "documents", Object: "a", Relation: "owner", SubjectID: "one"})
+		write.GrantTuple(t, RelationTuple{Namespace: "documents", Object: "b", Relation: "owner", SubjectID: "one"})
+		write.GrantTuple(t, RelationTuple{Namespace: "groups", Object: "c", Relation: "member", SubjectID: "one"})
+
+		got, err := read.List(t.Context(), RelationTuple{Namespace: "documents"})
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		assert.Equal(t, "a", got[0].Object)
+		assert.Equal(t, "b", got[1].Object)
+	})
+
+	t.Run("should be able to describe subject sets", func(t *testing.T) {
+		tuple := RelationTuple{
+			Namespace: "documents", Object: "readme", Relation: "viewer",
+			SubjectSet: &SubjectSet{Namespace: "groups", Object: "admins", Relation: "member"},
+		}
+
+		assert.Equal(t, "documents:readme#viewer@groups:admins#member", tuple.String())
+		assert.Equal(t, "admins", tuple.values().Get("subject_set.object"))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when keto rejects tuple", func(t *testing.T) {
+			_, _, write := newFakeKeto(t)
+
+			err := write.Create(t.Context(), RelationTuple{})
+			require.ErrorIs(t, err, ErrUnexpectedStatus)
+		})
+
+		t.Run("when keto is unavailable", func(t *testing.T) {
+			read := NewReadClient("http://127.0.0.1:1")
+			write := NewWriteClient("http://127.0.0.1:1")
+
+			_, err := read.Check(t.Context(), RelationTuple{})
+			require.Error(t, err)
+
+			_, err = read.List(t.Context(), RelationTuple{})
+			require.Error(t, err)
+
+			require.Error(t, write.Delete(t.Context(), RelationTuple{}))
+		})
+
+		t.Run("when response is malformed", func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("not json"))
+			}))
+			t.Cleanup(srv.Close)
+
+			_, err := NewReadClient(srv.URL).Check(t.Context(), RelationTuple{})
+			require.ErrorContains(t, err, "failed to decode")
+		})
+	})
+}
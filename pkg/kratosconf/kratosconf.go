@@ -0,0 +1,160 @@
+package kratosconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNotObject = errors.New("config node is not an object")
+
+const writeRights = 0o600
+
+type (
+	// Config is a mutable view of kratos.yaml addressed by dotted paths
+	// like "selfservice.methods.oidc.enabled".
+	Config struct {
+		doc map[string]any
+	}
+
+	Patch func(*Config) error
+)
+
+func New() *Config {
+	return &Config{doc: map[string]any{}}
+}
+
+func Load(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kratos config: %w", err)
+	}
+
+	return Parse(raw)
+}
+
+func Parse(raw []byte) (*Config, error) {
+	doc := map[string]any{}
+
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse kratos config: %w", err)
+	}
+
+	return &Config{doc: doc}, nil
+}
+
+// Clone returns a deep copy, so patches applied to it leave c untouched.
+func (c *Config) Clone() (*Config, error) {
+	raw, err := c.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(raw)
+}
+
+func (c *Config) Get(path string) (any, bool) {
+	var node any = c.doc
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		node, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return node, true
+}
+
+func (c *Config) Set(path string, value any) error {
+	parent, key, err := c.parent(path)
+	if err != nil {
+		return err
+	}
+
+	parent[key] = value
+
+	return nil
+}
+
+// Append adds values to the list at path, creating the list when it is absent.
+func (c *Config) Append(path string, values ...any) error {
+	parent, key, err := c.parent(path)
+	if err != nil {
+		return err
+	}
+
+	list, _ := parent[key].([]any)
+	parent[key] = append(list, values...)
+
+	return nil
+}
+
+func (c *Config) Apply(patches ...Patch) error {
+	for _, patch := range patches {
+		if err := patch(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) Bytes() ([]byte, error) {
+	raw, err := yaml.Marshal(c.doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render kratos config: %w", err)
+	}
+
+	return raw, nil
+}
+
+// WriteTemp renders the config into a fresh file inside dir and returns its path.
+func (c *Config) WriteTemp(dir string) (string, error) {
+	raw, err := c.Bytes()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "kratos.yaml")
+
+	if err := os.WriteFile(path, raw, writeRights); err != nil {
+		return "", fmt.Errorf("failed to write kratos config: %w", err)
+	}
+
+	return path, nil
+}
+
+func (c *Config) parent(path string) (map[string]any, string, error) {
+	keys := strings.Split(path, ".")
+	node := c.doc
+
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := node[key]
+		if !ok || next == nil {
+			child := map[string]any{}
+			node[key] = child
+			node = child
+
+			continue
+		}
+
+		child, ok := next.(map[string]any)
+		if !ok {
+			return nil, "", fmt.Errorf("%w: %s", ErrNotObject, key)
+		}
+
+		node = child
+	}
+
+	return node, keys[len(keys)-1], nil
+}
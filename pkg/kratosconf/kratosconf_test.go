@@ -0,0 +1,108 @@
+package kratosconf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("should be able to load shipped config", func(t *testing.T) {
+		cfg, err := Load("../tc-kratos/etc/kratos.yaml")
+		require.NoError(t, err)
+
+		val, ok := cfg.Get("selfservice.flows.login.lifespan")
+		require.True(t, ok)
+		assert.Equal(t, "10m", val)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when file is absent", func(t *testing.T) {
+			_, err := Load(filepath.Join(t.TempDir(), "absent.yaml"))
+			require.ErrorIs(t, err, os.ErrNotExist)
+		})
+
+		t.Run("when file is not yaml", func(t *testing.T) {
+			_, err := Parse([]byte("\t- broken: ["))
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestConfig_Set(t *testing.T) {
+	t.Run("should be able to create missing parents", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.Set("selfservice.methods.oidc.enabled", true))
+
+		val, ok := cfg.Get("selfservice.methods.oidc.enabled")
+		require.True(t, ok)
+		assert.Equal(t, true, val)
+	})
+
+	t.Run("should be able to be failed when parent is scalar", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.Set("dsn", "memory"))
+		require.ErrorIs(t, cfg.Set("dsn.value", "x"), ErrNotObject)
+	})
+
+	t.Run("should not find value under scalar", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.Set("dsn", "memory"))
+
+		_, ok := cfg.Get("dsn.value")
+		assert.False(t, ok)
+	})
+}
+
+func TestConfig_Append(t *testing.T) {
+	cfg := New()
+	require.NoError(t, cfg.Append("hooks", "a"))
+	require.NoError(t, cfg.Append("hooks", "b", "c"))
+
+	val, ok := cfg.Get("hooks")
+	require.True(t, ok)
+	assert.Equal(t, []any{"a", "b", "c"}, val)
+
+	require.NoError(t, cfg.Set("scalar", 1))
+	require.ErrorIs(t, cfg.Append("scalar.list", 1), ErrNotObject)
+}
+
+func TestConfig_WriteTemp(t *testing.T) {
+	cfg := New()
+	require.NoError(t, cfg.Apply(func(c *Config) error {
+		return c.Set("session.lifespan", "1m")
+	}))
+
+	path, err := cfg.WriteTemp(t.TempDir())
+	require.NoError(t, err)
+
+	loaded, err := Load(path)
+	require.NoError(t, err)
+
+	val, ok := loaded.Get("session.lifespan")
+	require.True(t, ok)
+	assert.Equal(t, "1m", val)
+
+	_, err = cfg.WriteTemp(filepath.Join(t.TempDir(), "absent"))
+	require.Error(t, err)
+}
+
+func TestConfig_Clone(t *testing.T) {
+	t.Run("should be able to patch clone without touching source", func(t *testing.T) {
+		cfg := New()
+		require.NoError(t, cfg.Set("session.lifespan", "1h"))
+
+		clone, err := cfg.Clone()
+		require.NoError(t, err)
+		require.NoError(t, clone.Set("session.lifespan", "1s"))
+
+		val, _ := cfg.Get("session.lifespan")
+		assert.Equal(t, "1h", val)
+
+		val, _ = clone.Get("session.lifespan")
+		assert.Equal(t, "1s", val)
+	})
+}
@@ -0,0 +1,229 @@
+package kratoserr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+type (
+	// Error is a typed view of a Kratos API error: either a generic error
+	// envelope or a flow returned with validation messages.
+	Error struct {
+		Status   int
+		ID       string
+		Reason   string
+		Message  string
+		Redirect string
+		Flow     *Flow
+
+		cause error
+	}
+
+	Flow struct {
+		ID    string `json:"id"`
+		Type  string `json:"type"`
+		State string `json:"state"`
+		UI    UI     `json:"ui"`
+	}
+
+	UI struct {
+		Action   string    `json:"action"`
+		Method   string    `json:"method"`
+		Messages []Message `json:"messages"`
+		Nodes    []Node    `json:"nodes"`
+	}
+
+	Node struct {
+		Type       string    `json:"type"`
+		Group      string    `json:"group"`
+		Attributes Attrs     `json:"attributes"`
+		Messages   []Message `json:"messages"`
+	}
+
+	Attrs struct {
+		Name  string `json:"name"`
+		Type  string `json:"type"`
+		Value any    `json:"value"`
+	}
+
+	Message struct {
+		ID      int64          `json:"id"`
+		Text    string         `json:"text"`
+		Type    string         `json:"type"`
+		Context map[string]any `json:"context"`
+	}
+
+	body struct {
+		Error *struct {
+			ID      string `json:"id"`
+			Code    int    `json:"code"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"error"`
+		RedirectBrowserTo string `json:"redirect_browser_to"`
+		ID                string `json:"id"`
+		Type              string `json:"type"`
+		State             any    `json:"state"`
+		UI                *UI    `json:"ui"`
+	}
+)
+
+// From converts errors returned by client-go into *Error so they can be
+// inspected with errors.As. Other errors are returned unchanged.
+func From(err error) error {
+	if res, ok := Parse(err); ok {
+		return res
+	}
+
+	return err
+}
+
+// FromResponse is From with the status taken from resp. client-go replaces
+// the status text of an error when the body does not match its error model.
+func FromResponse(resp *http.Response, err error) error {
+	res, ok := Parse(err)
+	if !ok {
+		return err
+	}
+
+	if resp != nil {
+		res.Status = resp.StatusCode
+	}
+
+	return res
+}
+
+func Parse(err error) (*Error, bool) {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed, true
+	}
+
+	var apiErr *client.GenericOpenAPIError
+	if !errors.As(err, &apiErr) {
+		return nil, false
+	}
+
+	res := &Error{Status: status(apiErr.Error()), cause: err}
+
+	// client-go reports failures to build a request with the same type
+	if res.Status == 0 && len(apiErr.Body()) == 0 {
+		return nil, false
+	}
+
+	var raw body
+	if json.Unmarshal(apiErr.Body(), &raw) != nil {
+		res.Message = string(apiErr.Body())
+
+		return res, true
+	}
+
+	res.Redirect = raw.RedirectBrowserTo
+
+	if raw.Error != nil {
+		res.ID = raw.Error.ID
+		res.Reason = raw.Error.Reason
+		res.Message = raw.Error.Message
+
+		if raw.Error.Code != 0 {
+			res.Status = raw.Error.Code
+		}
+	}
+
+	if raw.UI != nil {
+		state, _ := raw.State.(string)
+		res.Flow = &Flow{ID: raw.ID, Type: raw.Type, State: state, UI: *raw.UI}
+	}
+
+	return res, true
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString("kratos")
+
+	if e.Status != 0 {
+		sb.WriteString(" " + strconv.Itoa(e.Status))
+	}
+
+	if e.ID != "" {
+		sb.WriteString(" " + e.ID)
+	}
+
+	if e.Reason != "" {
+		sb.WriteString(": " + e.Reason)
+	} else if e.Message != "" {
+		sb.WriteString(": " + e.Message)
+	}
+
+	for _, msg := range e.Messages() {
+		sb.WriteString(fmt.Sprintf("; %d %s", msg.ID, msg.Text))
+	}
+
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Messages returns messages of the flow and all of its nodes.
+func (e *Error) Messages() []Message {
+	if e.Flow == nil {
+		return nil
+	}
+
+	return e.Flow.UI.AllMessages()
+}
+
+func (e *Error) HasMessage(id int64) bool {
+	return slices.ContainsFunc(e.Messages(), func(msg Message) bool {
+		return msg.ID == id
+	})
+}
+
+// Field returns messages attached to the node with input name, e.g. "traits.email".
+func (e *Error) Field(name string) []Message {
+	if e.Flow == nil {
+		return nil
+	}
+
+	var res []Message
+
+	for _, node := range e.Flow.UI.Nodes {
+		if node.Attributes.Name == name {
+			res = append(res, node.Messages...)
+		}
+	}
+
+	return res
+}
+
+func (u UI) AllMessages() []Message {
+	res := append([]Message(nil), u.Messages...)
+
+	for _, node := range u.Nodes {
+		res = append(res, node.Messages...)
+	}
+
+	return res
+}
+
+func status(text string) int {
+	code, _, _ := strings.Cut(text, " ")
+
+	res, err := strconv.Atoi(code)
+	if err != nil {
+		return 0
+	}
+
+	return res
+}
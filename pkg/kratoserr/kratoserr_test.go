@@ -0,0 +1,129 @@
+package kratoserr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const flowBody = `{"id":"flow-id","type":"api","state":"choose_method",
+	"ui":{"action":"http://kratos/login","method":"POST",
+	"messages":[{"id":4000006,"text":"The provided credentials are invalid.","type":"error"}],
+	"nodes":[{"type":"input","group":"default","attributes":{"name":"identifier","type":"text","value":"a@b.c"},
+	"messages":[{"id":4000002,"text":"Property identifier is missing.","type":"error",
+	"context":{"property":"identifier"}}]},
+	{"type":"input","group":"password","attributes":{"name":"password","type":"password"},"messages":[]}]}}`
+
+func apiError(t *testing.T, status int, body string) error {
+	t.Helper()
+
+	_, err := apiResponse(t, status, body)
+
+	return err
+}
+
+func apiResponse(t *testing.T, status int, body string) (*http.Response, error) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	addr, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	cfg := client.NewConfiguration()
+	cfg.Host = addr.Host
+	cfg.Scheme = addr.Scheme
+
+	_, resp, err := client.NewAPIClient(cfg).FrontendAPI.UpdateLoginFlow(t.Context()).Flow("flow-id").
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+			UpdateLoginFlowWithPasswordMethod: client.NewUpdateLoginFlowWithPasswordMethod("id", "password", "pass"),
+		}).
+		Execute()
+	require.Error(t, err)
+
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	return resp, err
+}
+
+func TestParse(t *testing.T) {
+	t.Run("should be able to decode flow with ui messages", func(t *testing.T) {
+		var res *Error
+		require.ErrorAs(t, FromResponse(apiResponse(t, http.StatusBadRequest, flowBody)), &res)
+
+		assert.Equal(t, http.StatusBadRequest, res.Status)
+		require.NotNil(t, res.Flow)
+		assert.Equal(t, "flow-id", res.Flow.ID)
+		assert.Equal(t, "choose_method", res.Flow.State)
+		assert.True(t, res.HasMessage(4000006))
+		assert.True(t, res.HasMessage(4000002))
+		assert.False(t, res.HasMessage(4000010))
+		assert.Equal(t, "identifier", res.Field("identifier")[0].Context["property"])
+		assert.Empty(t, res.Field("password"))
+		assert.Contains(t, res.Error(), "kratos 400; 4000006 The provided credentials are invalid.")
+	})
+
+	t.Run("should be able to decode generic error", func(t *testing.T) {
+		res, ok := Parse(apiError(t, http.StatusUnprocessableEntity, `{"error":{"id":"browser_location_change_required",
+			"code":422,"reason":"follow the link"},"redirect_browser_to":"http://kratos/next"}`))
+		require.True(t, ok)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Status)
+		assert.Equal(t, "browser_location_change_required", res.ID)
+		assert.Equal(t, "http://kratos/next", res.Redirect)
+		assert.Nil(t, res.Flow)
+		assert.Nil(t, res.Messages())
+		assert.Nil(t, res.Field("any"))
+		assert.Equal(t, "kratos 422 browser_location_change_required: follow the link", res.Error())
+	})
+
+	t.Run("should be able to keep body which is not json", func(t *testing.T) {
+		var res *Error
+		require.ErrorAs(t, FromResponse(apiResponse(t, http.StatusBadGateway, "bad gateway")), &res)
+
+		assert.Equal(t, http.StatusBadGateway, res.Status)
+		assert.Equal(t, "kratos 502: bad gateway", res.Error())
+	})
+
+	t.Run("should be able to be used with errors.As", func(t *testing.T) {
+		cause := apiError(t, http.StatusForbidden, `{"error":{"id":"session_aal2_required","code":403,"message":"aal2"}}`)
+		err := fmt.Errorf("login: %w", From(cause))
+
+		var typed *Error
+		require.ErrorAs(t, err, &typed)
+		assert.Equal(t, "session_aal2_required", typed.ID)
+
+		var apiErr *client.GenericOpenAPIError
+		require.ErrorAs(t, err, &apiErr)
+
+		again, ok := Parse(err)
+		require.True(t, ok)
+		assert.Same(t, typed, again)
+	})
+
+	t.Run("should be able to ignore other errors", func(t *testing.T) {
+		exp := errors.New("boom")
+		assert.Same(t, exp, From(exp))
+
+		_, ok := Parse(exp)
+		assert.False(t, ok)
+
+		_, ok = Parse(nil)
+		assert.False(t, ok)
+		assert.Same(t, exp, FromResponse(nil, exp))
+	})
+}
@@ -0,0 +1,43 @@
+package kratosversion
+
+// Capability is a Kratos feature some helpers rely on that older releases lack.
+type Capability string
+
+const (
+	// AdminSessions are the /admin/sessions endpoints listing, fetching and
+	// extending sessions by id.
+	AdminSessions Capability = "admin session APIs"
+	// AdminRecoveryCode mints recovery codes through /admin/recovery/code for
+	// a flow_type of choice, which native flows need.
+	AdminRecoveryCode Capability = "admin recovery codes"
+	// CodeMethod signs up and in with one-time codes instead of a password.
+	CodeMethod Capability = "code method"
+	// Passkeys is the passkey method, distinct from webauthn.
+	Passkeys Capability = "passkey method"
+)
+
+// capabilities maps each capability to the first release shipping it.
+var capabilities = map[Capability]Version{
+	AdminSessions:     MustParse("v0.13.0"),
+	AdminRecoveryCode: MustParse("v1.3.0"),
+	CodeMethod:        MustParse("v1.1.0"),
+	Passkeys:          MustParse("v1.1.0"),
+}
+
+// Since returns the first release shipping c, false for unknown capabilities.
+func Since(c Capability) (Version, bool) {
+	ver, ok := capabilities[c]
+
+	return ver, ok
+}
+
+// Supports reports whether v ships c. A zero version, e.g. from a latest tag,
+// is taken to support everything, an unknown capability nothing.
+func (v Version) Supports(c Capability) bool {
+	since, ok := Since(c)
+	if !ok {
+		return false
+	}
+
+	return v.IsZero() || v.AtLeast(since)
+}
@@ -0,0 +1,40 @@
+package kratosversion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersion_Supports(t *testing.T) {
+	t.Run("should be able to gate capabilities by release", func(t *testing.T) {
+		assert.True(t, MustParse("v1.3.1").Supports(Passkeys))
+		assert.True(t, MustParse("v1.1.0").Supports(CodeMethod))
+		assert.False(t, MustParse("v1.1.0-pre.0").Supports(CodeMethod))
+		assert.False(t, MustParse("v1.0.0").Supports(Passkeys))
+		assert.True(t, MustParse("v1.0.0").Supports(AdminSessions))
+		assert.False(t, MustParse("v0.11.1").Supports(AdminSessions))
+		assert.True(t, MustParse("v1.3.0").Supports(AdminRecoveryCode))
+		assert.False(t, MustParse("v1.2.0").Supports(AdminRecoveryCode))
+	})
+
+	t.Run("should be able to support everything without version", func(t *testing.T) {
+		assert.True(t, Version{}.Supports(Passkeys))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when capability is unknown", func(t *testing.T) {
+			assert.False(t, MustParse("v1.3.1").Supports("sms"))
+			assert.False(t, Version{}.Supports("sms"))
+
+			_, ok := Since("sms")
+			assert.False(t, ok)
+		})
+	})
+}
+
+func TestSince(t *testing.T) {
+	since, ok := Since(Passkeys)
+	assert.True(t, ok)
+	assert.Equal(t, "v1.1.0", since.String())
+}
@@ -0,0 +1,118 @@
+package kratosversion
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrNoVersion = errors.New("not a kratos version")
+
+// flavors are image tag suffixes naming a build rather than a pre-release.
+var flavors = []string{"-distroless"}
+
+// Version is a Kratos release like v1.3.1 or v1.1.0-pre.0.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string
+}
+
+// Parse reads a release with or without the leading v.
+func Parse(raw string) (Version, error) {
+	core, pre, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(raw), "v"), "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("%w: %q", ErrNoVersion, raw)
+	}
+
+	nums := make([]int, 0, len(parts))
+
+	for _, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return Version{}, fmt.Errorf("%w: %q", ErrNoVersion, raw)
+		}
+
+		nums = append(nums, num)
+	}
+
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2], Pre: pre}, nil
+}
+
+// MustParse is Parse for literals, panicking on malformed ones.
+func MustParse(raw string) Version {
+	ver, err := Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return ver
+}
+
+// FromImage reads the version from the tag of image, e.g.
+// oryd/kratos:v1.3.1-distroless. Tags like latest have none.
+func FromImage(image string) (Version, error) {
+	image, _, _ = strings.Cut(image, "@")
+
+	slash := strings.LastIndex(image, "/")
+
+	colon := strings.LastIndex(image, ":")
+	if colon <= slash {
+		return Version{}, fmt.Errorf("%w: image %s has no tag", ErrNoVersion, image)
+	}
+
+	tag := image[colon+1:]
+	for _, flavor := range flavors {
+		tag = strings.TrimSuffix(tag, flavor)
+	}
+
+	return Parse(tag)
+}
+
+// Compare orders versions like semver, a pre-release before its release.
+func (v Version) Compare(other Version) int {
+	if res := cmp.Compare(v.Major, other.Major); res != 0 {
+		return res
+	}
+
+	if res := cmp.Compare(v.Minor, other.Minor); res != 0 {
+		return res
+	}
+
+	if res := cmp.Compare(v.Patch, other.Patch); res != 0 {
+		return res
+	}
+
+	switch {
+	case v.Pre == other.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case other.Pre == "":
+		return -1
+	default:
+		return strings.Compare(v.Pre, other.Pre)
+	}
+}
+
+func (v Version) AtLeast(minimum Version) bool {
+	return v.Compare(minimum) >= 0
+}
+
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+func (v Version) String() string {
+	res := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		res += "-" + v.Pre
+	}
+
+	return res
+}
@@ -0,0 +1,70 @@
+package kratosversion
+
+import (
+	"cmp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("should be able to parse releases", func(t *testing.T) {
+		for raw, exp := range map[string]Version{
+			"v1.3.1":        {Major: 1, Minor: 3, Patch: 1},
+			"1.0.0":         {Major: 1},
+			" v1.1.0-pre.0": {Major: 1, Minor: 1, Pre: "pre.0"},
+		} {
+			got, err := Parse(raw)
+			require.NoError(t, err, raw)
+			assert.Equal(t, exp, got, raw)
+		}
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		for _, raw := range []string{"", "latest", "v1.3", "v1.x.0", "v1.-1.0"} {
+			_, err := Parse(raw)
+			require.ErrorIs(t, err, ErrNoVersion, raw)
+		}
+
+		assert.Panics(t, func() { MustParse("master") })
+	})
+}
+
+func TestFromImage(t *testing.T) {
+	t.Run("should be able to read image tags", func(t *testing.T) {
+		for image, exp := range map[string]string{
+			"oryd/kratos:v1.3.1":                       "v1.3.1",
+			"oryd/kratos:v1.2.0-distroless":            "v1.2.0",
+			"localhost:5000/oryd/kratos:v1.1.0":        "v1.1.0",
+			"oryd/kratos:v1.3.1@sha256:0123456789abcd": "v1.3.1",
+		} {
+			got, err := FromImage(image)
+			require.NoError(t, err, image)
+			assert.Equal(t, exp, got.String(), image)
+		}
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		for _, image := range []string{"oryd/kratos", "localhost:5000/oryd/kratos", "oryd/kratos:latest"} {
+			_, err := FromImage(image)
+			require.ErrorIs(t, err, ErrNoVersion, image)
+		}
+	})
+}
+
+func TestVersion_Compare(t *testing.T) {
+	ordered := []string{"v1.0.0", "v1.1.0-pre.0", "v1.1.0-pre.1", "v1.1.0", "v1.1.1", "v1.3.0", "v2.0.0"}
+
+	for i := range ordered {
+		for j := range ordered {
+			got := MustParse(ordered[i]).Compare(MustParse(ordered[j]))
+			assert.Equal(t, cmp.Compare(i, j), got, ordered[i]+" vs "+ordered[j])
+		}
+	}
+
+	assert.True(t, MustParse("v1.3.1").AtLeast(MustParse("v1.3.0")))
+	assert.False(t, MustParse("v1.2.0").AtLeast(MustParse("v1.3.0")))
+	assert.True(t, Version{}.IsZero())
+	assert.Equal(t, "v1.1.0-pre.0", MustParse("1.1.0-pre.0").String())
+}
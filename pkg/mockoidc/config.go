@@ -0,0 +1,60 @@
+package mockoidc
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+//go:embed etc/mapper.jsonnet
+var DefaultMapper []byte
+
+// Patch registers the provider under selfservice.methods.oidc and lets
+// first-time sign-ins register and receive a session in one pass.
+func (p *Provider) Patch(mapper []byte) kratosconf.Patch {
+	if len(mapper) == 0 {
+		mapper = DefaultMapper
+	}
+
+	return func(cfg *kratosconf.Config) error {
+		if err := cfg.Set("selfservice.methods.oidc.enabled", true); err != nil {
+			return fmt.Errorf("failed to enable oidc: %w", err)
+		}
+
+		err := cfg.Append("selfservice.methods.oidc.config.providers", map[string]any{
+			"id":            p.ID,
+			"provider":      "generic",
+			"client_id":     p.ClientID,
+			"client_secret": p.ClientSecret,
+			"issuer_url":    p.IssuerURL(),
+			"mapper_url":    "base64://" + base64.StdEncoding.EncodeToString(mapper),
+			"scope":         []any{"openid", "email", "profile"},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register oidc provider: %w", err)
+		}
+
+		return ensureSessionHook(cfg)
+	}
+}
+
+func ensureSessionHook(cfg *kratosconf.Config) error {
+	const path = "selfservice.flows.registration.after.oidc.hooks"
+
+	if hooks, ok := cfg.Get(path); ok {
+		list, _ := hooks.([]any)
+		for _, hook := range list {
+			if obj, ok := hook.(map[string]any); ok && obj["hook"] == "session" {
+				return nil
+			}
+		}
+	}
+
+	if err := cfg.Append(path, map[string]any{"hook": "session"}); err != nil {
+		return fmt.Errorf("failed to add oidc session hook: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package mockoidc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+func TestProvider_Patch(t *testing.T) {
+	prov := newProvider(t)
+
+	t.Run("should be able to register provider with session hook once", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Apply(prov.Patch(nil), prov.Patch([]byte("{}"))))
+
+		providers, ok := cfg.Get("selfservice.methods.oidc.config.providers")
+		require.True(t, ok)
+		require.Len(t, providers, 2)
+		assert.Equal(t, prov.IssuerURL(), providers.([]any)[0].(map[string]any)["issuer_url"])
+
+		hooks, ok := cfg.Get("selfservice.flows.registration.after.oidc.hooks")
+		require.True(t, ok)
+		assert.Len(t, hooks, 1)
+	})
+
+	t.Run("should be able to be failed when methods is not object", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Set("selfservice.methods", "broken"))
+		require.ErrorIs(t, prov.Patch(nil)(cfg), kratosconf.ErrNotObject)
+	})
+}
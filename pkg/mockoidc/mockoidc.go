@@ -0,0 +1,384 @@
+package mockoidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/godepo/grokratos/internal/hostserver"
+)
+
+var (
+	ErrUnknownUser = errors.New("unknown oidc user")
+	ErrNoUsers     = errors.New("oidc provider has no users")
+)
+
+const (
+	keyBits       = 2048
+	tokenLifetime = time.Hour
+)
+
+type (
+	User struct {
+		Subject string
+		Claims  map[string]any
+	}
+
+	Option func(*Provider)
+
+	Provider struct {
+		ID           string
+		ClientID     string
+		ClientSecret string
+
+		listenerConstructor hostserver.ListenerConstructor
+		server              *hostserver.Server
+		key                 *rsa.PrivateKey
+		issuer              string
+		browserURL          string
+
+		mu     sync.Mutex
+		users  []User
+		codes  map[string]grant
+		tokens map[string]User
+	}
+
+	grant struct {
+		user     User
+		clientID string
+		nonce    string
+	}
+)
+
+func WithUsers(users ...User) Option {
+	return func(p *Provider) {
+		p.users = append(p.users, users...)
+	}
+}
+
+func WithClient(id, secret string) Option {
+	return func(p *Provider) {
+		p.ClientID = id
+		p.ClientSecret = secret
+	}
+}
+
+func WithListenerConstructor(fn hostserver.ListenerConstructor) Option {
+	return func(p *Provider) {
+		p.listenerConstructor = fn
+	}
+}
+
+// New starts an OpenID Connect provider on a random local port. Kratos reaches
+// it through testcontainers host access, the test process through loopback.
+func New(id string, opts ...Option) (*Provider, error) {
+	prov := &Provider{
+		ID:                  id,
+		ClientID:            id + "-client",
+		ClientSecret:        id + "-secret",
+		listenerConstructor: net.Listen,
+		codes:               map[string]grant{},
+		tokens:              map[string]User{},
+	}
+
+	for _, op := range opts {
+		op(prov)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate oidc signing key: %w", err)
+	}
+
+	prov.key = key
+
+	srv, err := hostserver.Start(prov.Handler(), prov.listenerConstructor)
+	if err != nil {
+		return nil, fmt.Errorf("oidc provider: %w", err)
+	}
+
+	prov.server = srv
+	prov.issuer = srv.URL()
+	prov.browserURL = srv.LocalURL()
+
+	return prov, nil
+}
+
+func (p *Provider) Port() int {
+	return p.server.Port()
+}
+
+// IssuerURL is the provider address as seen from inside the Kratos container.
+func (p *Provider) IssuerURL() string {
+	return p.issuer
+}
+
+// BrowserURL is the provider address as seen from the test process.
+func (p *Provider) BrowserURL() string {
+	return p.browserURL
+}
+
+// AddUser adds users, replacing known ones with the same subject.
+func (p *Provider) AddUser(users ...User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, user := range users {
+		idx := slices.IndexFunc(p.users, func(known User) bool {
+			return known.Subject == user.Subject
+		})
+		if idx < 0 {
+			p.users = append(p.users, user)
+
+			continue
+		}
+
+		p.users[idx] = user
+	}
+}
+
+func (p *Provider) Close() error {
+	if err := p.server.Close(); err != nil {
+		return fmt.Errorf("oidc provider: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /userinfo", p.userinfo)
+
+	return mux
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.browserURL + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"userinfo_endpoint":                     p.issuer + "/userinfo",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	pub := p.key.PublicKey
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]any{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.ID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+
+		return
+	}
+
+	user, err := p.lookup(query.Get("login_hint"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	code := randomString()
+
+	p.mu.Lock()
+	p.codes[code] = grant{user: user, clientID: query.Get("client_id"), nonce: query.Get("nonce")}
+	p.mu.Unlock()
+
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_request"})
+
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	p.mu.Lock()
+	grnt, found := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !found || clientID != p.ClientID || secret != p.ClientSecret || grnt.clientID != clientID {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+
+		return
+	}
+
+	idToken, err := p.IDToken(grnt.user, clientID, grnt.nonce)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "server_error"})
+
+		return
+	}
+
+	access := randomString()
+
+	p.mu.Lock()
+	p.tokens[access] = grnt.user
+	p.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) userinfo(w http.ResponseWriter, r *http.Request) {
+	const prefix = "Bearer "
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len(prefix) {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	p.mu.Lock()
+	user, ok := p.tokens[auth[len(prefix):]]
+	p.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user.claims())
+}
+
+// IDToken signs an RS256 id token for user the same way the token endpoint does.
+func (p *Provider) IDToken(user User, audience, nonce string) (string, error) {
+	now := time.Now()
+
+	claims := user.claims()
+	claims["iss"] = p.issuer
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(tokenLifetime).Unix()
+
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": p.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token header: %w", err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *Provider) PublicKey() *rsa.PublicKey {
+	return &p.key.PublicKey
+}
+
+func (p *Provider) lookup(subject string) (User, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.users) == 0 {
+		return User{}, ErrNoUsers
+	}
+
+	if subject == "" {
+		return p.users[0], nil
+	}
+
+	for _, user := range p.users {
+		if user.Subject == subject {
+			return user, nil
+		}
+	}
+
+	return User{}, fmt.Errorf("%w: %s", ErrUnknownUser, subject)
+}
+
+func (u User) claims() map[string]any {
+	claims := make(map[string]any, len(u.Claims)+1)
+
+	for key, val := range u.Claims {
+		claims[key] = val
+	}
+
+	claims["sub"] = u.Subject
+
+	return claims
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func randomString() string {
+	const size = 24
+
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
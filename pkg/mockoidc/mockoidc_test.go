@@ -0,0 +1,234 @@
+package mockoidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProvider(t *testing.T, opts ...Option) *Provider {
+	t.Helper()
+
+	prov, err := New("mock", opts...)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = prov.Close()
+	})
+
+	return prov
+}
+
+func noRedirect() *http.Client {
+	return &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func authorize(t *testing.T, prov *Provider, hint string) *http.Response {
+	t.Helper()
+
+	query := url.Values{
+		"client_id":    {prov.ClientID},
+		"redirect_uri": {"http://localhost:4433/callback"},
+		"state":        {"state"},
+		"nonce":        {"nonce"},
+		"login_hint":   {hint},
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet,
+		prov.BrowserURL()+"/authorize?"+query.Encode(), nil)
+	require.NoError(t, err)
+
+	resp, err := noRedirect().Do(req)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	return resp
+}
+
+func exchange(t *testing.T, prov *Provider, code, secret string) (*http.Response, map[string]any) {
+	t.Helper()
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {code}}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost,
+		prov.BrowserURL()+"/token", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(prov.ClientID, secret)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body := map[string]any{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return resp, body
+}
+
+func TestProvider(t *testing.T) {
+	user := User{Subject: uuid.NewString(), Claims: map[string]any{"email": "user@example.com"}}
+
+	t.Run("should be able to serve discovery", func(t *testing.T) {
+		prov := newProvider(t)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet,
+			prov.BrowserURL()+"/.well-known/openid-configuration", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		doc := map[string]any{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+		assert.Equal(t, prov.IssuerURL(), doc["issuer"])
+		assert.Equal(t, prov.BrowserURL()+"/authorize", doc["authorization_endpoint"])
+		assert.Equal(t, prov.IssuerURL()+"/token", doc["token_endpoint"])
+	})
+
+	t.Run("should be able to issue signed id token for hinted user", func(t *testing.T) {
+		prov := newProvider(t, WithUsers(User{Subject: "other"}))
+		prov.AddUser(user)
+
+		resp := authorize(t, prov, user.Subject)
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+
+		location, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "state", location.Query().Get("state"))
+
+		resp, body := exchange(t, prov, location.Query().Get("code"), prov.ClientSecret)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		claims := verify(t, prov.PublicKey(), body["id_token"].(string))
+		assert.Equal(t, user.Subject, claims["sub"])
+		assert.Equal(t, "user@example.com", claims["email"])
+		assert.Equal(t, "nonce", claims["nonce"])
+		assert.Equal(t, prov.ClientID, claims["aud"])
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, prov.BrowserURL()+"/userinfo", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+body["access_token"].(string))
+
+		info, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		defer func() {
+			_ = info.Body.Close()
+		}()
+
+		assert.Equal(t, http.StatusOK, info.StatusCode)
+	})
+
+	t.Run("should be able to replace user with same subject", func(t *testing.T) {
+		prov := newProvider(t, WithUsers(user))
+		prov.AddUser(User{Subject: user.Subject, Claims: map[string]any{"email": "changed@example.com"}})
+
+		found, err := prov.lookup(user.Subject)
+		require.NoError(t, err)
+		assert.Equal(t, "changed@example.com", found.Claims["email"])
+	})
+
+	t.Run("should be able to pick first user without hint", func(t *testing.T) {
+		prov := newProvider(t, WithUsers(user), WithClient("client", "secret"))
+
+		resp := authorize(t, prov, "")
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "client", prov.ClientID)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when user is unknown", func(t *testing.T) {
+			prov := newProvider(t, WithUsers(user))
+			assert.Equal(t, http.StatusBadRequest, authorize(t, prov, "absent").StatusCode)
+		})
+
+		t.Run("when there are no users", func(t *testing.T) {
+			prov := newProvider(t)
+			assert.Equal(t, http.StatusBadRequest, authorize(t, prov, "").StatusCode)
+		})
+
+		t.Run("when client secret is wrong", func(t *testing.T) {
+			prov := newProvider(t, WithUsers(user))
+
+			location, err := url.Parse(authorize(t, prov, "").Header.Get("Location"))
+			require.NoError(t, err)
+
+			resp, _ := exchange(t, prov, location.Query().Get("code"), "wrong")
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+
+		t.Run("when access token is unknown", func(t *testing.T) {
+			prov := newProvider(t)
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, prov.BrowserURL()+"/userinfo", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer absent")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		})
+
+		t.Run("when cant listen", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := New("mock", WithListenerConstructor(func(string, string) (net.Listener, error) {
+				return nil, expErr
+			}))
+			require.ErrorIs(t, err, expErr)
+		})
+	})
+}
+
+func verify(t *testing.T, key *rsa.PublicKey, token string) map[string]any {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+
+	claims := map[string]any{}
+	require.NoError(t, json.Unmarshal(payload, &claims))
+
+	return claims
+}
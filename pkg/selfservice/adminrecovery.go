@@ -0,0 +1,137 @@
+package selfservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+const (
+	flowTypeAPI     = "api"
+	flowTypeBrowser = "browser"
+)
+
+var ErrNoRecoveryFlow = errors.New("recovery link does not name a flow")
+
+type (
+	// AdminRecovery mints a recovery code or link for IdentityID through the
+	// admin API the way support tooling does. Method defaults to code and
+	// ExpiresIn, e.g. "1h", to the Kratos configuration.
+	AdminRecovery struct {
+		IdentityID string
+		Method     string
+		ExpiresIn  string
+	}
+
+	// Minted is what the admin API hands out: the code to enter in Flow, or
+	// a link to open.
+	Minted struct {
+		Link string
+		Code string
+		Flow string
+	}
+)
+
+// Mint asks Kratos for a recovery code or link of flowType, api or browser.
+// Links are always for browsers.
+func (r AdminRecovery) Mint(ctx context.Context, admin *client.APIClient, flowType string) (*Minted, error) {
+	if r.method() == MethodLink {
+		body := client.CreateRecoveryLinkForIdentityBody{IdentityId: r.IdentityID}
+		if r.ExpiresIn != "" {
+			body.ExpiresIn = client.PtrString(r.ExpiresIn)
+		}
+
+		res, resp, err := admin.IdentityAPI.CreateRecoveryLinkForIdentity(ctx).
+			CreateRecoveryLinkForIdentityBody(body).
+			Execute()
+		if err := closed(resp, err); err != nil {
+			return nil, fmt.Errorf("failed to create recovery link: %w", err)
+		}
+
+		return &Minted{Link: res.RecoveryLink}, nil
+	}
+
+	body := client.CreateRecoveryCodeForIdentityBody{
+		IdentityId: r.IdentityID,
+		FlowType:   client.PtrString(flowType),
+	}
+	if r.ExpiresIn != "" {
+		body.ExpiresIn = client.PtrString(r.ExpiresIn)
+	}
+
+	res, resp, err := admin.IdentityAPI.CreateRecoveryCodeForIdentity(ctx).
+		CreateRecoveryCodeForIdentityBody(body).
+		Execute()
+	if err := closed(resp, err); err != nil {
+		return nil, fmt.Errorf("failed to create recovery code: %w", err)
+	}
+
+	link, err := url.Parse(res.RecoveryLink)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse recovery link: %w", err)
+	}
+
+	flow := link.Query().Get("flow")
+	if flow == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoRecoveryFlow, res.RecoveryLink)
+	}
+
+	return &Minted{Link: res.RecoveryLink, Code: res.RecoveryCode, Flow: flow}, nil
+}
+
+// AdminRecover mints a recovery code for a native flow and submits it through
+// front, returning the session Kratos issues for it.
+func AdminRecover(ctx context.Context, front, admin *client.APIClient, rec AdminRecovery) (*Recovered, error) {
+	if rec.method() != MethodCode {
+		return nil, fmt.Errorf("%w: %s recovery via native flow", ErrUnsupportedMethod, rec.method())
+	}
+
+	minted, err := rec.Mint(ctx, admin, flowTypeAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := submitRecoveryCode(ctx, front, minted.Flow, "", minted.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return nativeRecovered(ctx, front, res)
+}
+
+// AdminRecover mints a recovery code or link and consumes it in b, returning
+// the session kept in b.
+func (b *Browser) AdminRecover(ctx context.Context, admin *client.APIClient, rec AdminRecovery) (*Recovered, error) {
+	if rec.method() != MethodCode && rec.method() != MethodLink {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedMethod, rec.Method)
+	}
+
+	minted, err := rec.Mint(ctx, admin, flowTypeBrowser)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec.method() == MethodLink {
+		last, err := b.open(ctx, func(context.Context) (string, error) {
+			return minted.Link, nil
+		})
+
+		return b.recovered(ctx, settingsFrom(last), err)
+	}
+
+	// flows minted by admins skip the csrf check
+	out, err := browserRecovered(submitRecoveryCode(ctx, b.Public, minted.Flow, "", minted.Code))
+
+	return b.recovered(ctx, out, err)
+}
+
+func (r AdminRecovery) method() string {
+	if r.Method == "" {
+		return MethodCode
+	}
+
+	return r.Method
+}
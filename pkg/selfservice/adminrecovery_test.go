@@ -0,0 +1,175 @@
+package selfservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+func newAdminRecoveryKratos(t *testing.T) *recoveryKratos {
+	t.Helper()
+
+	fake := newRecoveryKratos(t)
+
+	known := func(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+		body := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if body["identity_id"] != "known" {
+			writeFake(w, http.StatusNotFound, map[string]any{
+				"error": map[string]any{"code": http.StatusNotFound, "message": "Unable to locate the resource"},
+			})
+
+			return nil, false
+		}
+
+		return body, true
+	}
+
+	fake.Mux.HandleFunc("POST /admin/recovery/code", func(w http.ResponseWriter, r *http.Request) {
+		body, ok := known(w, r)
+		if !ok {
+			return
+		}
+
+		flow := uuid.NewString()
+		if body["flow_type"] == "browser" {
+			flow = fakeBrowserFlow
+		}
+
+		writeFake(w, http.StatusCreated, map[string]any{
+			"recovery_link": "http://ui.invalid/recovery?flow=" + flow,
+			"recovery_code": fakeCode,
+		})
+	})
+
+	fake.Mux.HandleFunc("POST /admin/recovery/link", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := known(w, r); !ok {
+			return
+		}
+
+		link, _ := fake.Link("recovery", "first@example.com")(r.Context())
+		writeFake(w, http.StatusOK, map[string]any{"recovery_link": link})
+	})
+
+	return fake
+}
+
+func TestAdminRecovery_Mint(t *testing.T) {
+	t.Run("should be able to mint code for flow", func(t *testing.T) {
+		fake := newAdminRecoveryKratos(t)
+
+		minted, err := AdminRecovery{IdentityID: "known", ExpiresIn: "1h"}.Mint(t.Context(), fake.Front(), flowTypeBrowser)
+		require.NoError(t, err)
+		assert.Equal(t, fakeCode, minted.Code)
+		assert.Equal(t, fakeBrowserFlow, minted.Flow)
+	})
+
+	t.Run("should be able to mint link", func(t *testing.T) {
+		fake := newAdminRecoveryKratos(t)
+
+		minted, err := AdminRecovery{IdentityID: "known", Method: MethodLink, ExpiresIn: "1h"}.
+			Mint(t.Context(), fake.Front(), flowTypeBrowser)
+		require.NoError(t, err)
+		assert.Contains(t, minted.Link, fake.URL+"/self-service/recovery?token=")
+		assert.Empty(t, minted.Code)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when identity is unknown", func(t *testing.T) {
+			fake := newAdminRecoveryKratos(t)
+
+			for _, method := range []string{MethodCode, MethodLink} {
+				_, err := AdminRecovery{IdentityID: "absent", Method: method}.Mint(t.Context(), fake.Front(), flowTypeAPI)
+
+				var kerr *kratoserr.Error
+				require.ErrorAs(t, err, &kerr)
+				assert.Equal(t, http.StatusNotFound, kerr.Status)
+			}
+		})
+
+		t.Run("when link names no flow", func(t *testing.T) {
+			fake := newFakeKratos(t)
+			fake.Mux.HandleFunc("POST /admin/recovery/code", func(w http.ResponseWriter, r *http.Request) {
+				writeFake(w, http.StatusCreated, map[string]any{"recovery_link": "http://ui.invalid/", "recovery_code": fakeCode})
+			})
+
+			_, err := AdminRecovery{IdentityID: "known"}.Mint(t.Context(), fake.Front(), flowTypeAPI)
+			require.ErrorIs(t, err, ErrNoRecoveryFlow)
+		})
+	})
+}
+
+func TestAdminRecover(t *testing.T) {
+	t.Run("should be able to recover natively", func(t *testing.T) {
+		fake := newAdminRecoveryKratos(t)
+
+		res, err := AdminRecover(t.Context(), fake.Front(), fake.Front(), AdminRecovery{IdentityID: "known"})
+		require.NoError(t, err)
+		assert.NotEmpty(t, res.SessionToken)
+		assert.Equal(t, fakeSettingsFlow, res.SettingsFlow)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when link is requested natively", func(t *testing.T) {
+			fake := newAdminRecoveryKratos(t)
+
+			_, err := AdminRecover(t.Context(), fake.Front(), fake.Front(), AdminRecovery{
+				IdentityID: "known",
+				Method:     MethodLink,
+			})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when identity is unknown", func(t *testing.T) {
+			fake := newAdminRecoveryKratos(t)
+
+			_, err := AdminRecover(t.Context(), fake.Front(), fake.Front(), AdminRecovery{IdentityID: "absent"})
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestBrowser_AdminRecover(t *testing.T) {
+	for _, method := range []string{MethodCode, MethodLink} {
+		t.Run("should be able to recover with "+method, func(t *testing.T) {
+			fake := newAdminRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			res, err := browser.AdminRecover(t.Context(), fake.Front(), AdminRecovery{IdentityID: "known", Method: method})
+			require.NoError(t, err)
+			assert.Equal(t, fakeSettingsFlow, res.SettingsFlow)
+			assert.Equal(t, "first@example.com", res.Session.GetIdentity().Traits.(map[string]any)["email"])
+		})
+	}
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when method is unknown", func(t *testing.T) {
+			fake := newAdminRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.AdminRecover(t.Context(), fake.Front(), AdminRecovery{IdentityID: "known", Method: "sms"})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when identity is unknown", func(t *testing.T) {
+			fake := newAdminRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.AdminRecover(t.Context(), fake.Front(), AdminRecovery{IdentityID: "absent"})
+			require.Error(t, err)
+		})
+	})
+}
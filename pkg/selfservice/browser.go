@@ -0,0 +1,129 @@
+package selfservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+var (
+	ErrNoRedirect     = errors.New("kratos did not request a browser redirect")
+	ErrFlowIncomplete = errors.New("browser flow ended without a session")
+)
+
+type Browser struct {
+	Public *client.APIClient
+	HTTP   *http.Client
+
+	trusted map[string]bool
+}
+
+// NewBrowser returns a cookie-keeping client for browser flows against the
+// same public endpoint as front.
+func NewBrowser(front *client.APIClient) (*Browser, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
+	}
+
+	src := front.GetConfig()
+
+	browser := &Browser{
+		trusted: map[string]bool{src.Host: true},
+	}
+
+	browser.HTTP = &http.Client{
+		Jar:           jar,
+		CheckRedirect: browser.checkRedirect,
+	}
+
+	cfg := client.NewConfiguration()
+	cfg.Host = src.Host
+	cfg.Scheme = src.Scheme
+	cfg.HTTPClient = browser.HTTP
+
+	browser.Public = client.NewAPIClient(cfg)
+
+	return browser, nil
+}
+
+// Trust lets redirects to host be followed. Redirects anywhere else, like UI
+// urls from kratos.yaml, stop the browser.
+func (b *Browser) Trust(hosts ...string) {
+	for _, host := range hosts {
+		b.trusted[host] = true
+	}
+}
+
+func (b *Browser) Session(ctx context.Context) (*client.Session, error) {
+	session, resp, err := b.Public.FrontendAPI.ToSession(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFlowIncomplete, err)
+	}
+
+	_ = resp.Body.Close()
+
+	return session, nil
+}
+
+// Follow walks redirects starting at location until they leave trusted hosts
+// and returns the last visited url.
+func (b *Browser) Follow(ctx context.Context, location string) (*url.URL, error) {
+	resp, err := b.visit(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Request.URL, nil
+}
+
+// visit is Follow returning the last response with its body drained.
+func (b *Browser) visit(ctx context.Context, location string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build browser request: %w", err)
+	}
+
+	resp, err := b.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow %s: %w", location, err)
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return resp, nil
+}
+
+func (b *Browser) checkRedirect(req *http.Request, _ []*http.Request) error {
+	if !b.trusted[req.URL.Host] {
+		return http.ErrUseLastResponse
+	}
+
+	return nil
+}
+
+func redirectFrom(err error) (string, error) {
+	if err == nil {
+		return "", ErrNoRedirect
+	}
+
+	res, ok := kratoserr.Parse(err)
+	if !ok {
+		return "", err
+	}
+
+	if res.Redirect == "" {
+		return "", fmt.Errorf("%w: %w", ErrNoRedirect, err)
+	}
+
+	return res.Redirect, nil
+}
@@ -0,0 +1,150 @@
+package selfservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+)
+
+const (
+	fakeCSRF          = "fake-csrf"
+	fakeSessionCookie = "ory_kratos_session"
+)
+
+// fakeKratos imitates the public Kratos endpoints the helpers talk to.
+type fakeKratos struct {
+	*httptest.Server
+
+	Mux *http.ServeMux
+
+	mu       sync.Mutex
+	sessions map[string]map[string]any
+}
+
+func newFakeKratos(t *testing.T) *fakeKratos {
+	t.Helper()
+
+	fake := &fakeKratos{
+		Mux:      http.NewServeMux(),
+		sessions: map[string]map[string]any{},
+	}
+	fake.Server = httptest.NewServer(fake.Mux)
+
+	fake.Mux.HandleFunc("GET /sessions/whoami", fake.whoami)
+
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+func (f *fakeKratos) Front() *client.APIClient {
+	addr, _ := url.Parse(f.URL)
+
+	cfg := client.NewConfiguration()
+	cfg.Host = addr.Host
+	cfg.Scheme = addr.Scheme
+
+	return client.NewAPIClient(cfg)
+}
+
+// Issue stores a session for traits and returns its token, also usable as a cookie value.
+func (f *fakeKratos) Issue(traits map[string]any) string {
+	token := uuid.NewString()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sessions[token] = map[string]any{
+		"id":     uuid.NewString(),
+		"active": true,
+		"identity": map[string]any{
+			"id":         uuid.NewString(),
+			"schema_id":  "user",
+			"schema_url": f.URL + "/schemas/user",
+			"traits":     traits,
+		},
+	}
+
+	return token
+}
+
+func (f *fakeKratos) SetSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{Name: fakeSessionCookie, Value: token, Path: "/"})
+}
+
+// Lookup finds the session of a request by its token header or cookie.
+func (f *fakeKratos) Lookup(r *http.Request) (string, map[string]any, bool) {
+	token := r.Header.Get("X-Session-Token")
+	if cookie, err := r.Cookie(fakeSessionCookie); err == nil {
+		token = cookie.Value
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.sessions[token]
+
+	return token, session, ok
+}
+
+func (f *fakeKratos) whoami(w http.ResponseWriter, r *http.Request) {
+	_, session, ok := f.Lookup(r)
+	if !ok {
+		writeFake(w, http.StatusUnauthorized, map[string]any{
+			"error": map[string]any{"code": http.StatusUnauthorized, "message": "No valid session"},
+		})
+
+		return
+	}
+
+	writeFake(w, http.StatusOK, session)
+}
+
+func (f *fakeKratos) Flow(kind string, nodes ...map[string]any) map[string]any {
+	now := time.Now()
+
+	nodes = append(nodes, fakeInput("default", "csrf_token", fakeCSRF))
+
+	return map[string]any{
+		"id":          uuid.NewString(),
+		"type":        kind,
+		"state":       "choose_method",
+		"issued_at":   now,
+		"expires_at":  now.Add(time.Hour),
+		"request_url": f.URL,
+		"ui": map[string]any{
+			"action": f.URL,
+			"method": http.MethodPost,
+			"nodes":  nodes,
+		},
+	}
+}
+
+func fakeInput(group, name string, value any) map[string]any {
+	return map[string]any{
+		"type":     "input",
+		"group":    group,
+		"messages": []any{},
+		"meta":     map[string]any{},
+		"attributes": map[string]any{
+			"node_type": "input",
+			"name":      name,
+			"type":      "hidden",
+			"value":     value,
+			"disabled":  false,
+		},
+	}
+}
+
+func writeFake(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,94 @@
+package selfservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+var ErrLogoutFailed = errors.New("kratos refused to log out")
+
+// Logout revokes the session of token the way native apps sign out.
+func Logout(ctx context.Context, front *client.APIClient, token string) error {
+	resp, err := front.FrontendAPI.PerformNativeLogout(ctx).
+		PerformNativeLogoutBody(*client.NewPerformNativeLogoutBody(token)).
+		Execute()
+	if err := closed(resp, err); err != nil {
+		return fmt.Errorf("failed to log out: %w", err)
+	}
+
+	return nil
+}
+
+// Logout walks a browser logout flow, leaving b without its session cookie.
+func (b *Browser) Logout(ctx context.Context) error {
+	flow, resp, err := b.Public.FrontendAPI.CreateBrowserLogoutFlow(ctx).Execute()
+	if err := closed(resp, err); err != nil {
+		return fmt.Errorf("failed to create logout flow: %w", err)
+	}
+
+	resp, err = b.visit(ctx, flow.LogoutUrl)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%w: %s", ErrLogoutFailed, resp.Status)
+	}
+
+	return nil
+}
+
+// Cookies are what b sends to the public endpoint, e.g. to replay a session
+// cookie after Logout.
+func (b *Browser) Cookies() []*http.Cookie {
+	cfg := b.Public.GetConfig()
+
+	return b.HTTP.Jar.Cookies(&url.URL{Scheme: cfg.Scheme, Host: cfg.Host, Path: "/"})
+}
+
+// RevokeOtherSessions revokes every session of the identity behind token but
+// that one and returns how many were revoked.
+func RevokeOtherSessions(ctx context.Context, front *client.APIClient, token string) (int64, error) {
+	res, resp, err := front.FrontendAPI.DisableMyOtherSessions(ctx).XSessionToken(token).Execute()
+	if err := closed(resp, err); err != nil {
+		return 0, fmt.Errorf("failed to revoke other sessions: %w", err)
+	}
+
+	return res.GetCount(), nil
+}
+
+// RevokeOtherSessions is the browser counterpart of RevokeOtherSessions.
+func (b *Browser) RevokeOtherSessions(ctx context.Context) (int64, error) {
+	res, resp, err := b.Public.FrontendAPI.DisableMyOtherSessions(ctx).Execute()
+	if err := closed(resp, err); err != nil {
+		return 0, fmt.Errorf("failed to revoke other sessions: %w", err)
+	}
+
+	return res.GetCount(), nil
+}
+
+// RevokeSession deactivates the session with id through the admin API.
+func RevokeSession(ctx context.Context, admin *client.APIClient, id string) error {
+	resp, err := admin.IdentityAPI.DisableSession(ctx, id).Execute()
+	if err := closed(resp, err); err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// RevokeIdentitySessions deletes every session of the identity with id
+// through the admin API.
+func RevokeIdentitySessions(ctx context.Context, admin *client.APIClient, id string) error {
+	resp, err := admin.IdentityAPI.DeleteIdentitySessions(ctx, id).Execute()
+	if err := closed(resp, err); err != nil {
+		return fmt.Errorf("failed to revoke sessions of identity %s: %w", id, err)
+	}
+
+	return nil
+}
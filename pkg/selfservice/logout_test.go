@@ -0,0 +1,319 @@
+package selfservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+// logoutKratos is a fake Kratos revoking sessions on logout and through the
+// session endpoints.
+type logoutKratos struct {
+	*fakeKratos
+}
+
+func newLogoutKratos(t *testing.T) *logoutKratos {
+	t.Helper()
+
+	fake := &logoutKratos{fakeKratos: newFakeKratos(t)}
+
+	unauthorized := func(w http.ResponseWriter) {
+		writeFake(w, http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": http.StatusUnauthorized}})
+	}
+
+	fake.Mux.HandleFunc("DELETE /self-service/logout/api", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if fake.revoke(func(token string, _ map[string]any) bool { return token == body["session_token"] }) == 0 {
+			unauthorized(w)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fake.Mux.HandleFunc("GET /self-service/logout/browser", func(w http.ResponseWriter, r *http.Request) {
+		token, _, ok := fake.Lookup(r)
+		if !ok {
+			unauthorized(w)
+
+			return
+		}
+
+		writeFake(w, http.StatusOK, map[string]any{
+			"logout_url":   fake.URL + "/self-service/logout?token=" + token,
+			"logout_token": token,
+		})
+	})
+	fake.Mux.HandleFunc("GET /self-service/logout", func(w http.ResponseWriter, r *http.Request) {
+		logout := r.URL.Query().Get("token")
+		if fake.revoke(func(token string, _ map[string]any) bool { return token == logout }) == 0 {
+			writeFake(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": http.StatusBadRequest}})
+
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: fakeSessionCookie, Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "http://ui.invalid/login", http.StatusSeeOther)
+	})
+	fake.Mux.HandleFunc("DELETE /sessions", func(w http.ResponseWriter, r *http.Request) {
+		current, session, ok := fake.Lookup(r)
+		if !ok {
+			unauthorized(w)
+
+			return
+		}
+
+		owner := identityOf(session)
+		count := fake.revoke(func(token string, session map[string]any) bool {
+			return token != current && identityOf(session) == owner
+		})
+
+		writeFake(w, http.StatusOK, map[string]any{"count": count})
+	})
+	fake.Mux.HandleFunc("DELETE /admin/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if fake.revoke(func(_ string, session map[string]any) bool { return session["id"] == r.PathValue("id") }) == 0 {
+			writeFake(w, http.StatusNotFound, map[string]any{"error": map[string]any{"code": http.StatusNotFound}})
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fake.Mux.HandleFunc("DELETE /admin/identities/{id}/sessions", func(w http.ResponseWriter, r *http.Request) {
+		fake.revoke(func(_ string, session map[string]any) bool { return identityOf(session) == r.PathValue("id") })
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return fake
+}
+
+// Another signs the identity behind token in once more.
+func (f *logoutKratos) Another(token string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	another := uuid.NewString()
+	f.sessions[another] = map[string]any{
+		"id":       uuid.NewString(),
+		"active":   true,
+		"identity": f.sessions[token]["identity"],
+	}
+
+	return another
+}
+
+func (f *logoutKratos) SessionID(token string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.sessions[token]["id"].(string)
+}
+
+func (f *logoutKratos) Active(token string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.sessions[token]
+
+	return ok
+}
+
+func (f *logoutKratos) revoke(match func(token string, session map[string]any) bool) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	count := 0
+
+	for token, session := range f.sessions {
+		if match(token, session) {
+			delete(f.sessions, token)
+			count++
+		}
+	}
+
+	return count
+}
+
+func identityOf(session map[string]any) string {
+	return session["identity"].(map[string]any)["id"].(string)
+}
+
+func TestLogout(t *testing.T) {
+	t.Run("should be able to log out natively", func(t *testing.T) {
+		fake := newLogoutKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		require.NoError(t, Logout(t.Context(), fake.Front(), token))
+		assert.False(t, fake.Active(token))
+	})
+
+	t.Run("should be able to log out in browser", func(t *testing.T) {
+		fake := newLogoutKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		fake.Mux.HandleFunc("GET /signin", func(w http.ResponseWriter, r *http.Request) {
+			fake.SetSessionCookie(w, token)
+		})
+
+		_, err = browser.Follow(t.Context(), fake.URL+"/signin")
+		require.NoError(t, err)
+		require.Len(t, browser.Cookies(), 1)
+
+		require.NoError(t, browser.Logout(t.Context()))
+		assert.False(t, fake.Active(token))
+		assert.Empty(t, browser.Cookies())
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when token is unknown", func(t *testing.T) {
+			fake := newLogoutKratos(t)
+
+			err := Logout(t.Context(), fake.Front(), "absent")
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusUnauthorized, kerr.Status)
+		})
+
+		t.Run("when browser is signed out", func(t *testing.T) {
+			fake := newLogoutKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			require.Error(t, browser.Logout(t.Context()))
+		})
+
+		t.Run("when logout url is refused", func(t *testing.T) {
+			fake := newFakeKratos(t)
+			fake.Mux.HandleFunc("GET /self-service/logout/browser", func(w http.ResponseWriter, r *http.Request) {
+				writeFake(w, http.StatusOK, map[string]any{"logout_url": fake.URL + "/refused", "logout_token": "token"})
+			})
+			fake.Mux.HandleFunc("GET /refused", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			})
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			require.ErrorIs(t, browser.Logout(t.Context()), ErrLogoutFailed)
+		})
+	})
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	t.Run("should be able to keep only current session", func(t *testing.T) {
+		fake := newLogoutKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+		other := fake.Another(token)
+		stranger := fake.Issue(map[string]any{"email": "second@example.com"})
+
+		count, err := RevokeOtherSessions(t.Context(), fake.Front(), token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		assert.True(t, fake.Active(token))
+		assert.False(t, fake.Active(other))
+		assert.True(t, fake.Active(stranger))
+	})
+
+	t.Run("should be able to keep only current session in browser", func(t *testing.T) {
+		fake := newLogoutKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+		other := fake.Another(token)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		fake.Mux.HandleFunc("GET /signin", func(w http.ResponseWriter, r *http.Request) {
+			fake.SetSessionCookie(w, token)
+		})
+
+		_, err = browser.Follow(t.Context(), fake.URL+"/signin")
+		require.NoError(t, err)
+
+		count, err := browser.RevokeOtherSessions(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		assert.False(t, fake.Active(other))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when token is unknown", func(t *testing.T) {
+			fake := newLogoutKratos(t)
+
+			_, err := RevokeOtherSessions(t.Context(), fake.Front(), "absent")
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusUnauthorized, kerr.Status)
+		})
+
+		t.Run("when browser is signed out", func(t *testing.T) {
+			fake := newLogoutKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.RevokeOtherSessions(t.Context())
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestRevokeSession(t *testing.T) {
+	t.Run("should be able to revoke single session", func(t *testing.T) {
+		fake := newLogoutKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+		other := fake.Another(token)
+
+		require.NoError(t, RevokeSession(t.Context(), fake.Front(), fake.SessionID(token)))
+		assert.False(t, fake.Active(token))
+		assert.True(t, fake.Active(other))
+	})
+
+	t.Run("should be able to revoke all sessions of identity", func(t *testing.T) {
+		fake := newLogoutKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+		other := fake.Another(token)
+		stranger := fake.Issue(map[string]any{"email": "second@example.com"})
+
+		fake.mu.Lock()
+		id := identityOf(fake.sessions[token])
+		fake.mu.Unlock()
+
+		require.NoError(t, RevokeIdentitySessions(t.Context(), fake.Front(), id))
+		assert.False(t, fake.Active(token))
+		assert.False(t, fake.Active(other))
+		assert.True(t, fake.Active(stranger))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when session is unknown", func(t *testing.T) {
+			fake := newLogoutKratos(t)
+
+			err := RevokeSession(t.Context(), fake.Front(), "absent")
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusNotFound, kerr.Status)
+		})
+
+		t.Run("when admin api is unavailable", func(t *testing.T) {
+			fake := newFakeKratos(t)
+
+			require.Error(t, RevokeIdentitySessions(t.Context(), fake.Front(), "absent"))
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package selfservice
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+// LoginWithOIDC signs in through provider as subject, following the redirects
+// between Kratos and the provider the way a browser would. Unknown subjects are
+// registered by Kratos on the way.
+func (b *Browser) LoginWithOIDC(ctx context.Context, provider, subject string) (*client.Session, error) {
+	flow, resp, err := b.Public.FrontendAPI.CreateBrowserLoginFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser login flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	method := client.UpdateLoginFlowWithOidcMethod{
+		Method:    "oidc",
+		Provider:  provider,
+		CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+	}
+
+	if subject != "" {
+		method.UpstreamParameters = map[string]any{"login_hint": subject}
+	}
+
+	_, resp, err = b.Public.FrontendAPI.UpdateLoginFlow(ctx).
+		Flow(flow.Id).
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{UpdateLoginFlowWithOidcMethod: &method}).
+		Execute()
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	location, err := redirectFrom(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit oidc login: %w", err)
+	}
+
+	target, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provider redirect: %w", err)
+	}
+
+	b.Trust(target.Host)
+
+	last, err := b.Follow(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := b.Session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("oidc login stopped at %s: %w", last, err)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,145 @@
+package selfservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/mockoidc"
+)
+
+func newOIDCKratos(t *testing.T, prov *mockoidc.Provider) *fakeKratos {
+	t.Helper()
+
+	fake := newFakeKratos(t)
+
+	fake.Mux.HandleFunc("GET /self-service/login/browser", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: fakeCSRF, Path: "/"})
+		writeFake(w, http.StatusOK, fake.Flow("browser"))
+	})
+
+	fake.Mux.HandleFunc("POST /self-service/login", func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if cookie, err := r.Cookie("csrf_token"); err != nil || cookie.Value != body["csrf_token"] {
+			writeFake(w, http.StatusForbidden, map[string]any{"error": map[string]any{"code": http.StatusForbidden}})
+
+			return
+		}
+
+		hint, _ := body["upstream_parameters"].(map[string]any)["login_hint"].(string)
+		query := url.Values{
+			"client_id":    {prov.ClientID},
+			"redirect_uri": {fake.URL + "/self-service/methods/oidc/callback/" + prov.ID},
+			"state":        {"state"},
+			"login_hint":   {hint},
+		}
+
+		writeFake(w, http.StatusUnprocessableEntity, map[string]any{
+			"redirect_browser_to": prov.BrowserURL() + "/authorize?" + query.Encode(),
+		})
+	})
+
+	callback := "GET /self-service/methods/oidc/callback/{provider}"
+	fake.Mux.HandleFunc(callback, func(w http.ResponseWriter, r *http.Request) {
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {r.URL.Query().Get("code")}}
+
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, prov.BrowserURL()+"/token",
+			strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(prov.ClientID, prov.ClientSecret)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		tokens := map[string]any{}
+		_ = json.NewDecoder(resp.Body).Decode(&tokens)
+
+		idToken, _ := tokens["id_token"].(string)
+		payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(idToken+"..", ".")[1])
+
+		claims := map[string]any{}
+		_ = json.Unmarshal(payload, &claims)
+
+		fake.SetSessionCookie(w, fake.Issue(map[string]any{"email": claims["email"]}))
+		http.Redirect(w, r, "http://ui.invalid/welcome", http.StatusSeeOther)
+	})
+
+	return fake
+}
+
+func TestBrowser_LoginWithOIDC(t *testing.T) {
+	prov, err := mockoidc.New("mock", mockoidc.WithUsers(
+		mockoidc.User{Subject: "first", Claims: map[string]any{"email": "first@example.com"}},
+		mockoidc.User{Subject: "second", Claims: map[string]any{"email": "second@example.com"}},
+	))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = prov.Close()
+	})
+
+	t.Run("should be able to sign in as hinted subject", func(t *testing.T) {
+		fake := newOIDCKratos(t, prov)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		session, err := browser.LoginWithOIDC(t.Context(), prov.ID, "second")
+		require.NoError(t, err)
+		assert.Equal(t, "second@example.com", session.GetIdentity().Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when provider rejects subject", func(t *testing.T) {
+			fake := newOIDCKratos(t, prov)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.LoginWithOIDC(t.Context(), prov.ID, "absent")
+			require.ErrorIs(t, err, ErrFlowIncomplete)
+		})
+
+		t.Run("when kratos does not redirect", func(t *testing.T) {
+			fake := newFakeKratos(t)
+			fake.Mux.HandleFunc("GET /self-service/login/browser", func(w http.ResponseWriter, r *http.Request) {
+				writeFake(w, http.StatusOK, fake.Flow("browser"))
+			})
+			fake.Mux.HandleFunc("POST /self-service/login", func(w http.ResponseWriter, r *http.Request) {
+				writeFake(w, http.StatusUnprocessableEntity, map[string]any{})
+			})
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.LoginWithOIDC(t.Context(), prov.ID, "")
+			require.ErrorIs(t, err, ErrNoRedirect)
+		})
+
+		t.Run("when flow cant be created", func(t *testing.T) {
+			fake := newFakeKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.LoginWithOIDC(t.Context(), prov.ID, "")
+			require.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,445 @@
+package selfservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const (
+	MethodLink = "link"
+
+	statePassedChallenge = "passed_challenge"
+)
+
+type (
+	// Recovery describes a recovery flow for Email. Method defaults to code.
+	// Code and Link return what Kratos mailed, see courier.Outbox.CodeFor and
+	// courier.Outbox.LinkFor.
+	Recovery struct {
+		Email  string
+		Method string
+		Code   func(ctx context.Context) (string, error)
+		Link   func(ctx context.Context) (string, error)
+	}
+
+	// Verification describes a verification flow with the same fields as Recovery.
+	Verification Recovery
+
+	// Recovered is the privileged session a recovery ends with and the
+	// settings flow Kratos continues with.
+	Recovered struct {
+		Session      *client.Session
+		SessionToken string
+		SettingsFlow string
+	}
+)
+
+// RecoveryPatch enables recovery and verification flows using method, which
+// is code or link.
+func RecoveryPatch(method string) kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		for path, val := range map[string]any{
+			"selfservice.methods." + method + ".enabled": true,
+			"selfservice.flows.recovery.enabled":         true,
+			"selfservice.flows.recovery.use":             method,
+			"selfservice.flows.verification.enabled":     true,
+			"selfservice.flows.verification.use":         method,
+		} {
+			if err := cfg.Set(path, val); err != nil {
+				return fmt.Errorf("failed to enable recovery: %w", err)
+			}
+		}
+
+		return nil
+	}
+}
+
+// Recover runs a native recovery flow with the code method and returns the
+// session Kratos issues for it.
+func Recover(ctx context.Context, front *client.APIClient, rec Recovery) (*Recovered, error) {
+	if rec.method() != MethodCode {
+		return nil, fmt.Errorf("%w: %s recovery via native flow", ErrUnsupportedMethod, rec.method())
+	}
+
+	flow, resp, err := front.FrontendAPI.CreateNativeRecoveryFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create native recovery flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	res, err := rec.challenge(ctx, front, flow)
+	if err != nil {
+		return nil, err
+	}
+
+	return nativeRecovered(ctx, front, res)
+}
+
+// nativeRecovered reads the session token a native recovery flow continues
+// with and loads its session.
+func nativeRecovered(ctx context.Context, front *client.APIClient, res *client.RecoveryFlow) (*Recovered, error) {
+	out := continued(res.ContinueWith)
+	if out.SessionToken == "" {
+		return nil, fmt.Errorf("%w: recovery flow %s is %v", ErrFlowIncomplete, res.Id, res.State)
+	}
+
+	session, resp, err := front.FrontendAPI.ToSession(ctx).XSessionToken(out.SessionToken).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFlowIncomplete, err)
+	}
+
+	_ = resp.Body.Close()
+
+	out.Session = session
+
+	return out, nil
+}
+
+// browserRecovered reads the settings flow a browser recovery continues with,
+// either from the flow or from the redirect Kratos answers JSON clients with.
+func browserRecovered(res *client.RecoveryFlow, err error) (*Recovered, error) {
+	if err == nil {
+		return continued(res.ContinueWith), nil
+	}
+
+	location, err := redirectFrom(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return settingsFrom(location), nil
+}
+
+// Recover runs a browser recovery flow with the code or link method and
+// returns the session kept in b.
+func (b *Browser) Recover(ctx context.Context, rec Recovery) (*Recovered, error) {
+	flow, resp, err := b.Public.FrontendAPI.CreateBrowserRecoveryFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser recovery flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	var out *Recovered
+
+	switch rec.method() {
+	case MethodCode:
+		out, err = b.recoverWithCode(ctx, flow, rec)
+	case MethodLink:
+		out, err = b.recoverWithLink(ctx, flow, rec)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnsupportedMethod, rec.Method)
+	}
+
+	return b.recovered(ctx, out, err)
+}
+
+// recovered attaches the session b ended up with to out.
+func (b *Browser) recovered(ctx context.Context, out *Recovered, err error) (*Recovered, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := b.Session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("recovery ended without a session: %w", err)
+	}
+
+	out.Session = session
+
+	return out, nil
+}
+
+func (b *Browser) recoverWithCode(ctx context.Context, flow *client.RecoveryFlow, rec Recovery) (*Recovered, error) {
+	return browserRecovered(rec.challenge(ctx, b.Public, flow))
+}
+
+func (b *Browser) recoverWithLink(ctx context.Context, flow *client.RecoveryFlow, rec Recovery) (*Recovered, error) {
+	if err := rec.send(ctx, b.Public, flow); err != nil {
+		return nil, err
+	}
+
+	last, err := b.open(ctx, rec.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	return settingsFrom(last), nil
+}
+
+// Verify runs a native verification flow with the code method.
+func Verify(ctx context.Context, front *client.APIClient, ver Verification) error {
+	if Recovery(ver).method() != MethodCode {
+		return fmt.Errorf("%w: %s verification via native flow", ErrUnsupportedMethod, Recovery(ver).method())
+	}
+
+	flow, resp, err := front.FrontendAPI.CreateNativeVerificationFlow(ctx).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to create native verification flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	return ver.verifyWithCode(ctx, front, flow)
+}
+
+// Verify runs a browser verification flow with the code or link method.
+func (b *Browser) Verify(ctx context.Context, ver Verification) error {
+	flow, resp, err := b.Public.FrontendAPI.CreateBrowserVerificationFlow(ctx).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to create browser verification flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	switch Recovery(ver).method() {
+	case MethodCode:
+		return ver.verifyWithCode(ctx, b.Public, flow)
+	case MethodLink:
+		if err := ver.send(ctx, b.Public, flow); err != nil {
+			return err
+		}
+
+		_, err := b.open(ctx, ver.Link)
+
+		return err
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedMethod, ver.Method)
+	}
+}
+
+func (r Recovery) method() string {
+	if r.Method == "" {
+		return MethodCode
+	}
+
+	return r.Method
+}
+
+// challenge requests a code for r.Email and submits it.
+func (r Recovery) challenge(
+	ctx context.Context, public *client.APIClient, flow *client.RecoveryFlow,
+) (*client.RecoveryFlow, error) {
+	if err := r.send(ctx, public, flow); err != nil {
+		return nil, err
+	}
+
+	if r.Code == nil {
+		return nil, fmt.Errorf("%w: code source is not set", ErrUnsupportedMethod)
+	}
+
+	code, err := r.Code(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive recovery code: %w", err)
+	}
+
+	return submitRecoveryCode(ctx, public, flow.Id, CSRFToken(flow.Ui), code)
+}
+
+func submitRecoveryCode(
+	ctx context.Context, public *client.APIClient, flow, csrf, code string,
+) (*client.RecoveryFlow, error) {
+	res, err := updateRecovery(ctx, public, flow, client.UpdateRecoveryFlowBody{
+		UpdateRecoveryFlowWithCodeMethod: &client.UpdateRecoveryFlowWithCodeMethod{
+			Method:    MethodCode,
+			Code:      client.PtrString(code),
+			CsrfToken: client.PtrString(csrf),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit recovery code: %w", err)
+	}
+
+	return res, nil
+}
+
+func (r Recovery) send(ctx context.Context, public *client.APIClient, flow *client.RecoveryFlow) error {
+	body := client.UpdateRecoveryFlowBody{
+		UpdateRecoveryFlowWithCodeMethod: &client.UpdateRecoveryFlowWithCodeMethod{
+			Method:    MethodCode,
+			Email:     client.PtrString(r.Email),
+			CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+		},
+	}
+
+	if r.method() == MethodLink {
+		body = client.UpdateRecoveryFlowBody{
+			UpdateRecoveryFlowWithLinkMethod: &client.UpdateRecoveryFlowWithLinkMethod{
+				Method:    MethodLink,
+				Email:     r.Email,
+				CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+			},
+		}
+	}
+
+	res, err := updateRecovery(ctx, public, flow.Id, body)
+	if err != nil {
+		return fmt.Errorf("failed to request recovery: %w", err)
+	}
+
+	if res.State != stateSentEmail {
+		return fmt.Errorf("%w: recovery flow %s is %v", ErrCodeNotSent, res.Id, res.State)
+	}
+
+	return nil
+}
+
+func (v Verification) verifyWithCode(
+	ctx context.Context, public *client.APIClient, flow *client.VerificationFlow,
+) error {
+	if err := v.send(ctx, public, flow); err != nil {
+		return err
+	}
+
+	if v.Code == nil {
+		return fmt.Errorf("%w: code source is not set", ErrUnsupportedMethod)
+	}
+
+	code, err := v.Code(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to receive verification code: %w", err)
+	}
+
+	res, err := updateVerification(ctx, public, flow.Id, client.UpdateVerificationFlowBody{
+		UpdateVerificationFlowWithCodeMethod: &client.UpdateVerificationFlowWithCodeMethod{
+			Method:    MethodCode,
+			Code:      client.PtrString(code),
+			CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to submit verification code: %w", err)
+	}
+
+	if res.State != statePassedChallenge {
+		return fmt.Errorf("%w: verification flow %s is %v", ErrFlowIncomplete, res.Id, res.State)
+	}
+
+	return nil
+}
+
+func (v Verification) send(ctx context.Context, public *client.APIClient, flow *client.VerificationFlow) error {
+	body := client.UpdateVerificationFlowBody{
+		UpdateVerificationFlowWithCodeMethod: &client.UpdateVerificationFlowWithCodeMethod{
+			Method:    MethodCode,
+			Email:     client.PtrString(v.Email),
+			CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+		},
+	}
+
+	if Recovery(v).method() == MethodLink {
+		body = client.UpdateVerificationFlowBody{
+			UpdateVerificationFlowWithLinkMethod: &client.UpdateVerificationFlowWithLinkMethod{
+				Method:    MethodLink,
+				Email:     v.Email,
+				CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+			},
+		}
+	}
+
+	res, err := updateVerification(ctx, public, flow.Id, body)
+	if err != nil {
+		return fmt.Errorf("failed to request verification: %w", err)
+	}
+
+	if res.State != stateSentEmail {
+		return fmt.Errorf("%w: verification flow %s is %v", ErrCodeNotSent, res.Id, res.State)
+	}
+
+	return nil
+}
+
+// open visits the link returned by source the way a mail client would and
+// returns where Kratos sent the browser afterwards.
+func (b *Browser) open(ctx context.Context, source func(context.Context) (string, error)) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("%w: link source is not set", ErrUnsupportedMethod)
+	}
+
+	link, err := source(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to receive link: %w", err)
+	}
+
+	target, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse link: %w", err)
+	}
+
+	b.Trust(target.Host)
+
+	resp, err := b.visit(ctx, link)
+	if err != nil {
+		return "", err
+	}
+
+	if next, err := resp.Location(); err == nil {
+		return next.String(), nil
+	}
+
+	return resp.Request.URL.String(), nil
+}
+
+func updateRecovery(
+	ctx context.Context, public *client.APIClient, flow string, body client.UpdateRecoveryFlowBody,
+) (*client.RecoveryFlow, error) {
+	res, resp, err := public.FrontendAPI.UpdateRecoveryFlow(ctx).Flow(flow).UpdateRecoveryFlowBody(body).Execute()
+
+	return res, closed(resp, err)
+}
+
+func updateVerification(
+	ctx context.Context, public *client.APIClient, flow string, body client.UpdateVerificationFlowBody,
+) (*client.VerificationFlow, error) {
+	res, resp, err := public.FrontendAPI.UpdateVerificationFlow(ctx).Flow(flow).UpdateVerificationFlowBody(body).Execute()
+
+	return res, closed(resp, err)
+}
+
+// closed releases resp and types err.
+func closed(resp *http.Response, err error) error {
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return kratoserr.FromResponse(resp, err)
+	}
+
+	return nil
+}
+
+func continued(steps []client.ContinueWith) *Recovered {
+	res := &Recovered{}
+
+	for _, step := range steps {
+		if step.ContinueWithSetOrySessionToken != nil {
+			res.SessionToken = step.ContinueWithSetOrySessionToken.OrySessionToken
+		}
+
+		if step.ContinueWithSettingsUi != nil {
+			res.SettingsFlow = step.ContinueWithSettingsUi.Flow.Id
+		}
+	}
+
+	return res
+}
+
+// settingsFrom reads the settings flow id from a settings ui url.
+func settingsFrom(location string) *Recovered {
+	res := &Recovered{}
+
+	if target, err := url.Parse(location); err == nil {
+		res.SettingsFlow = target.Query().Get("flow")
+	}
+
+	return res
+}
@@ -0,0 +1,347 @@
+package selfservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const (
+	fakeSettingsFlow = "settings-flow"
+	fakeSettingsUI   = "http://ui.invalid/settings?flow=" + fakeSettingsFlow
+	fakeBrowserFlow  = "browser-flow"
+)
+
+// recoveryKratos is a fake Kratos mailing fakeCode and links to the address
+// of recovery and verification flows.
+type recoveryKratos struct {
+	*fakeKratos
+
+	mu       sync.Mutex
+	verified []string
+}
+
+func newRecoveryKratos(t *testing.T) *recoveryKratos {
+	t.Helper()
+
+	fake := &recoveryKratos{fakeKratos: newFakeKratos(t)}
+
+	flow := func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: fakeCSRF, Path: "/"})
+		writeFake(w, http.StatusOK, fake.Flow("api"))
+	}
+
+	for _, kind := range []string{"recovery", "verification"} {
+		fake.Mux.HandleFunc("GET /self-service/"+kind+"/api", flow)
+		fake.Mux.HandleFunc("GET /self-service/"+kind+"/browser", flow)
+	}
+
+	fake.Mux.HandleFunc("POST /self-service/recovery", fake.recover)
+	fake.Mux.HandleFunc("POST /self-service/verification", fake.verify)
+	fake.Mux.HandleFunc("GET /self-service/recovery", func(w http.ResponseWriter, r *http.Request) {
+		fake.SetSessionCookie(w, fake.Issue(map[string]any{"email": r.URL.Query().Get("email")}))
+		http.Redirect(w, r, fakeSettingsUI, http.StatusSeeOther)
+	})
+	fake.Mux.HandleFunc("GET /self-service/verification", func(w http.ResponseWriter, r *http.Request) {
+		fake.markVerified(r.URL.Query().Get("email"))
+		http.Redirect(w, r, "http://ui.invalid/verified", http.StatusSeeOther)
+	})
+
+	return fake
+}
+
+// Link is what the fake mails for kind to email.
+func (f *recoveryKratos) Link(kind, email string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return f.URL + "/self-service/" + kind + "?token=" + uuid.NewString() + "&email=" + email, nil
+	}
+}
+
+func (f *recoveryKratos) Verified() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.verified...)
+}
+
+func (f *recoveryKratos) markVerified(email string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.verified = append(f.verified, email)
+}
+
+func (f *recoveryKratos) recover(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	res := f.Flow("api")
+
+	switch {
+	case body["email"] != nil:
+		res["state"] = stateSentEmail
+	case body["code"] == fakeCode:
+		token := f.Issue(map[string]any{"email": "first@example.com"})
+
+		_, err := r.Cookie("csrf_token")
+		if err == nil || r.URL.Query().Get("flow") == fakeBrowserFlow {
+			f.SetSessionCookie(w, token)
+			writeFake(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":               map[string]any{"id": "browser_location_change_required", "code": 422},
+				"redirect_browser_to": fakeSettingsUI,
+			})
+
+			return
+		}
+
+		res["state"] = statePassedChallenge
+		res["continue_with"] = []any{
+			map[string]any{"action": "set_ory_session_token", "ory_session_token": token},
+			map[string]any{"action": "show_settings_ui", "flow": map[string]any{"id": fakeSettingsFlow}},
+		}
+	default:
+		res["state"] = stateSentEmail
+	}
+
+	writeFake(w, http.StatusOK, res)
+}
+
+func (f *recoveryKratos) verify(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	res := f.Flow("api")
+	res["state"] = stateSentEmail
+
+	if body["email"] == "" {
+		f.reject(w, "choose_method", "email", 4000002, "Property email is missing.")
+
+		return
+	}
+
+	if body["code"] == fakeCode {
+		f.markVerified("first@example.com")
+
+		res["state"] = statePassedChallenge
+	}
+
+	writeFake(w, http.StatusOK, res)
+}
+
+func code(val string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return val, nil
+	}
+}
+
+func TestRecoveryPatch(t *testing.T) {
+	cfg := kratosconf.New()
+	require.NoError(t, cfg.Apply(RecoveryPatch(MethodLink)))
+
+	for path, exp := range map[string]any{
+		"selfservice.methods.link.enabled":       true,
+		"selfservice.flows.recovery.use":         MethodLink,
+		"selfservice.flows.verification.enabled": true,
+	} {
+		val, _ := cfg.Get(path)
+		assert.Equal(t, exp, val, path)
+	}
+
+	require.NoError(t, cfg.Set("selfservice", "broken"))
+	require.ErrorIs(t, RecoveryPatch(MethodCode)(cfg), kratosconf.ErrNotObject)
+}
+
+func TestRecover(t *testing.T) {
+	t.Run("should be able to recover with code", func(t *testing.T) {
+		fake := newRecoveryKratos(t)
+
+		res, err := Recover(t.Context(), fake.Front(), Recovery{Email: "first@example.com", Code: code(fakeCode)})
+		require.NoError(t, err)
+		assert.NotEmpty(t, res.SessionToken)
+		assert.Equal(t, fakeSettingsFlow, res.SettingsFlow)
+		assert.Equal(t, "first@example.com", res.Session.GetIdentity().Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when code is wrong", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			_, err := Recover(t.Context(), fake.Front(), Recovery{Email: "first@example.com", Code: code("000000")})
+			require.ErrorIs(t, err, ErrFlowIncomplete)
+		})
+
+		t.Run("when code source fails", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+			exp := errors.New(uuid.NewString())
+
+			_, err := Recover(t.Context(), fake.Front(), Recovery{
+				Email: "first@example.com",
+				Code: func(context.Context) (string, error) {
+					return "", exp
+				},
+			})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when code source is not set", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			_, err := Recover(t.Context(), fake.Front(), Recovery{Email: "first@example.com"})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when link is requested natively", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			_, err := Recover(t.Context(), fake.Front(), Recovery{Method: MethodLink})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when flow cant be created", func(t *testing.T) {
+			fake := newFakeKratos(t)
+
+			_, err := Recover(t.Context(), fake.Front(), Recovery{})
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestBrowser_Recover(t *testing.T) {
+	t.Run("should be able to recover with code", func(t *testing.T) {
+		fake := newRecoveryKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		res, err := browser.Recover(t.Context(), Recovery{Email: "first@example.com", Code: code(fakeCode)})
+		require.NoError(t, err)
+		assert.Equal(t, fakeSettingsFlow, res.SettingsFlow)
+		assert.NotNil(t, res.Session)
+	})
+
+	t.Run("should be able to recover with link", func(t *testing.T) {
+		fake := newRecoveryKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		res, err := browser.Recover(t.Context(), Recovery{
+			Email:  "second@example.com",
+			Method: MethodLink,
+			Link:   fake.Link("recovery", "second@example.com"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, fakeSettingsFlow, res.SettingsFlow)
+		assert.Equal(t, "second@example.com", res.Session.GetIdentity().Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when code is wrong", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Recover(t.Context(), Recovery{Email: "first@example.com", Code: code("000000")})
+			require.ErrorIs(t, err, ErrFlowIncomplete)
+		})
+
+		t.Run("when link source is not set", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Recover(t.Context(), Recovery{Email: "first@example.com", Method: MethodLink})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when method is unknown", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Recover(t.Context(), Recovery{Method: "sms"})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Run("should be able to verify with code", func(t *testing.T) {
+		fake := newRecoveryKratos(t)
+
+		require.NoError(t, Verify(t.Context(), fake.Front(), Verification{Email: "first@example.com", Code: code(fakeCode)}))
+		assert.Equal(t, []string{"first@example.com"}, fake.Verified())
+	})
+
+	t.Run("should be able to verify with link in browser", func(t *testing.T) {
+		fake := newRecoveryKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		require.NoError(t, browser.Verify(t.Context(), Verification{
+			Email:  "second@example.com",
+			Method: MethodLink,
+			Link:   fake.Link("verification", "second@example.com"),
+		}))
+		assert.Equal(t, []string{"second@example.com"}, fake.Verified())
+	})
+
+	t.Run("should be able to verify with code in browser", func(t *testing.T) {
+		fake := newRecoveryKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		require.NoError(t, browser.Verify(t.Context(), Verification{Email: "first@example.com", Code: code(fakeCode)}))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when code is wrong", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			err := Verify(t.Context(), fake.Front(), Verification{Email: "first@example.com", Code: code("000000")})
+			require.ErrorIs(t, err, ErrFlowIncomplete)
+			assert.Empty(t, fake.Verified())
+		})
+
+		t.Run("when email is missing", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			err := Verify(t.Context(), fake.Front(), Verification{Code: code(fakeCode)})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Len(t, kerr.Field("email"), 1)
+		})
+
+		t.Run("when link is requested natively", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			err := Verify(t.Context(), fake.Front(), Verification{Method: MethodLink})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when method is unknown", func(t *testing.T) {
+			fake := newRecoveryKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			require.ErrorIs(t, browser.Verify(t.Context(), Verification{Method: "sms"}), ErrUnsupportedMethod)
+		})
+	})
+}
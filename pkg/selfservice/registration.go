@@ -0,0 +1,278 @@
+package selfservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const (
+	MethodPassword = "password"
+	MethodCode     = "code"
+	MethodOIDC     = "oidc"
+	MethodPasskey  = "passkey"
+
+	stateSentEmail = "sent_email"
+)
+
+var (
+	ErrUnsupportedMethod = errors.New("self-service method is not supported")
+	ErrCodeNotSent       = errors.New("kratos did not send a code")
+	ErrNoPasskeyOptions  = errors.New("registration flow has no passkey options")
+)
+
+type (
+	// Registration describes a registration flow submission. Method defaults
+	// to password.
+	Registration struct {
+		Method           string
+		Traits           map[string]any
+		TransientPayload map[string]any
+
+		Password string
+
+		// Code returns the one-time code sent by Kratos for the code method,
+		// e.g. read from a captured courier message.
+		Code func(ctx context.Context) (string, error)
+
+		// Provider and Subject select the OIDC provider and its login_hint.
+		Provider string
+		Subject  string
+
+		// Passkey turns passkey_create_data of the flow into the credential
+		// JSON a browser would submit as passkey_register.
+		Passkey func(options string) (string, error)
+	}
+
+	// Registered is the outcome of a successful registration. Session is nil
+	// when the session hook is not enabled for the method.
+	Registered struct {
+		Identity     *client.Identity
+		Session      *client.Session
+		SessionToken string
+	}
+)
+
+// Register submits reg through a native API flow. Validation failures are
+// returned as *kratoserr.Error.
+func Register(ctx context.Context, front *client.APIClient, reg Registration) (*Registered, error) {
+	switch reg.method() {
+	case MethodPassword, MethodCode:
+	default:
+		return nil, fmt.Errorf("%w: %s via native flow", ErrUnsupportedMethod, reg.method())
+	}
+
+	flow, resp, err := front.FrontendAPI.CreateNativeRegistrationFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create native registration flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	return reg.submit(ctx, front, flow)
+}
+
+// Register submits reg through a browser flow keeping cookies in b.
+// Validation failures are returned as *kratoserr.Error.
+func (b *Browser) Register(ctx context.Context, reg Registration) (*Registered, error) {
+	flow, resp, err := b.Public.FrontendAPI.CreateBrowserRegistrationFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser registration flow: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	if reg.method() == MethodOIDC {
+		return b.registerWithOIDC(ctx, flow, reg)
+	}
+
+	return reg.submit(ctx, b.Public, flow)
+}
+
+func (b *Browser) registerWithOIDC(
+	ctx context.Context, flow *client.RegistrationFlow, reg Registration,
+) (*Registered, error) {
+	method := client.UpdateRegistrationFlowWithOidcMethod{
+		Method:           MethodOIDC,
+		Provider:         reg.Provider,
+		Traits:           reg.Traits,
+		TransientPayload: reg.TransientPayload,
+		CsrfToken:        client.PtrString(CSRFToken(flow.Ui)),
+	}
+
+	if reg.Subject != "" {
+		method.UpstreamParameters = map[string]any{"login_hint": reg.Subject}
+	}
+
+	_, resp, err := b.Public.FrontendAPI.UpdateRegistrationFlow(ctx).
+		Flow(flow.Id).
+		UpdateRegistrationFlowBody(client.UpdateRegistrationFlowBody{UpdateRegistrationFlowWithOidcMethod: &method}).
+		Execute()
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	location, err := redirectFrom(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit oidc registration: %w", err)
+	}
+
+	target, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provider redirect: %w", err)
+	}
+
+	b.Trust(target.Host)
+
+	last, err := b.Follow(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := b.Session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("oidc registration stopped at %s: %w", last, err)
+	}
+
+	return &Registered{Identity: session.Identity, Session: session}, nil
+}
+
+func (r Registration) method() string {
+	if r.Method == "" {
+		return MethodPassword
+	}
+
+	return r.Method
+}
+
+func (r Registration) submit(
+	ctx context.Context, public *client.APIClient, flow *client.RegistrationFlow,
+) (*Registered, error) {
+	body, err := r.body(flow, "")
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := updateRegistration(ctx, public, flow.Id, body)
+	if err == nil || r.method() != MethodCode {
+		return registered(res, err)
+	}
+
+	sent, ok := kratoserr.Parse(err)
+	if !ok || sent.Flow == nil || sent.Flow.State != stateSentEmail {
+		return nil, fmt.Errorf("%w: %w", ErrCodeNotSent, err)
+	}
+
+	if r.Code == nil {
+		return nil, fmt.Errorf("%w: code source is not set", ErrUnsupportedMethod)
+	}
+
+	code, err := r.Code(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive registration code: %w", err)
+	}
+
+	body, err = r.body(flow, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return registered(updateRegistration(ctx, public, flow.Id, body))
+}
+
+func (r Registration) body(flow *client.RegistrationFlow, code string) (client.UpdateRegistrationFlowBody, error) {
+	csrf := client.PtrString(CSRFToken(flow.Ui))
+
+	switch r.method() {
+	case MethodPassword:
+		return client.UpdateRegistrationFlowBody{
+			UpdateRegistrationFlowWithPasswordMethod: &client.UpdateRegistrationFlowWithPasswordMethod{
+				Method:           MethodPassword,
+				Password:         r.Password,
+				Traits:           r.Traits,
+				TransientPayload: r.TransientPayload,
+				CsrfToken:        csrf,
+			},
+		}, nil
+	case MethodCode:
+		method := &client.UpdateRegistrationFlowWithCodeMethod{
+			Method:           MethodCode,
+			Traits:           r.Traits,
+			TransientPayload: r.TransientPayload,
+			CsrfToken:        csrf,
+		}
+
+		if code != "" {
+			method.Code = client.PtrString(code)
+		}
+
+		return client.UpdateRegistrationFlowBody{UpdateRegistrationFlowWithCodeMethod: method}, nil
+	case MethodPasskey:
+		return r.passkeyBody(flow, csrf)
+	default:
+		return client.UpdateRegistrationFlowBody{}, fmt.Errorf("%w: %s", ErrUnsupportedMethod, r.Method)
+	}
+}
+
+func (r Registration) passkeyBody(
+	flow *client.RegistrationFlow, csrf *string,
+) (client.UpdateRegistrationFlowBody, error) {
+	if r.Passkey == nil {
+		return client.UpdateRegistrationFlowBody{}, fmt.Errorf("%w: passkey source is not set", ErrUnsupportedMethod)
+	}
+
+	options, ok := InputValue(flow.Ui, "passkey_create_data")
+	if !ok || options == nil {
+		return client.UpdateRegistrationFlowBody{}, ErrNoPasskeyOptions
+	}
+
+	credential, err := r.Passkey(fmt.Sprint(options))
+	if err != nil {
+		return client.UpdateRegistrationFlowBody{}, fmt.Errorf("failed to create passkey credential: %w", err)
+	}
+
+	return client.UpdateRegistrationFlowBody{
+		UpdateRegistrationFlowWithPasskeyMethod: &client.UpdateRegistrationFlowWithPasskeyMethod{
+			Method:           MethodPasskey,
+			PasskeyRegister:  client.PtrString(credential),
+			Traits:           r.Traits,
+			TransientPayload: r.TransientPayload,
+			CsrfToken:        csrf,
+		},
+	}, nil
+}
+
+func updateRegistration(
+	ctx context.Context, public *client.APIClient, flow string, body client.UpdateRegistrationFlowBody,
+) (*client.SuccessfulNativeRegistration, error) {
+	res, resp, err := public.FrontendAPI.UpdateRegistrationFlow(ctx).
+		Flow(flow).
+		UpdateRegistrationFlowBody(body).
+		Execute()
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return nil, kratoserr.FromResponse(resp, err)
+	}
+
+	return res, nil
+}
+
+func registered(res *client.SuccessfulNativeRegistration, err error) (*Registered, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit registration: %w", err)
+	}
+
+	return &Registered{
+		Identity:     &res.Identity,
+		Session:      res.Session,
+		SessionToken: res.GetSessionToken(),
+	}, nil
+}
@@ -0,0 +1,343 @@
+package selfservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+	"github.com/godepo/grokratos/pkg/mockoidc"
+)
+
+const (
+	fakeCode            = "123456"
+	fakePasskeyOptions  = `{"publicKey":{"challenge":"fake"}}`
+	fakePasskeyResponse = `{"id":"fake-credential"}`
+)
+
+func newRegistrationKratos(t *testing.T) *fakeKratos {
+	t.Helper()
+
+	fake := newFakeKratos(t)
+
+	flow := func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: fakeCSRF, Path: "/"})
+		writeFake(w, http.StatusOK, fake.Flow("api", fakeInput("passkey", "passkey_create_data", fakePasskeyOptions)))
+	}
+
+	fake.Mux.HandleFunc("GET /self-service/registration/api", flow)
+	fake.Mux.HandleFunc("GET /self-service/registration/browser", flow)
+	fake.Mux.HandleFunc("POST /self-service/registration", fake.register)
+
+	return fake
+}
+
+func (f *fakeKratos) register(w http.ResponseWriter, r *http.Request) {
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	traits, _ := body["traits"].(map[string]any)
+	if traits["email"] == "" || traits["email"] == nil {
+		f.reject(w, "choose_method", "traits.email", 4000002, "Property email is missing.")
+
+		return
+	}
+
+	switch body["method"] {
+	case MethodPassword:
+		if password, _ := body["password"].(string); len(password) < 8 {
+			f.reject(w, "choose_method", "password", 4000005, "The password must be at least 8 characters long.")
+
+			return
+		}
+	case MethodCode:
+		switch body["code"] {
+		case nil:
+			f.reject(w, stateSentEmail, "code", 1040005, "An email containing a code has been sent.")
+
+			return
+		case fakeCode:
+		default:
+			f.reject(w, stateSentEmail, "code", 4040003, "The registration code is invalid or has already been used.")
+
+			return
+		}
+	case MethodPasskey:
+		if body["passkey_register"] != fakePasskeyResponse {
+			f.reject(w, "choose_method", "passkey_register", 4000001, "Unable to parse WebAuthn response.")
+
+			return
+		}
+	}
+
+	token := f.Issue(traits)
+
+	f.mu.Lock()
+	session := f.sessions[token]
+	f.mu.Unlock()
+
+	writeFake(w, http.StatusOK, map[string]any{
+		"identity":      session["identity"],
+		"session":       session,
+		"session_token": token,
+	})
+}
+
+func (f *fakeKratos) reject(w http.ResponseWriter, state, field string, id int64, text string) {
+	flow := f.Flow("api", map[string]any{
+		"type":     "input",
+		"group":    "default",
+		"messages": []any{map[string]any{"id": id, "text": text, "type": "error"}},
+		"meta":     map[string]any{},
+		"attributes": map[string]any{
+			"node_type": "input",
+			"name":      field,
+			"type":      "text",
+			"disabled":  false,
+		},
+	})
+	flow["state"] = state
+
+	writeFake(w, http.StatusBadRequest, flow)
+}
+
+func TestRegister(t *testing.T) {
+	t.Run("should be able to register with password", func(t *testing.T) {
+		fake := newRegistrationKratos(t)
+
+		res, err := Register(t.Context(), fake.Front(), Registration{
+			Traits:   map[string]any{"email": "first@example.com"},
+			Password: uuid.NewString(),
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, res.SessionToken)
+		assert.Equal(t, "first@example.com", res.Identity.Traits.(map[string]any)["email"])
+		require.NotNil(t, res.Session)
+	})
+
+	t.Run("should be able to register with code", func(t *testing.T) {
+		fake := newRegistrationKratos(t)
+
+		res, err := Register(t.Context(), fake.Front(), Registration{
+			Method: MethodCode,
+			Traits: map[string]any{"email": "first@example.com"},
+			Code: func(context.Context) (string, error) {
+				return fakeCode, nil
+			},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, res.SessionToken)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when password is too short", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			_, err := Register(t.Context(), fake.Front(), Registration{
+				Traits:   map[string]any{"email": "first@example.com"},
+				Password: "short",
+			})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusBadRequest, kerr.Status)
+			assert.True(t, kerr.HasMessage(4000005))
+			assert.Len(t, kerr.Field("password"), 1)
+		})
+
+		t.Run("when code is wrong", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			_, err := Register(t.Context(), fake.Front(), Registration{
+				Method: MethodCode,
+				Traits: map[string]any{"email": "first@example.com"},
+				Code: func(context.Context) (string, error) {
+					return "000000", nil
+				},
+			})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.True(t, kerr.HasMessage(4040003))
+		})
+
+		t.Run("when code is not sent", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			_, err := Register(t.Context(), fake.Front(), Registration{Method: MethodCode})
+			require.ErrorIs(t, err, ErrCodeNotSent)
+			assert.True(t, errors.As(err, new(*kratoserr.Error)))
+		})
+
+		t.Run("when code source fails", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+			exp := errors.New(uuid.NewString())
+
+			_, err := Register(t.Context(), fake.Front(), Registration{
+				Method: MethodCode,
+				Traits: map[string]any{"email": "first@example.com"},
+				Code: func(context.Context) (string, error) {
+					return "", exp
+				},
+			})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when code source is not set", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			_, err := Register(t.Context(), fake.Front(), Registration{
+				Method: MethodCode,
+				Traits: map[string]any{"email": "first@example.com"},
+			})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when method needs a browser", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			for _, method := range []string{MethodOIDC, MethodPasskey} {
+				_, err := Register(t.Context(), fake.Front(), Registration{Method: method})
+				require.ErrorIs(t, err, ErrUnsupportedMethod)
+			}
+		})
+
+		t.Run("when flow cant be created", func(t *testing.T) {
+			fake := newFakeKratos(t)
+
+			_, err := Register(t.Context(), fake.Front(), Registration{})
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestBrowser_Register(t *testing.T) {
+	t.Run("should be able to register with password", func(t *testing.T) {
+		fake := newRegistrationKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		res, err := browser.Register(t.Context(), Registration{
+			Traits:   map[string]any{"email": "first@example.com"},
+			Password: uuid.NewString(),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "first@example.com", res.Identity.Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to register with passkey", func(t *testing.T) {
+		fake := newRegistrationKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		var options string
+
+		res, err := browser.Register(t.Context(), Registration{
+			Method: MethodPasskey,
+			Traits: map[string]any{"email": "first@example.com"},
+			Passkey: func(opts string) (string, error) {
+				options = opts
+
+				return fakePasskeyResponse, nil
+			},
+		})
+		require.NoError(t, err)
+		assert.NotNil(t, res.Session)
+		assert.JSONEq(t, fakePasskeyOptions, options)
+	})
+
+	t.Run("should be able to register with oidc", func(t *testing.T) {
+		prov, err := mockoidc.New("mock", mockoidc.WithUsers(
+			mockoidc.User{Subject: "first", Claims: map[string]any{"email": "first@example.com"}},
+		))
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			_ = prov.Close()
+		})
+
+		fake := newOIDCKratos(t, prov)
+		fake.Mux.HandleFunc("GET /self-service/registration/browser", func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: fakeCSRF, Path: "/"})
+			writeFake(w, http.StatusOK, fake.Flow("browser"))
+		})
+		fake.Mux.HandleFunc("POST /self-service/registration", func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Path = "/self-service/login"
+			fake.Mux.ServeHTTP(w, r)
+		})
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		res, err := browser.Register(t.Context(), Registration{Method: MethodOIDC, Provider: prov.ID, Subject: "first"})
+		require.NoError(t, err)
+		assert.Equal(t, "first@example.com", res.Identity.Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when passkey options are absent", func(t *testing.T) {
+			fake := newFakeKratos(t)
+			fake.Mux.HandleFunc("GET /self-service/registration/browser", func(w http.ResponseWriter, r *http.Request) {
+				writeFake(w, http.StatusOK, fake.Flow("browser"))
+			})
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Register(t.Context(), Registration{
+				Method: MethodPasskey,
+				Passkey: func(string) (string, error) {
+					return fakePasskeyResponse, nil
+				},
+			})
+			require.ErrorIs(t, err, ErrNoPasskeyOptions)
+		})
+
+		t.Run("when passkey is rejected", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Register(t.Context(), Registration{
+				Method: MethodPasskey,
+				Traits: map[string]any{"email": "first@example.com"},
+				Passkey: func(string) (string, error) {
+					return "{}", nil
+				},
+			})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Len(t, kerr.Field("passkey_register"), 1)
+		})
+
+		t.Run("when method is unknown", func(t *testing.T) {
+			fake := newRegistrationKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Register(t.Context(), Registration{Method: "totp"})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when flow cant be created", func(t *testing.T) {
+			fake := newFakeKratos(t)
+
+			browser, err := NewBrowser(fake.Front())
+			require.NoError(t, err)
+
+			_, err = browser.Register(t.Context(), Registration{})
+			require.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,65 @@
+package selfservice
+
+import (
+	"context"
+	"fmt"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+const aal2 = "aal2"
+
+// ExtendSession pushes the expiry of the session with id through the admin
+// API. Kratos leaves sessions unchanged until they are within
+// session.earliest_possible_extend of expiring.
+func ExtendSession(ctx context.Context, admin *client.APIClient, id string) (*client.Session, error) {
+	session, resp, err := admin.IdentityAPI.ExtendSession(ctx, id).Execute()
+	if err := closed(resp, err); err != nil {
+		return nil, fmt.Errorf("failed to extend session %s: %w", id, err)
+	}
+
+	return session, nil
+}
+
+// UpgradeAAL2 raises the session of token to aal2 with a refresh login
+// answered by the totp code from code, e.g. TOTP(secret).
+func UpgradeAAL2(
+	ctx context.Context, front *client.APIClient, token string, code func(context.Context) (string, error),
+) (*client.Session, error) {
+	return upgradeAAL2(ctx, &settingsAgent{public: front, token: token}, code)
+}
+
+// UpgradeAAL2 is the browser counterpart of UpgradeAAL2.
+func (b *Browser) UpgradeAAL2(
+	ctx context.Context, code func(context.Context) (string, error),
+) (*client.Session, error) {
+	return upgradeAAL2(ctx, &settingsAgent{public: b.Public}, code)
+}
+
+func upgradeAAL2(
+	ctx context.Context, agent *settingsAgent, code func(context.Context) (string, error),
+) (*client.Session, error) {
+	if code == nil {
+		return nil, fmt.Errorf("%w: second factor source is not set", ErrUnsupportedMethod)
+	}
+
+	totp, err := code(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive second factor: %w", err)
+	}
+
+	res, err := agent.login(ctx, aal2, func(csrf string) client.UpdateLoginFlowBody {
+		return client.UpdateLoginFlowBody{
+			UpdateLoginFlowWithTotpMethod: &client.UpdateLoginFlowWithTotpMethod{
+				Method:    MethodTOTP,
+				TotpCode:  totp,
+				CsrfToken: client.PtrString(csrf),
+			},
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade session to aal2: %w", err)
+	}
+
+	return &res.Session, nil
+}
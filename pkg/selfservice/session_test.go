@@ -0,0 +1,144 @@
+package selfservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+func TestExtendSession(t *testing.T) {
+	newKratos := func(t *testing.T) *fakeKratos {
+		t.Helper()
+
+		fake := newFakeKratos(t)
+		fake.Mux.HandleFunc("PATCH /admin/sessions/{id}/extend", func(w http.ResponseWriter, r *http.Request) {
+			if r.PathValue("id") != "known" {
+				writeFake(w, http.StatusNotFound, map[string]any{"error": map[string]any{"code": http.StatusNotFound}})
+
+				return
+			}
+
+			writeFake(w, http.StatusOK, map[string]any{
+				"id":         "known",
+				"active":     true,
+				"expires_at": time.Now().Add(24 * time.Hour),
+			})
+		})
+
+		return fake
+	}
+
+	t.Run("should be able to extend session", func(t *testing.T) {
+		fake := newKratos(t)
+
+		session, err := ExtendSession(t.Context(), fake.Front(), "known")
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), session.GetExpiresAt(), time.Minute)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when session is unknown", func(t *testing.T) {
+			fake := newKratos(t)
+
+			_, err := ExtendSession(t.Context(), fake.Front(), "absent")
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusNotFound, kerr.Status)
+		})
+	})
+}
+
+func TestUpgradeAAL2(t *testing.T) {
+	paired := func(t *testing.T) (*totpKratos, string) {
+		t.Helper()
+
+		fake := newTOTPKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		_, err := EnrollTOTP(t.Context(), fake.Front(), token, nil)
+		require.NoError(t, err)
+
+		return fake, token
+	}
+
+	t.Run("should be able to upgrade session", func(t *testing.T) {
+		fake, token := paired(t)
+
+		session, err := UpgradeAAL2(t.Context(), fake.Front(), token, TOTP(fakeTOTPSecret))
+		require.NoError(t, err)
+		assert.Equal(t, client.AUTHENTICATORASSURANCELEVEL_AAL2, session.GetAuthenticatorAssuranceLevel())
+		assert.Len(t, session.AuthenticationMethods, 2)
+	})
+
+	t.Run("should be able to upgrade session in browser", func(t *testing.T) {
+		fake, token := paired(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		fake.Mux.HandleFunc("GET /signin", func(w http.ResponseWriter, r *http.Request) {
+			fake.SetSessionCookie(w, token)
+		})
+
+		_, err = browser.Follow(t.Context(), fake.URL+"/signin")
+		require.NoError(t, err)
+
+		session, err := browser.UpgradeAAL2(t.Context(), TOTP(fakeTOTPSecret))
+		require.NoError(t, err)
+		assert.Equal(t, client.AUTHENTICATORASSURANCELEVEL_AAL2, session.GetAuthenticatorAssuranceLevel())
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when code is wrong", func(t *testing.T) {
+			fake, token := paired(t)
+
+			_, err := UpgradeAAL2(t.Context(), fake.Front(), token, code("000000"))
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.True(t, kerr.HasMessage(4000008))
+		})
+
+		t.Run("when authenticator is not paired", func(t *testing.T) {
+			fake := newTOTPKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+			_, err := UpgradeAAL2(t.Context(), fake.Front(), token, TOTP(fakeTOTPSecret))
+			require.Error(t, err)
+		})
+
+		t.Run("when code source fails", func(t *testing.T) {
+			fake, token := paired(t)
+			exp := errors.New(uuid.NewString())
+
+			_, err := UpgradeAAL2(t.Context(), fake.Front(), token, func(context.Context) (string, error) {
+				return "", exp
+			})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when code source is not set", func(t *testing.T) {
+			fake, token := paired(t)
+
+			_, err := UpgradeAAL2(t.Context(), fake.Front(), token, nil)
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when login flow cant be created", func(t *testing.T) {
+			fake := newFakeKratos(t)
+
+			_, err := UpgradeAAL2(t.Context(), fake.Front(), "absent", TOTP(fakeTOTPSecret))
+			require.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,327 @@
+package selfservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const (
+	MethodProfile = "profile"
+
+	errSessionRefreshRequired = "session_refresh_required"
+)
+
+var ErrPrivilegedSessionRequired = errors.New("settings require a privileged session")
+
+type (
+	// Settings describes a settings flow submission. Method defaults to
+	// profile. Link and Unlink name OIDC providers for the oidc method.
+	Settings struct {
+		Method           string
+		Traits           map[string]any
+		TransientPayload map[string]any
+
+		Password string
+
+		Link    string
+		Unlink  string
+		Subject string
+
+		// Reauth signs in again with these credentials when the session is
+		// older than privileged_session_max_age.
+		Reauth *Credentials
+	}
+
+	Credentials struct {
+		Identifier string
+		Password   string
+	}
+
+	// settingsAgent submits flows as a native client when token is set and as
+	// a browser otherwise.
+	settingsAgent struct {
+		public *client.APIClient
+		token  string
+	}
+)
+
+// UpdateSettings submits upd through a native API flow on behalf of the
+// session token and returns the updated identity. Validation failures are
+// returned as *kratoserr.Error.
+func UpdateSettings(
+	ctx context.Context, front *client.APIClient, token string, upd Settings,
+) (*client.Identity, error) {
+	if upd.method() == MethodOIDC && upd.Link != "" {
+		return nil, fmt.Errorf("%w: oidc link via native flow", ErrUnsupportedMethod)
+	}
+
+	return upd.submit(ctx, &settingsAgent{public: front, token: token})
+}
+
+// UpdateSettings submits upd through a browser flow on behalf of the session
+// cookie kept in b and returns the updated identity.
+func (b *Browser) UpdateSettings(ctx context.Context, upd Settings) (*client.Identity, error) {
+	if upd.method() != MethodOIDC || upd.Link == "" {
+		return upd.submit(ctx, &settingsAgent{public: b.Public})
+	}
+
+	_, err := upd.submit(ctx, &settingsAgent{public: b.Public})
+	if errors.Is(err, ErrPrivilegedSessionRequired) {
+		return nil, err
+	}
+
+	location, err := redirectFrom(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit oidc link: %w", err)
+	}
+
+	target, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse provider redirect: %w", err)
+	}
+
+	b.Trust(target.Host)
+
+	last, err := b.Follow(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := b.Session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("oidc link stopped at %s: %w", last, err)
+	}
+
+	return session.Identity, nil
+}
+
+func (s Settings) method() string {
+	if s.Method == "" {
+		return MethodProfile
+	}
+
+	return s.Method
+}
+
+func (s Settings) submit(ctx context.Context, agent *settingsAgent) (*client.Identity, error) {
+	return privileged(ctx, agent, s.Reauth, func() (*client.Identity, error) {
+		return s.attempt(ctx, agent)
+	})
+}
+
+// privileged runs attempt once more after re-authenticating with reauth when
+// Kratos asks for a privileged session.
+func privileged[T any](
+	ctx context.Context, agent *settingsAgent, reauth *Credentials, attempt func() (T, error),
+) (T, error) {
+	res, err := attempt()
+	if err == nil || !refreshRequired(err) {
+		return res, err
+	}
+
+	var zero T
+
+	if reauth == nil {
+		return zero, fmt.Errorf("%w: %w", ErrPrivilegedSessionRequired, err)
+	}
+
+	if err := agent.refresh(ctx, *reauth); err != nil {
+		return zero, err
+	}
+
+	return attempt()
+}
+
+func (s Settings) attempt(ctx context.Context, agent *settingsAgent) (*client.Identity, error) {
+	flow, err := agent.create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.body(CSRFToken(flow.Ui))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := agent.update(ctx, flow.Id, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit settings: %w", err)
+	}
+
+	return &res.Identity, nil
+}
+
+func (s Settings) body(csrf string) (client.UpdateSettingsFlowBody, error) {
+	switch s.method() {
+	case MethodProfile:
+		return client.UpdateSettingsFlowBody{
+			UpdateSettingsFlowWithProfileMethod: &client.UpdateSettingsFlowWithProfileMethod{
+				Method:           MethodProfile,
+				Traits:           s.Traits,
+				TransientPayload: s.TransientPayload,
+				CsrfToken:        client.PtrString(csrf),
+			},
+		}, nil
+	case MethodPassword:
+		return client.UpdateSettingsFlowBody{
+			UpdateSettingsFlowWithPasswordMethod: &client.UpdateSettingsFlowWithPasswordMethod{
+				Method:           MethodPassword,
+				Password:         s.Password,
+				TransientPayload: s.TransientPayload,
+				CsrfToken:        client.PtrString(csrf),
+			},
+		}, nil
+	case MethodOIDC:
+		method := &client.UpdateSettingsFlowWithOidcMethod{
+			Method:           MethodOIDC,
+			Traits:           s.Traits,
+			TransientPayload: s.TransientPayload,
+		}
+
+		if s.Link != "" {
+			method.Link = client.PtrString(s.Link)
+		}
+
+		if s.Unlink != "" {
+			method.Unlink = client.PtrString(s.Unlink)
+		}
+
+		// the generated model has no csrf_token field, browser flows need it anyway
+		if csrf != "" {
+			method.AdditionalProperties = map[string]any{"csrf_token": csrf}
+		}
+
+		if s.Subject != "" {
+			method.UpstreamParameters = map[string]any{"login_hint": s.Subject}
+		}
+
+		return client.UpdateSettingsFlowBody{UpdateSettingsFlowWithOidcMethod: method}, nil
+	default:
+		return client.UpdateSettingsFlowBody{}, fmt.Errorf("%w: %s", ErrUnsupportedMethod, s.Method)
+	}
+}
+
+func (a *settingsAgent) create(ctx context.Context) (*client.SettingsFlow, error) {
+	if a.token == "" {
+		flow, resp, err := a.public.FrontendAPI.CreateBrowserSettingsFlow(ctx).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create browser settings flow: %w", kratoserr.FromResponse(resp, err))
+		}
+
+		_ = resp.Body.Close()
+
+		return flow, nil
+	}
+
+	flow, resp, err := a.public.FrontendAPI.CreateNativeSettingsFlow(ctx).XSessionToken(a.token).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create native settings flow: %w", kratoserr.FromResponse(resp, err))
+	}
+
+	_ = resp.Body.Close()
+
+	return flow, nil
+}
+
+func (a *settingsAgent) update(
+	ctx context.Context, flow string, body client.UpdateSettingsFlowBody,
+) (*client.SettingsFlow, error) {
+	req := a.public.FrontendAPI.UpdateSettingsFlow(ctx).Flow(flow).UpdateSettingsFlowBody(body)
+	if a.token != "" {
+		req = req.XSessionToken(a.token)
+	}
+
+	res, resp, err := req.Execute()
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return nil, kratoserr.FromResponse(resp, err)
+	}
+
+	return res, nil
+}
+
+// refresh signs in again with a refresh login flow, bumping authenticated_at
+// of the current session.
+func (a *settingsAgent) refresh(ctx context.Context, creds Credentials) error {
+	_, err := a.login(ctx, "", func(csrf string) client.UpdateLoginFlowBody {
+		return client.UpdateLoginFlowBody{
+			UpdateLoginFlowWithPasswordMethod: &client.UpdateLoginFlowWithPasswordMethod{
+				Method:     MethodPassword,
+				Identifier: creds.Identifier,
+				Password:   creds.Password,
+				CsrfToken:  client.PtrString(csrf),
+			},
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-authenticate: %w", err)
+	}
+
+	return nil
+}
+
+// login walks a refresh login flow at assurance level aal, kratos default when
+// empty, adopting the session token it returns.
+func (a *settingsAgent) login(
+	ctx context.Context, aal string, body func(csrf string) client.UpdateLoginFlowBody,
+) (*client.SuccessfulNativeLogin, error) {
+	var (
+		flow *client.LoginFlow
+		resp *http.Response
+		err  error
+	)
+
+	if a.token == "" {
+		req := a.public.FrontendAPI.CreateBrowserLoginFlow(ctx).Refresh(true)
+		if aal != "" {
+			req = req.Aal(aal)
+		}
+
+		flow, resp, err = req.Execute()
+	} else {
+		req := a.public.FrontendAPI.CreateNativeLoginFlow(ctx).Refresh(true).XSessionToken(a.token)
+		if aal != "" {
+			req = req.Aal(aal)
+		}
+
+		flow, resp, err = req.Execute()
+	}
+
+	if err := closed(resp, err); err != nil {
+		return nil, fmt.Errorf("failed to create refresh login flow: %w", err)
+	}
+
+	req := a.public.FrontendAPI.UpdateLoginFlow(ctx).
+		Flow(flow.Id).
+		UpdateLoginFlowBody(body(CSRFToken(flow.Ui)))
+	if a.token != "" {
+		req = req.XSessionToken(a.token)
+	}
+
+	res, resp, err := req.Execute()
+	if err := closed(resp, err); err != nil {
+		return nil, err
+	}
+
+	if token := res.GetSessionToken(); token != "" && a.token != "" {
+		a.token = token
+	}
+
+	return res, nil
+}
+
+func refreshRequired(err error) bool {
+	res, ok := kratoserr.Parse(err)
+
+	return ok && res.ID == errSessionRefreshRequired
+}
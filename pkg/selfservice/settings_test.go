@@ -0,0 +1,299 @@
+package selfservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const fakePassword = "fake-password"
+
+// settingsKratos is a fake Kratos requiring a privileged session for password
+// changes and oidc links.
+type settingsKratos struct {
+	*fakeKratos
+
+	mu         sync.Mutex
+	privileged map[string]bool
+}
+
+func newSettingsKratos(t *testing.T) *settingsKratos {
+	t.Helper()
+
+	fake := &settingsKratos{fakeKratos: newFakeKratos(t), privileged: map[string]bool{}}
+
+	flow := func(w http.ResponseWriter, r *http.Request) {
+		_, session, ok := fake.Lookup(r)
+		if !ok {
+			writeFake(w, http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": http.StatusUnauthorized}})
+
+			return
+		}
+
+		res := fake.Flow("api")
+		res["identity"] = session["identity"]
+
+		writeFake(w, http.StatusOK, res)
+	}
+
+	fake.Mux.HandleFunc("GET /self-service/settings/api", flow)
+	fake.Mux.HandleFunc("GET /self-service/settings/browser", flow)
+	fake.Mux.HandleFunc("GET /self-service/login/api", flow)
+	fake.Mux.HandleFunc("GET /self-service/login/browser", flow)
+	fake.Mux.HandleFunc("POST /self-service/settings", fake.settings)
+	fake.Mux.HandleFunc("POST /self-service/login", fake.login)
+	fake.Mux.HandleFunc("GET /linked", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return fake
+}
+
+func (f *settingsKratos) settings(w http.ResponseWriter, r *http.Request) {
+	token, session, ok := f.Lookup(r)
+	if !ok {
+		writeFake(w, http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": http.StatusUnauthorized}})
+
+		return
+	}
+
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	f.mu.Lock()
+	privileged := f.privileged[token]
+	f.mu.Unlock()
+
+	if body["method"] != MethodProfile && !privileged {
+		writeFake(w, http.StatusForbidden, map[string]any{
+			"error":               map[string]any{"id": errSessionRefreshRequired, "code": http.StatusForbidden},
+			"redirect_browser_to": f.URL + "/self-service/login/browser?refresh=true",
+		})
+
+		return
+	}
+
+	f.fakeKratos.mu.Lock()
+	identity := session["identity"].(map[string]any)
+	f.fakeKratos.mu.Unlock()
+
+	switch body["method"] {
+	case MethodProfile:
+		traits, _ := body["traits"].(map[string]any)
+		if traits["email"] == nil {
+			f.reject(w, "show_form", "traits.email", 4000002, "Property email is missing.")
+
+			return
+		}
+
+		f.fakeKratos.mu.Lock()
+		identity["traits"] = traits
+		f.fakeKratos.mu.Unlock()
+	case MethodPassword:
+		if password, _ := body["password"].(string); len(password) < 8 {
+			f.reject(w, "show_form", "password", 4000005, "The password must be at least 8 characters long.")
+
+			return
+		}
+	case MethodOIDC:
+		if body["csrf_token"] != fakeCSRF {
+			writeFake(w, http.StatusForbidden, map[string]any{"error": map[string]any{"code": http.StatusForbidden}})
+
+			return
+		}
+
+		if body["link"] != nil {
+			writeFake(w, http.StatusUnprocessableEntity, map[string]any{"redirect_browser_to": f.URL + "/linked"})
+
+			return
+		}
+	}
+
+	res := f.Flow("api")
+	res["state"] = "success"
+	res["identity"] = identity
+
+	writeFake(w, http.StatusOK, res)
+}
+
+func (f *settingsKratos) login(w http.ResponseWriter, r *http.Request) {
+	token, session, ok := f.Lookup(r)
+
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	if !ok || body["password"] != fakePassword {
+		f.reject(w, "choose_method", "password", 4000006, "The provided credentials are invalid.")
+
+		return
+	}
+
+	f.mu.Lock()
+	f.privileged[token] = true
+	f.mu.Unlock()
+
+	writeFake(w, http.StatusOK, map[string]any{"session": session, "session_token": token})
+}
+
+func TestUpdateSettings(t *testing.T) {
+	t.Run("should be able to update traits", func(t *testing.T) {
+		fake := newSettingsKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		identity, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{
+			Traits: map[string]any{"email": "second@example.com"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "second@example.com", identity.Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to change password after re-authentication", func(t *testing.T) {
+		fake := newSettingsKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		identity, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{
+			Method:   MethodPassword,
+			Password: "brand-new-password",
+			Reauth:   &Credentials{Identifier: "first@example.com", Password: fakePassword},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, identity.Id)
+	})
+
+	t.Run("should be able to unlink provider", func(t *testing.T) {
+		fake := newSettingsKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		fake.privileged[token] = true
+
+		_, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{Method: MethodOIDC, Unlink: "mock"})
+		require.NoError(t, err)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when privileged session is required", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+			_, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{
+				Method:   MethodPassword,
+				Password: "brand-new-password",
+			})
+			require.ErrorIs(t, err, ErrPrivilegedSessionRequired)
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusForbidden, kerr.Status)
+		})
+
+		t.Run("when re-authentication fails", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+			_, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{
+				Method:   MethodPassword,
+				Password: "brand-new-password",
+				Reauth:   &Credentials{Identifier: "first@example.com", Password: "wrong"},
+			})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.True(t, kerr.HasMessage(4000006))
+		})
+
+		t.Run("when traits are invalid", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+			_, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{Traits: map[string]any{}})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Len(t, kerr.Field("traits.email"), 1)
+		})
+
+		t.Run("when link is requested natively", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+
+			_, err := UpdateSettings(t.Context(), fake.Front(), "", Settings{Method: MethodOIDC, Link: "mock"})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+
+		t.Run("when session is unknown", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+
+			_, err := UpdateSettings(t.Context(), fake.Front(), "absent", Settings{})
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusUnauthorized, kerr.Status)
+		})
+
+		t.Run("when method is unknown", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+			_, err := UpdateSettings(t.Context(), fake.Front(), token, Settings{Method: "totp"})
+			require.ErrorIs(t, err, ErrUnsupportedMethod)
+		})
+	})
+}
+
+func TestBrowser_UpdateSettings(t *testing.T) {
+	signedIn := func(t *testing.T) (*settingsKratos, *Browser) {
+		t.Helper()
+
+		fake := newSettingsKratos(t)
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		fake.Mux.HandleFunc("GET /signin", func(w http.ResponseWriter, r *http.Request) {
+			fake.SetSessionCookie(w, fake.Issue(map[string]any{"email": "first@example.com"}))
+		})
+
+		_, err = browser.Follow(t.Context(), fake.URL+"/signin")
+		require.NoError(t, err)
+
+		return fake, browser
+	}
+
+	t.Run("should be able to change password after re-authentication", func(t *testing.T) {
+		_, browser := signedIn(t)
+
+		identity, err := browser.UpdateSettings(t.Context(), Settings{
+			Method:   MethodPassword,
+			Password: "brand-new-password",
+			Reauth:   &Credentials{Identifier: "first@example.com", Password: fakePassword},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "first@example.com", identity.Traits.(map[string]any)["email"])
+	})
+
+	t.Run("should be able to link provider", func(t *testing.T) {
+		_, browser := signedIn(t)
+
+		identity, err := browser.UpdateSettings(t.Context(), Settings{
+			Method: MethodOIDC,
+			Link:   "mock",
+			Reauth: &Credentials{Identifier: "first@example.com", Password: fakePassword},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, identity.Id)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when privileged session is required", func(t *testing.T) {
+			_, browser := signedIn(t)
+
+			_, err := browser.UpdateSettings(t.Context(), Settings{Method: MethodOIDC, Link: "mock"})
+			require.ErrorIs(t, err, ErrPrivilegedSessionRequired)
+		})
+	})
+}
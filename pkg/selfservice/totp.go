@@ -0,0 +1,98 @@
+package selfservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // RFC 6238 authenticators use HMAC-SHA1
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+const (
+	MethodTOTP = "totp"
+
+	totpSecretNode = "totp_secret_key"
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 1_000_000
+)
+
+var ErrNoTOTPSecret = errors.New("settings flow offers no totp secret")
+
+// TOTPCode computes the RFC 6238 code of the base32 secret Kratos hands out
+// at time at, the way authenticator apps do.
+func TOTPCode(secret string, at time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).
+		DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode totp secret: %w", err)
+	}
+
+	counter := make([]byte, 8)
+	step := at.Unix() / int64(totpPeriod/time.Second)
+	binary.BigEndian.PutUint64(counter, uint64(step)) //nolint:gosec // unix time is positive
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%06d", code%totpDigits), nil
+}
+
+// TOTP is a code source computing the current code of secret.
+func TOTP(secret string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		return TOTPCode(secret, time.Now())
+	}
+}
+
+// EnrollTOTP pairs an authenticator with the identity behind the session
+// token through a native settings flow and returns its secret.
+func EnrollTOTP(ctx context.Context, front *client.APIClient, token string, reauth *Credentials) (string, error) {
+	return enrollTOTP(ctx, &settingsAgent{public: front, token: token}, reauth)
+}
+
+// EnrollTOTP is the browser counterpart of EnrollTOTP.
+func (b *Browser) EnrollTOTP(ctx context.Context, reauth *Credentials) (string, error) {
+	return enrollTOTP(ctx, &settingsAgent{public: b.Public}, reauth)
+}
+
+func enrollTOTP(ctx context.Context, agent *settingsAgent, reauth *Credentials) (string, error) {
+	return privileged(ctx, agent, reauth, func() (string, error) {
+		flow, err := agent.create(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		secret, ok := TextValue(flow.Ui, totpSecretNode)
+		if !ok {
+			return "", ErrNoTOTPSecret
+		}
+
+		code, err := TOTPCode(secret, time.Now())
+		if err != nil {
+			return "", err
+		}
+
+		_, err = agent.update(ctx, flow.Id, client.UpdateSettingsFlowBody{
+			UpdateSettingsFlowWithTotpMethod: &client.UpdateSettingsFlowWithTotpMethod{
+				Method:    MethodTOTP,
+				TotpCode:  client.PtrString(code),
+				CsrfToken: client.PtrString(CSRFToken(flow.Ui)),
+			},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to pair totp: %w", err)
+		}
+
+		return secret, nil
+	})
+}
@@ -0,0 +1,280 @@
+package selfservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+// fakeTOTPSecret is the RFC 6238 test key "12345678901234567890" in base32.
+const fakeTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// totpKratos is a fake Kratos pairing authenticators for fakeTOTPSecret and
+// upgrading sessions to aal2 with their codes. Sessions are privileged until
+// marked stale.
+type totpKratos struct {
+	*fakeKratos
+
+	mu     sync.Mutex
+	stale  map[string]bool
+	paired map[string]bool
+}
+
+func newTOTPKratos(t *testing.T) *totpKratos {
+	t.Helper()
+
+	fake := &totpKratos{fakeKratos: newFakeKratos(t), stale: map[string]bool{}, paired: map[string]bool{}}
+
+	settings := func(w http.ResponseWriter, r *http.Request) {
+		_, session, ok := fake.Lookup(r)
+		if !ok {
+			writeFake(w, http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": http.StatusUnauthorized}})
+
+			return
+		}
+
+		res := fake.Flow("api", map[string]any{
+			"type":     "text",
+			"group":    MethodTOTP,
+			"messages": []any{},
+			"meta":     map[string]any{},
+			"attributes": map[string]any{
+				"node_type": "text",
+				"id":        totpSecretNode,
+				"text":      map[string]any{"id": 1050006, "text": fakeTOTPSecret, "type": "info"},
+			},
+		})
+		res["identity"] = session["identity"]
+
+		writeFake(w, http.StatusOK, res)
+	}
+
+	login := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("aal") == aal2 && r.URL.Query().Get("refresh") != "true" {
+			writeFake(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": http.StatusBadRequest}})
+
+			return
+		}
+
+		writeFake(w, http.StatusOK, fake.Flow("api"))
+	}
+
+	fake.Mux.HandleFunc("GET /self-service/settings/api", settings)
+	fake.Mux.HandleFunc("GET /self-service/settings/browser", settings)
+	fake.Mux.HandleFunc("POST /self-service/settings", fake.pair)
+	fake.Mux.HandleFunc("GET /self-service/login/api", login)
+	fake.Mux.HandleFunc("GET /self-service/login/browser", login)
+	fake.Mux.HandleFunc("POST /self-service/login", fake.login)
+
+	return fake
+}
+
+func (f *totpKratos) pair(w http.ResponseWriter, r *http.Request) {
+	token, session, ok := f.Lookup(r)
+	if !ok {
+		writeFake(w, http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": http.StatusUnauthorized}})
+
+		return
+	}
+
+	f.mu.Lock()
+	stale := f.stale[token]
+	f.mu.Unlock()
+
+	if stale {
+		writeFake(w, http.StatusForbidden, map[string]any{
+			"error": map[string]any{"id": errSessionRefreshRequired, "code": http.StatusForbidden},
+		})
+
+		return
+	}
+
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	if !validTOTP(body["totp_code"]) {
+		f.reject(w, "show_form", "totp_code", 4000008, "The provided authentication code is invalid.")
+
+		return
+	}
+
+	f.mu.Lock()
+	f.paired[identityOf(session)] = true
+	f.mu.Unlock()
+
+	res := f.Flow("api")
+	res["state"] = "success"
+	res["identity"] = session["identity"]
+
+	writeFake(w, http.StatusOK, res)
+}
+
+func (f *totpKratos) login(w http.ResponseWriter, r *http.Request) {
+	token, session, ok := f.Lookup(r)
+
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch {
+	case ok && body["method"] == MethodPassword && body["password"] == fakePassword:
+		f.mu.Lock()
+		delete(f.stale, token)
+		f.mu.Unlock()
+	case ok && body["method"] == MethodTOTP && f.Paired(identityOf(session)):
+		if !validTOTP(body["totp_code"]) {
+			f.reject(w, "choose_method", "totp_code", 4000008, "The provided authentication code is invalid.")
+
+			return
+		}
+
+		f.fakeKratos.mu.Lock()
+		session["authenticator_assurance_level"] = aal2
+		session["authentication_methods"] = []any{
+			map[string]any{"method": MethodPassword, "aal": "aal1"},
+			map[string]any{"method": MethodTOTP, "aal": aal2},
+		}
+		f.fakeKratos.mu.Unlock()
+	default:
+		f.reject(w, "choose_method", "identifier", 4000006, "The provided credentials are invalid.")
+
+		return
+	}
+
+	writeFake(w, http.StatusOK, map[string]any{"session": session})
+}
+
+// validTOTP accepts the current and the previous code, like Kratos tolerating
+// a period boundary between computing and checking one.
+func validTOTP(code any) bool {
+	now := time.Now()
+
+	for _, at := range []time.Time{now, now.Add(-totpPeriod)} {
+		if expected, _ := TOTPCode(fakeTOTPSecret, at); code == expected {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *totpKratos) Paired(identity string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.paired[identity]
+}
+
+func (f *totpKratos) Stale(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stale[token] = true
+}
+
+func TestTOTPCode(t *testing.T) {
+	t.Run("should be able to match rfc 6238 vectors", func(t *testing.T) {
+		for at, exp := range map[int64]string{
+			59:         "287082",
+			1111111109: "081804",
+			1234567890: "005924",
+			2000000000: "279037",
+		} {
+			code, err := TOTPCode(fakeTOTPSecret, time.Unix(at, 0))
+			require.NoError(t, err)
+			assert.Equal(t, exp, code, at)
+		}
+	})
+
+	t.Run("should be able to accept lower case and padding", func(t *testing.T) {
+		code, err := TOTPCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq====", time.Unix(59, 0))
+		require.NoError(t, err)
+		assert.Equal(t, "287082", code)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when secret is not base32", func(t *testing.T) {
+			_, err := TOTP("not base32!")(t.Context())
+			require.Error(t, err)
+		})
+	})
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	t.Run("should be able to pair authenticator", func(t *testing.T) {
+		fake := newTOTPKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		secret, err := EnrollTOTP(t.Context(), fake.Front(), token, nil)
+		require.NoError(t, err)
+		assert.Equal(t, fakeTOTPSecret, secret)
+		assert.True(t, fake.Paired(identityOf(fake.sessions[token])))
+	})
+
+	t.Run("should be able to pair authenticator after re-authentication", func(t *testing.T) {
+		fake := newTOTPKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+		fake.Stale(token)
+
+		secret, err := EnrollTOTP(t.Context(), fake.Front(), token, &Credentials{
+			Identifier: "first@example.com",
+			Password:   fakePassword,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, fakeTOTPSecret, secret)
+	})
+
+	t.Run("should be able to pair authenticator in browser", func(t *testing.T) {
+		fake := newTOTPKratos(t)
+		token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+		browser, err := NewBrowser(fake.Front())
+		require.NoError(t, err)
+
+		fake.Mux.HandleFunc("GET /signin", func(w http.ResponseWriter, r *http.Request) {
+			fake.SetSessionCookie(w, token)
+		})
+
+		_, err = browser.Follow(t.Context(), fake.URL+"/signin")
+		require.NoError(t, err)
+
+		secret, err := browser.EnrollTOTP(t.Context(), nil)
+		require.NoError(t, err)
+		assert.Equal(t, fakeTOTPSecret, secret)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when privileged session is required", func(t *testing.T) {
+			fake := newTOTPKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+			fake.Stale(token)
+
+			_, err := EnrollTOTP(t.Context(), fake.Front(), token, nil)
+			require.ErrorIs(t, err, ErrPrivilegedSessionRequired)
+		})
+
+		t.Run("when flow offers no secret", func(t *testing.T) {
+			fake := newSettingsKratos(t)
+			token := fake.Issue(map[string]any{"email": "first@example.com"})
+
+			_, err := EnrollTOTP(t.Context(), fake.Front(), token, nil)
+			require.ErrorIs(t, err, ErrNoTOTPSecret)
+		})
+
+		t.Run("when session is unknown", func(t *testing.T) {
+			fake := newTOTPKratos(t)
+
+			_, err := EnrollTOTP(t.Context(), fake.Front(), "absent", nil)
+
+			var kerr *kratoserr.Error
+			require.ErrorAs(t, err, &kerr)
+			assert.Equal(t, http.StatusUnauthorized, kerr.Status)
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package selfservice
+
+import (
+	"fmt"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+func InputValue(ui client.UiContainer, name string) (any, bool) {
+	for _, node := range ui.Nodes {
+		input := node.Attributes.UiNodeInputAttributes
+		if input != nil && input.Name == name {
+			return input.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+func CSRFToken(ui client.UiContainer) string {
+	val, ok := InputValue(ui, "csrf_token")
+	if !ok || val == nil {
+		return ""
+	}
+
+	return fmt.Sprint(val)
+}
+
+// TextValue returns the text of the text node with id, e.g. a totp secret.
+func TextValue(ui client.UiContainer, id string) (string, bool) {
+	for _, node := range ui.Nodes {
+		text := node.Attributes.UiNodeTextAttributes
+		if text != nil && text.Id == id {
+			return text.Text.Text, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,202 @@
+package sessionhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	client "github.com/ory/kratos-client-go"
+
+	"github.com/godepo/grokratos/pkg/kratoserr"
+	"github.com/godepo/grokratos/pkg/selfservice"
+)
+
+var ErrNoSessionCookie = errors.New("kratos did not set a session cookie")
+
+const (
+	SessionTokenHeader = "X-Session-Token"
+	passwordMethod     = "password"
+)
+
+type (
+	Mode int
+
+	// Factory signs identities in through the public API and hands out
+	// clients calling the system under test on their behalf.
+	Factory struct {
+		Public *client.APIClient
+	}
+
+	// Session carries the credentials of a signed in identity: a session token
+	// for Token mode, Kratos cookies for Cookie mode.
+	Session struct {
+		*client.Session
+
+		Mode    Mode
+		Token   string
+		Cookies []*http.Cookie
+	}
+
+	transport struct {
+		session *Session
+		base    http.RoundTripper
+	}
+)
+
+const (
+	// Token authenticates requests with the X-Session-Token header, like native apps.
+	Token Mode = iota
+	// Cookie authenticates requests with Kratos session cookies, like browsers.
+	Cookie
+)
+
+func New(public *client.APIClient) *Factory {
+	return &Factory{Public: public}
+}
+
+// Login signs in with the password method.
+func (f *Factory) Login(ctx context.Context, identifier, password string, mode Mode) (*Session, error) {
+	if mode == Cookie {
+		return f.browserLogin(ctx, identifier, password)
+	}
+
+	return f.nativeLogin(ctx, identifier, password)
+}
+
+// As is Login in Token mode failing t on errors, for one line handler tests:
+//
+//	resp, err := deps.Sessions.As(t, "admin@example.com", "secret").Client().Get(url)
+func (f *Factory) As(t testing.TB, identifier, password string) *Session {
+	t.Helper()
+
+	session, err := f.Login(t.Context(), identifier, password, Token)
+	if err != nil {
+		t.Fatalf("failed to sign in as %s: %v", identifier, err)
+	}
+
+	return session
+}
+
+// AsBrowser is As in Cookie mode.
+func (f *Factory) AsBrowser(t testing.TB, identifier, password string) *Session {
+	t.Helper()
+
+	session, err := f.Login(t.Context(), identifier, password, Cookie)
+	if err != nil {
+		t.Fatalf("failed to sign in as %s: %v", identifier, err)
+	}
+
+	return session
+}
+
+func (f *Factory) nativeLogin(ctx context.Context, identifier, password string) (*Session, error) {
+	flow, resp, err := f.Public.FrontendAPI.CreateNativeLoginFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login flow: %w", kratoserr.FromResponse(resp, err))
+	}
+
+	_ = resp.Body.Close()
+
+	res, resp, err := f.Public.FrontendAPI.UpdateLoginFlow(ctx).Flow(flow.Id).
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{
+			UpdateLoginFlowWithPasswordMethod: client.NewUpdateLoginFlowWithPasswordMethod(
+				identifier, passwordMethod, password),
+		}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign in: %w", kratoserr.FromResponse(resp, err))
+	}
+
+	_ = resp.Body.Close()
+
+	return &Session{Session: &res.Session, Mode: Token, Token: res.GetSessionToken()}, nil
+}
+
+func (f *Factory) browserLogin(ctx context.Context, identifier, password string) (*Session, error) {
+	browser, err := selfservice.NewBrowser(f.Public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start browser: %w", err)
+	}
+
+	flow, resp, err := browser.Public.FrontendAPI.CreateBrowserLoginFlow(ctx).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create browser login flow: %w", kratoserr.FromResponse(resp, err))
+	}
+
+	_ = resp.Body.Close()
+
+	method := client.NewUpdateLoginFlowWithPasswordMethod(identifier, passwordMethod, password)
+	method.CsrfToken = client.PtrString(selfservice.CSRFToken(flow.Ui))
+
+	res, resp, err := browser.Public.FrontendAPI.UpdateLoginFlow(ctx).Flow(flow.Id).
+		UpdateLoginFlowBody(client.UpdateLoginFlowBody{UpdateLoginFlowWithPasswordMethod: method}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign in: %w", kratoserr.FromResponse(resp, err))
+	}
+
+	_ = resp.Body.Close()
+
+	cfg := f.Public.GetConfig()
+	cookies := browser.HTTP.Jar.Cookies(&url.URL{Scheme: cfg.Scheme, Host: cfg.Host, Path: "/"})
+
+	if len(cookies) == 0 {
+		return nil, ErrNoSessionCookie
+	}
+
+	return &Session{Session: &res.Session, Mode: Cookie, Cookies: cookies}, nil
+}
+
+// Authorize adds the session credentials to req.
+func (s *Session) Authorize(req *http.Request) {
+	if s.Mode == Cookie {
+		for _, cookie := range s.Cookies {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+
+		return
+	}
+
+	req.Header.Set(SessionTokenHeader, s.Token)
+}
+
+// RoundTripper authorizes every request before passing it to base, which
+// defaults to http.DefaultTransport.
+func (s *Session) RoundTripper(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{session: s, base: base}
+}
+
+func (s *Session) Client() *http.Client {
+	return &http.Client{Transport: s.RoundTripper(nil)}
+}
+
+func (s *Session) NewRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	s.Authorize(req)
+
+	return req, nil
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	authorized := req.Clone(req.Context())
+	t.session.Authorize(authorized)
+
+	resp, err := t.base.RoundTrip(authorized)
+	if err != nil {
+		return nil, fmt.Errorf("session transport: %w", err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,228 @@
+package sessionhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/internal/kratostest"
+	"github.com/godepo/grokratos/pkg/kratoserr"
+)
+
+const (
+	fakeCSRF     = "fake-csrf"
+	fakeCookie   = "ory_kratos_session"
+	fakePassword = "secret"
+)
+
+// fatalRecorder keeps what Fatalf was called with instead of stopping the test.
+type fatalRecorder struct {
+	testing.TB
+
+	fatal string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.fatal = fmt.Sprintf(format, args...)
+}
+
+func newFakeKratos(t *testing.T) *client.APIClient {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	srv, front := kratostest.Serve(t, mux)
+
+	flow := func() map[string]any {
+		now := time.Now()
+
+		return map[string]any{
+			"id":          uuid.NewString(),
+			"type":        "api",
+			"state":       "choose_method",
+			"issued_at":   now,
+			"expires_at":  now.Add(time.Hour),
+			"request_url": srv.URL,
+			"ui": map[string]any{
+				"action": srv.URL,
+				"method": http.MethodPost,
+				"nodes": []any{map[string]any{
+					"type":     "input",
+					"group":    "default",
+					"messages": []any{},
+					"meta":     map[string]any{},
+					"attributes": map[string]any{
+						"node_type": "input",
+						"name":      "csrf_token",
+						"type":      "hidden",
+						"value":     fakeCSRF,
+						"disabled":  false,
+					},
+				}},
+			},
+		}
+	}
+
+	mux.HandleFunc("GET /self-service/login/api", func(w http.ResponseWriter, _ *http.Request) {
+		kratostest.WriteJSON(w, http.StatusOK, flow())
+	})
+	mux.HandleFunc("GET /self-service/login/browser", func(w http.ResponseWriter, _ *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "csrf_token", Value: fakeCSRF, Path: "/"})
+		kratostest.WriteJSON(w, http.StatusOK, flow())
+	})
+	mux.HandleFunc("POST /self-service/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["password"] != fakePassword {
+			kratostest.WriteJSON(w, http.StatusBadRequest, map[string]any{
+				"error": map[string]any{"code": 400, "message": "denied"},
+			})
+
+			return
+		}
+
+		session := map[string]any{"id": uuid.NewString(), "active": true, "identity": map[string]any{
+			"id": uuid.NewString(), "schema_id": "user", "schema_url": srv.URL, "traits": map[string]any{},
+		}}
+
+		if body["csrf_token"] == nil {
+			kratostest.WriteJSON(w, http.StatusOK, map[string]any{
+				"session": session, "session_token": "token-" + session["id"].(string),
+			})
+
+			return
+		}
+
+		if cookie, err := r.Cookie("csrf_token"); err != nil || cookie.Value != body["csrf_token"] {
+			kratostest.WriteJSON(w, http.StatusForbidden, map[string]any{
+				"error": map[string]any{"code": 403, "message": "csrf"},
+			})
+
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: fakeCookie, Value: "cookie-" + session["id"].(string), Path: "/"})
+		kratostest.WriteJSON(w, http.StatusOK, map[string]any{"session": session})
+	})
+
+	return front
+}
+
+// newSUT echoes back what a Kratos authenticated handler would see.
+func newSUT(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := map[string]string{"token": r.Header.Get(SessionTokenHeader)}
+		if cookie, err := r.Cookie(fakeCookie); err == nil {
+			res["cookie"] = cookie.Value
+		}
+
+		kratostest.WriteJSON(w, http.StatusOK, res)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func call(t *testing.T, cl *http.Client, req *http.Request) map[string]string {
+	t.Helper()
+
+	resp, err := cl.Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	res := map[string]string{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+	return res
+}
+
+func TestFactory(t *testing.T) {
+	t.Run("should be able to call sut with session token", func(t *testing.T) {
+		sut := newSUT(t)
+		session := New(newFakeKratos(t)).As(t, "user@example.com", fakePassword)
+
+		require.NotNil(t, session.Session)
+		assert.Equal(t, Token, session.Mode)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, sut.URL, nil)
+		require.NoError(t, err)
+
+		got := call(t, session.Client(), req)
+		assert.Equal(t, "token-"+session.Id, got["token"])
+		assert.Empty(t, got["cookie"])
+	})
+
+	t.Run("should be able to call sut with session cookie", func(t *testing.T) {
+		sut := newSUT(t)
+		session := New(newFakeKratos(t)).AsBrowser(t, "user@example.com", fakePassword)
+
+		assert.Equal(t, Cookie, session.Mode)
+
+		req, err := session.NewRequest(t.Context(), http.MethodGet, sut.URL, nil)
+		require.NoError(t, err)
+
+		got := call(t, http.DefaultClient, req)
+		assert.Equal(t, "cookie-"+session.Id, got["cookie"])
+		assert.Empty(t, got["token"])
+	})
+
+	t.Run("should be able to keep original request untouched", func(t *testing.T) {
+		sut := newSUT(t)
+		session := &Session{Mode: Token, Token: "token"}
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, sut.URL, nil)
+		require.NoError(t, err)
+
+		cl := &http.Client{Transport: session.RoundTripper(http.DefaultTransport)}
+		assert.Equal(t, "token", call(t, cl, req)["token"])
+		assert.Empty(t, req.Header.Get(SessionTokenHeader))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when password is wrong", func(t *testing.T) {
+			factory := New(newFakeKratos(t))
+
+			_, err := factory.Login(t.Context(), "user@example.com", "wrong", Token)
+			require.ErrorAs(t, err, new(*kratoserr.Error))
+
+			_, err = factory.Login(t.Context(), "user@example.com", "wrong", Cookie)
+			require.ErrorAs(t, err, new(*kratoserr.Error))
+		})
+
+		t.Run("when signing in fails for any tb", func(t *testing.T) {
+			factory := New(newFakeKratos(t))
+
+			for _, as := range []func(testing.TB, string, string) *Session{factory.As, factory.AsBrowser} {
+				rec := &fatalRecorder{TB: t}
+				assert.Nil(t, as(rec, "user@example.com", "wrong"))
+				assert.Contains(t, rec.fatal, "failed to sign in as user@example.com")
+			}
+		})
+
+		t.Run("when request is malformed", func(t *testing.T) {
+			_, err := (&Session{}).NewRequest(t.Context(), "bad method", "http://localhost", nil)
+			require.Error(t, err)
+		})
+
+		t.Run("when sut is unavailable", func(t *testing.T) {
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1:1", nil)
+			require.NoError(t, err)
+
+			_, err = (&Session{}).Client().Do(req)
+			require.Error(t, err)
+		})
+	})
+}
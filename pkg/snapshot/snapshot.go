@@ -0,0 +1,533 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+
+	client "github.com/ory/kratos-client-go"
+)
+
+var (
+	ErrNoSnapshot    = errors.New("snapshot was not captured")
+	ErrNotRestorable = errors.New("snapshot cannot be restored")
+)
+
+const (
+	pageSize = 500
+
+	credentialsPassword = "password"
+	credentialsOIDC     = "oidc"
+)
+
+// removable are credential types the admin API can delete but not import, so
+// Restore drops them when gained and can't bring them back when lost.
+var removable = []string{"totp", "lookup_secret", "webauthn", "passkey"}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+type (
+	// Snapshot keeps identities with their credentials and the ids of active
+	// sessions, exported through the admin API, or a dump of the database
+	// with WithDumper. Identities deleted after Capture come back under new
+	// ids, see ID. Restoring is not safe while tests run in parallel against
+	// the same Kratos.
+	Snapshot struct {
+		admin      *client.APIClient
+		identities []client.Identity
+		sessions   map[string]bool
+		ids        map[string]string
+		hooks      []func(ctx context.Context, snap *Snapshot) error
+		dumper     Dumper
+		dump       []byte
+	}
+
+	// Dumper saves and loads the whole database of Kratos, e.g. a
+	// *sqldump.Dumper.
+	Dumper interface {
+		Dump(ctx context.Context) ([]byte, error)
+		Load(ctx context.Context, dump []byte) error
+	}
+
+	Option func(*Snapshot)
+)
+
+// WithDumper captures and restores the database through d instead of the
+// admin API, bringing back sessions and every credential type as they were.
+func WithDumper(d Dumper) Option {
+	return func(s *Snapshot) {
+		s.dumper = d
+	}
+}
+
+func Capture(ctx context.Context, admin *client.APIClient, opts ...Option) (*Snapshot, error) {
+	res := &Snapshot{admin: admin}
+
+	for _, fn := range opts {
+		fn(res)
+	}
+
+	identities, err := export(ctx, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(identities))
+	for _, identity := range identities {
+		ids[identity.Id] = identity.Id
+	}
+
+	res.identities, res.ids = identities, ids
+
+	if res.dumper != nil {
+		if res.dump, err = res.dumper.Dump(ctx); err != nil {
+			return nil, fmt.Errorf("failed to dump kratos database: %w", err)
+		}
+
+		return res, nil
+	}
+
+	sessions, err := exportSessions(ctx, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	res.sessions = make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		res.sessions[session.Id] = true
+	}
+
+	return res, nil
+}
+
+func (s *Snapshot) Identities() []client.Identity {
+	if s == nil {
+		return nil
+	}
+
+	return append([]client.Identity(nil), s.identities...)
+}
+
+// ID maps the id an identity had at Capture to its current id.
+func (s *Snapshot) ID(captured string) string {
+	if s == nil {
+		return captured
+	}
+
+	if id, ok := s.ids[captured]; ok {
+		return id
+	}
+
+	return captured
+}
+
+// OnRestore runs fn after each successful Restore, e.g. to follow identities
+// recreated under new ids.
+func (s *Snapshot) OnRestore(fn func(ctx context.Context, snap *Snapshot) error) {
+	s.hooks = append(s.hooks, fn)
+}
+
+// Restore brings identities and their credentials back to the captured state,
+// deletes identities created after Capture and revokes sessions that were not
+// active at Capture. Without a Dumper Kratos can't revive sessions or import
+// totp, lookup secret, webauthn and passkey credentials; Restore fails with
+// ErrNotRestorable when captured ones of those are gone.
+func (s *Snapshot) Restore(ctx context.Context) error {
+	if s == nil {
+		return ErrNoSnapshot
+	}
+
+	if s.dumper != nil {
+		if err := s.dumper.Load(ctx, s.dump); err != nil {
+			return fmt.Errorf("failed to load kratos database: %w", err)
+		}
+
+		return s.restored(ctx)
+	}
+
+	if err := s.restoreIdentities(ctx); err != nil {
+		return err
+	}
+
+	if err := s.revokeSessions(ctx); err != nil {
+		return err
+	}
+
+	return s.restored(ctx)
+}
+
+func (s *Snapshot) restored(ctx context.Context) error {
+	for _, hook := range s.hooks {
+		if err := hook(ctx, s); err != nil {
+			return fmt.Errorf("failed to run restore hook: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Snapshot) restoreIdentities(ctx context.Context) error {
+	current, err := export(ctx, s.admin)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]client.Identity, len(current))
+	keep := make(map[string]bool, len(s.identities))
+
+	for _, identity := range current {
+		live[identity.Id] = identity
+	}
+
+	for _, identity := range s.identities {
+		id := s.ids[identity.Id]
+
+		now, ok := live[id]
+		if ok && !gainedPassword(identity, now) {
+			if err := s.update(ctx, id, identity, now); err != nil {
+				return err
+			}
+
+			keep[id] = true
+
+			continue
+		}
+
+		// kratos can't delete a password, an identity that gained one is
+		// recreated without it
+		if kind, ok := unimportable(identity); ok {
+			return fmt.Errorf("%w: identity %s can't be recreated with %s credentials", ErrNotRestorable, identity.Id, kind)
+		}
+
+		if ok {
+			if err := s.delete(ctx, id); err != nil {
+				return err
+			}
+		}
+
+		id, err := s.create(ctx, identity)
+		if err != nil {
+			return err
+		}
+
+		s.ids[identity.Id] = id
+		keep[id] = true
+	}
+
+	for _, identity := range current {
+		if keep[identity.Id] {
+			continue
+		}
+
+		if err := s.delete(ctx, identity.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Snapshot) update(ctx context.Context, id string, identity, now client.Identity) error {
+	if err := s.removeGained(ctx, id, identity, now); err != nil {
+		return err
+	}
+
+	_, resp, err := s.admin.IdentityAPI.UpdateIdentity(ctx, id).
+		UpdateIdentityBody(client.UpdateIdentityBody{
+			SchemaId:       identity.SchemaId,
+			State:          identity.GetState(),
+			Traits:         traits(identity),
+			MetadataPublic: identity.MetadataPublic,
+			MetadataAdmin:  identity.MetadataAdmin,
+			Credentials:    credentials(identity),
+		}).
+		Execute()
+	if err := closed(resp, err); err != nil {
+		return fmt.Errorf("failed to restore identity %s: %w", id, err)
+	}
+
+	return s.restoreAddresses(ctx, id, identity)
+}
+
+// removeGained deletes credentials now has beyond the captured identity.
+func (s *Snapshot) removeGained(ctx context.Context, id string, identity, now client.Identity) error {
+	was, is := credentialsOf(identity), credentialsOf(now)
+
+	for _, kind := range removable {
+		before, had := was[kind]
+		after, has := is[kind]
+
+		switch {
+		case had && (!has || !reflect.DeepEqual(before.Config, after.Config)):
+			return fmt.Errorf("%w: identity %s lost its %s credentials", ErrNotRestorable, id, kind)
+		case has && !had:
+			if err := s.deleteCredentials(ctx, id, kind, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	linked := was[credentialsOIDC].Identifiers
+
+	for _, identifier := range is[credentialsOIDC].Identifiers {
+		if slices.Contains(linked, identifier) {
+			continue
+		}
+
+		if err := s.deleteCredentials(ctx, id, credentialsOIDC, identifier); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Snapshot) deleteCredentials(ctx context.Context, id, kind, identifier string) error {
+	req := s.admin.IdentityAPI.DeleteIdentityCredentials(ctx, id, kind)
+	if identifier != "" {
+		req = req.Identifier(identifier)
+	}
+
+	if err := closed(req.Execute()); err != nil {
+		return fmt.Errorf("failed to delete %s credentials of %s: %w", kind, id, err)
+	}
+
+	return nil
+}
+
+func (s *Snapshot) delete(ctx context.Context, id string) error {
+	if err := closed(s.admin.IdentityAPI.DeleteIdentity(ctx, id).Execute()); err != nil {
+		return fmt.Errorf("failed to delete identity %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *Snapshot) revokeSessions(ctx context.Context) error {
+	sessions, err := exportSessions(ctx, s.admin)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if s.sessions[session.Id] {
+			continue
+		}
+
+		resp, err := s.admin.IdentityAPI.DisableSession(ctx, session.Id).Execute()
+		if err := closed(resp, err); err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return fmt.Errorf("failed to revoke session %s: %w", session.Id, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Snapshot) create(ctx context.Context, identity client.Identity) (string, error) {
+	body := client.CreateIdentityBody{
+		SchemaId:            identity.SchemaId,
+		State:               identity.State,
+		Traits:              traits(identity),
+		MetadataPublic:      identity.MetadataPublic,
+		MetadataAdmin:       identity.MetadataAdmin,
+		Credentials:         credentials(identity),
+		VerifiableAddresses: identity.VerifiableAddresses,
+	}
+
+	created, resp, err := s.admin.IdentityAPI.CreateIdentity(ctx).CreateIdentityBody(body).Execute()
+	if err := closed(resp, err); err != nil {
+		return "", fmt.Errorf("failed to recreate identity %s: %w", identity.Id, err)
+	}
+
+	return created.Id, nil
+}
+
+func (s *Snapshot) restoreAddresses(ctx context.Context, id string, identity client.Identity) error {
+	if len(identity.VerifiableAddresses) == 0 {
+		return nil
+	}
+
+	_, resp, err := s.admin.IdentityAPI.PatchIdentity(ctx, id).
+		JsonPatch([]client.JsonPatch{{
+			Op:    "replace",
+			Path:  "/verifiable_addresses",
+			Value: identity.VerifiableAddresses,
+		}}).
+		Execute()
+	if err := closed(resp, err); err != nil {
+		return fmt.Errorf("failed to restore addresses of %s: %w", id, err)
+	}
+
+	return nil
+}
+
+func export(ctx context.Context, admin *client.APIClient) ([]client.Identity, error) {
+	var (
+		res   []client.Identity
+		token string
+	)
+
+	for {
+		req := admin.IdentityAPI.ListIdentities(ctx).
+			PageSize(pageSize).
+			IncludeCredential(append([]string{credentialsPassword, credentialsOIDC}, removable...))
+		if token != "" {
+			req = req.PageToken(token)
+		}
+
+		page, resp, err := req.Execute()
+		if err := closed(resp, err); err != nil {
+			return nil, fmt.Errorf("failed to export identities: %w", err)
+		}
+
+		res = append(res, page...)
+
+		token = nextPageToken(resp)
+		if token == "" || len(page) == 0 {
+			return res, nil
+		}
+	}
+}
+
+func exportSessions(ctx context.Context, admin *client.APIClient) ([]client.Session, error) {
+	var (
+		res   []client.Session
+		token string
+	)
+
+	for {
+		req := admin.IdentityAPI.ListSessions(ctx).Active(true).PageSize(pageSize)
+		if token != "" {
+			req = req.PageToken(token)
+		}
+
+		page, resp, err := req.Execute()
+		if err := closed(resp, err); err != nil {
+			return nil, fmt.Errorf("failed to export sessions: %w", err)
+		}
+
+		res = append(res, page...)
+
+		token = nextPageToken(resp)
+		if token == "" || len(page) == 0 {
+			return res, nil
+		}
+	}
+}
+
+func closed(resp *http.Response, err error) error {
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+
+	return err
+}
+
+func nextPageToken(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+
+	for _, link := range resp.Header.Values("Link") {
+		match := nextLink.FindStringSubmatch(link)
+		if match == nil {
+			continue
+		}
+
+		next, err := url.Parse(match[1])
+		if err != nil {
+			return ""
+		}
+
+		return next.Query().Get("page_token")
+	}
+
+	return ""
+}
+
+func traits(identity client.Identity) map[string]any {
+	if res, ok := identity.Traits.(map[string]any); ok {
+		return res
+	}
+
+	return map[string]any{}
+}
+
+func credentialsOf(identity client.Identity) map[string]client.IdentityCredentials {
+	if identity.Credentials == nil {
+		return nil
+	}
+
+	return *identity.Credentials
+}
+
+// gainedPassword reports whether now has a password the captured identity
+// had not, which only recreating the identity removes.
+func gainedPassword(identity, now client.Identity) bool {
+	_, had := credentialsOf(identity)[credentialsPassword]
+	_, has := credentialsOf(now)[credentialsPassword]
+
+	return has && !had
+}
+
+func unimportable(identity client.Identity) (string, bool) {
+	for _, kind := range removable {
+		if _, ok := credentialsOf(identity)[kind]; ok {
+			return kind, true
+		}
+	}
+
+	return "", false
+}
+
+func credentials(identity client.Identity) *client.IdentityWithCredentials {
+	if identity.Credentials == nil {
+		return nil
+	}
+
+	var res client.IdentityWithCredentials
+
+	if pass, ok := (*identity.Credentials)[credentialsPassword]; ok {
+		if hash, ok := pass.Config["hashed_password"].(string); ok && hash != "" {
+			res.Password = &client.IdentityWithCredentialsPassword{
+				Config: &client.IdentityWithCredentialsPasswordConfig{HashedPassword: &hash},
+			}
+		}
+	}
+
+	if oidc, ok := (*identity.Credentials)[credentialsOIDC]; ok {
+		if providers := oidcProviders(oidc.Config); len(providers) > 0 {
+			res.Oidc = &client.IdentityWithCredentialsOidc{
+				Config: &client.IdentityWithCredentialsOidcConfig{Providers: providers},
+			}
+		}
+	}
+
+	if res.Password == nil && res.Oidc == nil {
+		return nil
+	}
+
+	return &res
+}
+
+func oidcProviders(config map[string]any) []client.IdentityWithCredentialsOidcConfigProvider {
+	raw, _ := config["providers"].([]any)
+	res := make([]client.IdentityWithCredentialsOidcConfigProvider, 0, len(raw))
+
+	for _, item := range raw {
+		entry, _ := item.(map[string]any)
+		provider, _ := entry["provider"].(string)
+		subject, _ := entry["subject"].(string)
+
+		if provider != "" && subject != "" {
+			res = append(res, *client.NewIdentityWithCredentialsOidcConfigProvider(provider, subject))
+		}
+	}
+
+	return res
+}
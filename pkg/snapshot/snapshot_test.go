@@ -0,0 +1,617 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	client "github.com/ory/kratos-client-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/internal/kratostest"
+)
+
+type fakeAdmin struct {
+	mu         sync.Mutex
+	identities map[string]client.Identity
+	sessions   map[string]string
+	failUpdate bool
+}
+
+// fakeDumper hands out dump and records what Restore loads.
+type fakeDumper struct {
+	dump    []byte
+	loaded  [][]byte
+	dumpErr error
+	loadErr error
+}
+
+func (d *fakeDumper) Dump(context.Context) ([]byte, error) {
+	return d.dump, d.dumpErr
+}
+
+func (d *fakeDumper) Load(_ context.Context, dump []byte) error {
+	d.loaded = append(d.loaded, dump)
+
+	return d.loadErr
+}
+
+func newFakeAdmin(t *testing.T) (*fakeAdmin, *client.APIClient) {
+	t.Helper()
+
+	fake := &fakeAdmin{identities: map[string]client.Identity{}, sessions: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/identities", fake.list)
+	mux.HandleFunc("POST /admin/identities", fake.create)
+	mux.HandleFunc("PUT /admin/identities/{id}", fake.update)
+	mux.HandleFunc("PATCH /admin/identities/{id}", fake.patch)
+	mux.HandleFunc("DELETE /admin/identities/{id}", fake.delete)
+	mux.HandleFunc("DELETE /admin/identities/{id}/credentials/{type}", fake.deleteCredentials)
+	mux.HandleFunc("GET /admin/sessions", fake.listSessions)
+	mux.HandleFunc("DELETE /admin/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		delete(fake.sessions, r.PathValue("id"))
+		fake.mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	_, admin := kratostest.Serve(t, mux)
+
+	return fake, admin
+}
+
+func (f *fakeAdmin) add(email, hash string) string {
+	creds := map[string]client.IdentityCredentials{
+		"oidc": oidcCredentials(email),
+	}
+
+	if hash != "" {
+		creds["password"] = passwordCredentials(hash)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := uuid.NewString()
+	f.identities[id] = client.Identity{
+		Id:          id,
+		SchemaId:    "user",
+		State:       client.PtrString("active"),
+		Traits:      map[string]any{"email": email},
+		Credentials: &creds,
+		VerifiableAddresses: []client.VerifiableIdentityAddress{
+			*client.NewVerifiableIdentityAddress("completed", email, true, "email"),
+		},
+	}
+
+	return id
+}
+
+func passwordCredentials(hash string) client.IdentityCredentials {
+	return client.IdentityCredentials{Config: map[string]any{"hashed_password": hash}}
+}
+
+func oidcCredentials(subjects ...string) client.IdentityCredentials {
+	providers := make([]any, 0, len(subjects))
+	identifiers := make([]string, 0, len(subjects))
+
+	for _, subject := range subjects {
+		providers = append(providers, map[string]any{"provider": "social", "subject": subject})
+		identifiers = append(identifiers, "social:"+subject)
+	}
+
+	return client.IdentityCredentials{Config: map[string]any{"providers": providers}, Identifiers: identifiers}
+}
+
+func (f *fakeAdmin) get(id string) (client.Identity, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	identity, ok := f.identities[id]
+
+	return identity, ok
+}
+
+func (f *fakeAdmin) set(identity client.Identity) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.identities[identity.Id] = identity
+}
+
+// credential adds kind to the identity with id.
+func (f *fakeAdmin) credential(id, kind string, creds client.IdentityCredentials) {
+	identity, _ := f.get(id)
+
+	all := credentialMap(identity)
+	all[kind] = creds
+	identity.Credentials = &all
+	f.set(identity)
+}
+
+func (f *fakeAdmin) signIn(id string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session := uuid.NewString()
+	f.sessions[session] = id
+
+	return session
+}
+
+func (f *fakeAdmin) active(session string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.sessions[session]
+
+	return ok
+}
+
+func credentialMap(identity client.Identity) map[string]client.IdentityCredentials {
+	res := map[string]client.IdentityCredentials{}
+
+	if identity.Credentials != nil {
+		for kind, creds := range *identity.Credentials {
+			res[kind] = creds
+		}
+	}
+
+	return res
+}
+
+func (f *fakeAdmin) list(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ids := make([]string, 0, len(f.identities))
+	for id := range f.identities {
+		ids = append(ids, id)
+	}
+
+	slices.Sort(ids)
+
+	// pages of one identity make Capture walk the link header
+	const size = 1
+
+	from, _ := strconv.Atoi(r.URL.Query().Get("page_token"))
+	to := min(from+size, len(ids))
+
+	if to < len(ids) {
+		w.Header().Add("Link", `</admin/identities?page_size=1&page_token=`+strconv.Itoa(to)+`>; rel="next"`)
+	}
+
+	page := make([]client.Identity, 0, size)
+	for _, id := range ids[from:to] {
+		page = append(page, f.identities[id])
+	}
+
+	kratostest.WriteJSON(w, http.StatusOK, page)
+}
+
+func (f *fakeAdmin) listSessions(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	page := make([]map[string]any, 0, len(f.sessions))
+	for session := range f.sessions {
+		page = append(page, map[string]any{"id": session})
+	}
+
+	kratostest.WriteJSON(w, http.StatusOK, page)
+}
+
+func (f *fakeAdmin) create(w http.ResponseWriter, r *http.Request) {
+	var body client.CreateIdentityBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	identity := client.Identity{
+		Id:                  uuid.NewString(),
+		SchemaId:            body.SchemaId,
+		State:               body.State,
+		Traits:              body.Traits,
+		VerifiableAddresses: body.VerifiableAddresses,
+	}
+	identity.Credentials = imported(identity, body.Credentials)
+	f.set(identity)
+
+	kratostest.WriteJSON(w, http.StatusCreated, identity)
+}
+
+func (f *fakeAdmin) update(w http.ResponseWriter, r *http.Request) {
+	identity, ok := f.get(r.PathValue("id"))
+	if !ok || f.failUpdate {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	var body client.UpdateIdentityBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	identity.Traits = body.Traits
+	identity.State = &body.State
+	identity.MetadataPublic = body.MetadataPublic
+	identity.Credentials = imported(identity, body.Credentials)
+	f.set(identity)
+
+	kratostest.WriteJSON(w, http.StatusOK, identity)
+}
+
+// imported merges credentials the way Kratos imports them, keeping kinds the
+// body leaves out.
+func imported(identity client.Identity, body *client.IdentityWithCredentials) *map[string]client.IdentityCredentials {
+	res := credentialMap(identity)
+
+	if body == nil {
+		return &res
+	}
+
+	if body.Password != nil {
+		res["password"] = passwordCredentials(body.Password.Config.GetHashedPassword())
+	}
+
+	if body.Oidc != nil {
+		subjects := make([]string, 0, len(body.Oidc.Config.Providers))
+		for _, provider := range body.Oidc.Config.Providers {
+			subjects = append(subjects, provider.Subject)
+		}
+
+		for _, identifier := range res["oidc"].Identifiers {
+			if subject := identifier[len("social:"):]; !slices.Contains(subjects, subject) {
+				subjects = append(subjects, subject)
+			}
+		}
+
+		res["oidc"] = oidcCredentials(subjects...)
+	}
+
+	return &res
+}
+
+func (f *fakeAdmin) patch(w http.ResponseWriter, r *http.Request) {
+	identity, ok := f.get(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	var ops []struct {
+		Path  string                             `json:"path"`
+		Value []client.VerifiableIdentityAddress `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil || ops[0].Path != "/verifiable_addresses" {
+		http.Error(w, "unexpected patch", http.StatusBadRequest)
+
+		return
+	}
+
+	identity.VerifiableAddresses = ops[0].Value
+	f.set(identity)
+
+	kratostest.WriteJSON(w, http.StatusOK, identity)
+}
+
+func (f *fakeAdmin) delete(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.identities, r.PathValue("id"))
+
+	for session, owner := range f.sessions {
+		if owner == r.PathValue("id") {
+			delete(f.sessions, session)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeAdmin) deleteCredentials(w http.ResponseWriter, r *http.Request) {
+	identity, ok := f.get(r.PathValue("id"))
+	kind := r.PathValue("type")
+
+	if !ok || kind == "password" {
+		kratostest.WriteJSON(w, http.StatusBadRequest, map[string]any{"error": map[string]any{"code": 400}})
+
+		return
+	}
+
+	all := credentialMap(identity)
+
+	if identifier := r.URL.Query().Get("identifier"); kind == "oidc" && identifier != "" {
+		subjects := []string{}
+
+		for _, known := range all["oidc"].Identifiers {
+			if known != identifier {
+				subjects = append(subjects, known[len("social:"):])
+			}
+		}
+
+		all["oidc"] = oidcCredentials(subjects...)
+	} else {
+		delete(all, kind)
+	}
+
+	identity.Credentials = &all
+	f.set(identity)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("should be able to restore changed identity", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		id := fake.add("admin@example.com", "$2a$10$hash")
+		fake.add("user@example.com", "$2a$10$other")
+
+		snap, err := Capture(t.Context(), admin)
+		require.NoError(t, err)
+		require.Len(t, snap.Identities(), 2)
+
+		changed, _ := fake.get(id)
+		changed.Traits = map[string]any{"email": "changed@example.com"}
+		changed.State = client.PtrString("inactive")
+		changed.VerifiableAddresses[0].Verified = false
+		fake.set(changed)
+		fake.credential(id, "password", passwordCredentials("$2a$10$changed"))
+
+		require.NoError(t, snap.Restore(t.Context()))
+
+		restored, ok := fake.get(id)
+		require.True(t, ok)
+		assert.Equal(t, "admin@example.com", restored.Traits.(map[string]any)["email"])
+		assert.Equal(t, "active", restored.GetState())
+		assert.True(t, restored.VerifiableAddresses[0].Verified)
+		assert.Equal(t, "$2a$10$hash", (*restored.Credentials)["password"].Config["hashed_password"])
+		assert.Equal(t, id, snap.ID(id))
+	})
+
+	t.Run("should be able to delete identities created after capture", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		fake.add("admin@example.com", "$2a$10$hash")
+
+		snap, err := Capture(t.Context(), admin)
+		require.NoError(t, err)
+
+		extra := fake.add("extra@example.com", "$2a$10$extra")
+
+		require.NoError(t, snap.Restore(t.Context()))
+
+		_, ok := fake.get(extra)
+		assert.False(t, ok)
+		assert.Len(t, fake.identities, 1)
+	})
+
+	t.Run("should be able to recreate deleted identity", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		id := fake.add("admin@example.com", "$2a$10$hash")
+
+		snap, err := Capture(t.Context(), admin)
+		require.NoError(t, err)
+
+		var rebound []string
+
+		snap.OnRestore(func(_ context.Context, snap *Snapshot) error {
+			rebound = append(rebound, snap.ID(id))
+
+			return nil
+		})
+
+		fake.mu.Lock()
+		delete(fake.identities, id)
+		fake.mu.Unlock()
+
+		require.NoError(t, snap.Restore(t.Context()))
+
+		recreated, ok := fake.get(snap.ID(id))
+		require.True(t, ok)
+		assert.NotEqual(t, id, recreated.Id)
+		assert.Equal(t, "admin@example.com", recreated.Traits.(map[string]any)["email"])
+		assert.Equal(t, "$2a$10$hash", (*recreated.Credentials)["password"].Config["hashed_password"])
+
+		require.NoError(t, snap.Restore(t.Context()))
+		assert.Len(t, fake.identities, 1)
+		assert.Equal(t, []string{recreated.Id, recreated.Id}, rebound)
+	})
+
+	t.Run("should be able to drop credentials gained after capture", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		id := fake.add("admin@example.com", "$2a$10$hash")
+
+		snap, err := Capture(t.Context(), admin)
+		require.NoError(t, err)
+
+		fake.credential(id, "totp", client.IdentityCredentials{Config: map[string]any{"totp_url": "otpauth://totp/x"}})
+		fake.credential(id, "oidc", oidcCredentials("admin@example.com", "linked@example.com"))
+
+		require.NoError(t, snap.Restore(t.Context()))
+
+		restored, _ := fake.get(id)
+		assert.NotContains(t, *restored.Credentials, "totp")
+		assert.Equal(t, []string{"social:admin@example.com"}, (*restored.Credentials)["oidc"].Identifiers)
+		assert.Equal(t, id, snap.ID(id))
+	})
+
+	t.Run("should be able to recreate identity that gained password", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		id := fake.add("social@example.com", "")
+
+		snap, err := Capture(t.Context(), admin)
+		require.NoError(t, err)
+
+		fake.credential(id, "password", passwordCredentials("$2a$10$gained"))
+
+		require.NoError(t, snap.Restore(t.Context()))
+
+		_, ok := fake.get(id)
+		assert.False(t, ok)
+
+		recreated, ok := fake.get(snap.ID(id))
+		require.True(t, ok)
+		assert.NotContains(t, *recreated.Credentials, "password")
+		assert.Equal(t, []string{"social:social@example.com"}, (*recreated.Credentials)["oidc"].Identifiers)
+	})
+
+	t.Run("should be able to revoke sessions created after capture", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		id := fake.add("admin@example.com", "$2a$10$hash")
+		kept := fake.signIn(id)
+
+		snap, err := Capture(t.Context(), admin)
+		require.NoError(t, err)
+
+		later := fake.signIn(id)
+
+		require.NoError(t, snap.Restore(t.Context()))
+		assert.True(t, fake.active(kept))
+		assert.False(t, fake.active(later))
+	})
+
+	t.Run("should be able to restore database dump", func(t *testing.T) {
+		fake, admin := newFakeAdmin(t)
+		id := fake.add("admin@example.com", "$2a$10$hash")
+		dumper := &fakeDumper{dump: []byte("dump")}
+
+		snap, err := Capture(t.Context(), admin, WithDumper(dumper))
+		require.NoError(t, err)
+		require.Len(t, snap.Identities(), 1)
+
+		fake.credential(id, "totp", client.IdentityCredentials{Config: map[string]any{"totp_url": "otpauth://totp/x"}})
+
+		hooks := 0
+		snap.OnRestore(func(context.Context, *Snapshot) error {
+			hooks++
+
+			return nil
+		})
+
+		require.NoError(t, snap.Restore(t.Context()))
+		assert.Equal(t, [][]byte{[]byte("dump")}, dumper.loaded)
+		assert.Equal(t, 1, hooks)
+		assert.Equal(t, id, snap.ID(id))
+
+		// the dump covers credentials, the admin api is left alone
+		identity, _ := fake.get(id)
+		assert.Contains(t, credentialMap(identity), "totp")
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when database cant be dumped", func(t *testing.T) {
+			_, admin := newFakeAdmin(t)
+			expErr := errors.New(uuid.NewString())
+
+			_, err := Capture(t.Context(), admin, WithDumper(&fakeDumper{dumpErr: expErr}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when dump cant be loaded", func(t *testing.T) {
+			_, admin := newFakeAdmin(t)
+			expErr := errors.New(uuid.NewString())
+
+			snap, err := Capture(t.Context(), admin, WithDumper(&fakeDumper{loadErr: expErr}))
+			require.NoError(t, err)
+			require.ErrorIs(t, snap.Restore(t.Context()), expErr)
+		})
+
+		t.Run("when snapshot is nil", func(t *testing.T) {
+			var snap *Snapshot
+			require.ErrorIs(t, snap.Restore(t.Context()), ErrNoSnapshot)
+			assert.Nil(t, snap.Identities())
+			assert.Equal(t, "id", snap.ID("id"))
+		})
+
+		t.Run("when admin api is unavailable", func(t *testing.T) {
+			_, err := Capture(t.Context(), kratostest.Client("127.0.0.1:1"))
+			require.Error(t, err)
+		})
+
+		t.Run("when identity cant be updated", func(t *testing.T) {
+			fake, admin := newFakeAdmin(t)
+			fake.add("admin@example.com", "$2a$10$hash")
+
+			snap, err := Capture(t.Context(), admin)
+			require.NoError(t, err)
+
+			fake.failUpdate = true
+			require.ErrorContains(t, snap.Restore(t.Context()), "failed to restore identity")
+		})
+
+		t.Run("when captured totp is gone", func(t *testing.T) {
+			fake, admin := newFakeAdmin(t)
+			id := fake.add("admin@example.com", "$2a$10$hash")
+			fake.credential(id, "totp", client.IdentityCredentials{Config: map[string]any{"totp_url": "otpauth://totp/x"}})
+
+			snap, err := Capture(t.Context(), admin)
+			require.NoError(t, err)
+
+			identity, _ := fake.get(id)
+			all := credentialMap(identity)
+			delete(all, "totp")
+			identity.Credentials = &all
+			fake.set(identity)
+
+			require.ErrorIs(t, snap.Restore(t.Context()), ErrNotRestorable)
+		})
+
+		t.Run("when identity with totp gained password", func(t *testing.T) {
+			fake, admin := newFakeAdmin(t)
+			id := fake.add("social@example.com", "")
+			fake.credential(id, "totp", client.IdentityCredentials{Config: map[string]any{"totp_url": "otpauth://totp/x"}})
+
+			snap, err := Capture(t.Context(), admin)
+			require.NoError(t, err)
+
+			fake.credential(id, "password", passwordCredentials("$2a$10$gained"))
+
+			require.ErrorIs(t, snap.Restore(t.Context()), ErrNotRestorable)
+
+			_, ok := fake.get(id)
+			assert.True(t, ok)
+		})
+
+		t.Run("when restore hook fails", func(t *testing.T) {
+			_, admin := newFakeAdmin(t)
+			expErr := errors.New(uuid.NewString())
+
+			snap, err := Capture(t.Context(), admin)
+			require.NoError(t, err)
+
+			snap.OnRestore(func(context.Context, *Snapshot) error {
+				return expErr
+			})
+
+			require.ErrorIs(t, snap.Restore(t.Context()), expErr)
+		})
+	})
+}
+
+func TestNextPageToken(t *testing.T) {
+	t.Run("should be able to read next token from link header", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Add("Link", `</admin/identities?page_token=first>; rel="first",`+
+			`</admin/identities?page_size=2&page_token=abc>; rel="next"`)
+
+		assert.Equal(t, "abc", nextPageToken(resp))
+		assert.Empty(t, nextPageToken(&http.Response{Header: http.Header{}}))
+		assert.Empty(t, nextPageToken(nil))
+	})
+}
@@ -0,0 +1,380 @@
+// Package sqldump saves and loads the SQL database behind a running Kratos,
+// picking the tools from its DSN.
+package sqldump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+)
+
+var (
+	ErrNoDatabase     = errors.New("kratos dsn does not name a database")
+	ErrUnsupportedDSN = errors.New("kratos dsn has no sql dump")
+	ErrCommandFailed  = errors.New("sql dump command failed")
+)
+
+const (
+	dumpPath           = "/tmp/kratos.sql"
+	writeRights  int64 = 0644
+	defaultMySQL       = "3306"
+)
+
+// kratosParams are pop connection settings Kratos accepts in a DSN that
+// libpq refuses.
+var kratosParams = []string{"max_conns", "max_idle_conns", "max_conn_lifetime", "max_conn_idle_time"}
+
+var mysqlAddr = regexp.MustCompile(`^tcp\(([^)]+)\)/([^?]+)`)
+
+type (
+	Option func(*Config)
+
+	Config struct {
+		postgresImage        string
+		mysqlImage           string
+		containerConstructor func(
+			ctx context.Context,
+			req testcontainers.GenericContainerRequest,
+		) (testcontainers.Container, error)
+	}
+
+	// Kratos is the container whose database is dumped, e.g. a
+	// *tckratos.KratosContainer.
+	Kratos interface {
+		GetContainerID() string
+		CopyFileFromContainer(ctx context.Context, filePath string) (io.ReadCloser, error)
+		CopyToContainer(ctx context.Context, fileContent []byte, containerFilePath string, fileMode int64) error
+		Stop(ctx context.Context, timeout *time.Duration) error
+		Start(ctx context.Context) error
+	}
+
+	// Dumper saves and loads only rows, leaving the schema Kratos migrated
+	// and prepared statements against it untouched. Postgres and MySQL are
+	// dumped by a client container sharing the network of Kratos, so it
+	// reaches the DSN the same way; SQLite by copying the file, restarting
+	// Kratos on Load.
+	Dumper struct {
+		kratos Kratos
+		tools  testcontainers.Container
+		sqlite string
+		dump   func(ctx context.Context) ([]byte, error)
+		load   []string
+		env    []string
+	}
+)
+
+func WithPostgresImage(image string) Option {
+	return func(c *Config) {
+		c.postgresImage = image
+	}
+}
+
+func WithMySQLImage(image string) Option {
+	return func(c *Config) {
+		c.mysqlImage = image
+	}
+}
+
+func WithContainerConstructor(
+	fn func(ctx context.Context, req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)) Option {
+	return func(c *Config) {
+		c.containerConstructor = fn
+	}
+}
+
+// New picks how to dump the database kratos uses through dsn. A memory DSN
+// returns ErrNoDatabase, schemes without dump tools, like cockroach,
+// ErrUnsupportedDSN.
+func New(ctx context.Context, dsn string, kratos Kratos, opts ...Option) (*Dumper, error) {
+	cfg := Config{
+		postgresImage:        "postgres:17-alpine",
+		mysqlImage:           "mysql:8.4",
+		containerConstructor: testcontainers.GenericContainer,
+	}
+
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+
+	scheme, rest, _ := strings.Cut(dsn, "://")
+
+	switch scheme {
+	case "", "memory":
+		return nil, ErrNoDatabase
+	case "sqlite", "sqlite3":
+		return sqlite(kratos, rest)
+	case "postgres", "postgresql":
+		res, err := postgres(dsn)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.start(ctx, cfg, cfg.postgresImage, kratos)
+	case "mysql":
+		res, err := mysql(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		return res.start(ctx, cfg, cfg.mysqlImage, kratos)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedDSN, scheme)
+	}
+}
+
+// Dump returns a script replacing every row with the current ones.
+func (d *Dumper) Dump(ctx context.Context) ([]byte, error) {
+	return d.dump(ctx)
+}
+
+// Load replaces the database content with dump.
+func (d *Dumper) Load(ctx context.Context, dump []byte) error {
+	if d.sqlite != "" {
+		return d.loadSQLite(ctx, dump)
+	}
+
+	if err := d.tools.CopyToContainer(ctx, dump, dumpPath, writeRights); err != nil {
+		return fmt.Errorf("failed to copy dump: %w", err)
+	}
+
+	if _, err := d.exec(ctx, d.load); err != nil {
+		return fmt.Errorf("failed to load dump: %w", err)
+	}
+
+	return nil
+}
+
+// Terminate removes the client container, if any.
+func (d *Dumper) Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	if d.tools == nil {
+		return nil
+	}
+
+	if err := d.tools.Terminate(ctx, opts...); err != nil {
+		return fmt.Errorf("failed to terminate sql dump container: %w", err)
+	}
+
+	return nil
+}
+
+func sqlite(kratos Kratos, rest string) (*Dumper, error) {
+	path, _, _ := strings.Cut(strings.TrimPrefix(rest, "file:"), "?")
+	if path == "" || strings.Contains(rest, ":memory:") || strings.Contains(rest, "mode=memory") {
+		return nil, ErrNoDatabase
+	}
+
+	res := &Dumper{kratos: kratos, sqlite: path}
+	res.dump = res.dumpSQLite
+
+	return res, nil
+}
+
+func (d *Dumper) dumpSQLite(ctx context.Context) ([]byte, error) {
+	file, err := d.kratos.CopyFileFromContainer(ctx, d.sqlite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy sqlite database: %w", err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return io.ReadAll(file)
+}
+
+// loadSQLite swaps the file while Kratos is stopped, a running one would
+// keep the replaced file open.
+func (d *Dumper) loadSQLite(ctx context.Context, dump []byte) error {
+	if err := d.kratos.Stop(ctx, nil); err != nil {
+		return fmt.Errorf("failed to stop kratos: %w", err)
+	}
+
+	if err := d.kratos.CopyToContainer(ctx, dump, d.sqlite, writeRights); err != nil {
+		return fmt.Errorf("failed to copy sqlite database: %w", err)
+	}
+
+	if err := d.kratos.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start kratos: %w", err)
+	}
+
+	return nil
+}
+
+func postgres(dsn string) (*Dumper, error) {
+	addr, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres dsn: %w", err)
+	}
+
+	query := addr.Query()
+	for _, param := range kratosParams {
+		query.Del(param)
+	}
+
+	addr.Scheme = "postgres"
+	addr.RawQuery = query.Encode()
+	conn := "--dbname=" + addr.String()
+
+	res := &Dumper{
+		load: []string{"psql", conn, "--quiet", "--single-transaction", "-v", "ON_ERROR_STOP=1", "--file=" + dumpPath},
+	}
+
+	res.dump = func(ctx context.Context) ([]byte, error) {
+		tables, err := res.exec(ctx, []string{"psql", conn, "--tuples-only", "--no-align", "--command=" +
+			"SELECT string_agg(format('%I.%I', schemaname, tablename), ',') " +
+			"FROM pg_tables WHERE schemaname = current_schema()"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+
+		rows, err := res.exec(ctx, []string{"pg_dump", conn, "--data-only", "--no-owner", "--no-privileges"})
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump rows: %w", err)
+		}
+
+		// replica role skips foreign key triggers while rows come back in
+		// table order
+		return script(
+			"SET session_replication_role = replica;",
+			each(tables, func(all []string) string {
+				return "TRUNCATE " + strings.Join(all, ", ") + " CASCADE;"
+			}),
+			rows,
+		), nil
+	}
+
+	return res, nil
+}
+
+// mysql reads a go-sql-driver DSN, e.g. user:secret@tcp(mysql:3306)/kratos.
+func mysql(rest string) (*Dumper, error) {
+	creds, target, ok := cutLast(rest, "@")
+	match := mysqlAddr.FindStringSubmatch(target)
+
+	if !ok || match == nil {
+		return nil, fmt.Errorf("%w: mysql dsn must name tcp(host:port)/database", ErrUnsupportedDSN)
+	}
+
+	host, port, err := net.SplitHostPort(match[1])
+	if err != nil {
+		host, port = match[1], defaultMySQL
+	}
+
+	user, password, _ := strings.Cut(creds, ":")
+	conn := []string{"--host=" + host, "--port=" + port, "--user=" + user, "--protocol=tcp"}
+	db := match[2]
+
+	res := &Dumper{
+		load: append(append([]string{"mysql"}, conn...), "--execute=SOURCE "+dumpPath, db),
+		env:  []string{"MYSQL_PWD=" + password},
+	}
+
+	res.dump = func(ctx context.Context) ([]byte, error) {
+		tables, err := res.exec(ctx, append(append([]string{"mysql"}, conn...), "--skip-column-names",
+			"--execute=SELECT GROUP_CONCAT(CONCAT('`', table_name, '`')) FROM information_schema.tables "+
+				"WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'", db))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+
+		rows, err := res.exec(ctx, append(append([]string{"mysqldump"}, conn...),
+			"--no-create-info", "--skip-triggers", "--complete-insert", "--no-tablespaces", db))
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump rows: %w", err)
+		}
+
+		return script(
+			"SET FOREIGN_KEY_CHECKS = 0;",
+			each(tables, func(all []string) string {
+				return "DELETE FROM " + strings.Join(all, ";\nDELETE FROM ") + ";"
+			}),
+			rows,
+			"SET FOREIGN_KEY_CHECKS = 1;",
+		), nil
+	}
+
+	return res, nil
+}
+
+// start runs the client image idle in the network namespace of kratos.
+func (d *Dumper) start(ctx context.Context, cfg Config, image string, kratos Kratos) (*Dumper, error) {
+	tools, err := cfg.containerConstructor(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:      image,
+			Entrypoint: []string{"sleep", "infinity"},
+			HostConfigModifier: func(hc *container.HostConfig) {
+				hc.NetworkMode = container.NetworkMode("container:" + kratos.GetContainerID())
+			},
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sql dump container: %w", err)
+	}
+
+	d.kratos = kratos
+	d.tools = tools
+
+	return d, nil
+}
+
+func (d *Dumper) exec(ctx context.Context, cmd []string) ([]byte, error) {
+	code, out, err := d.tools.Exec(ctx, cmd, tcexec.WithEnv(d.env))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", cmd[0], err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, out); err != nil {
+		return nil, fmt.Errorf("failed to read %s output: %w", cmd[0], err)
+	}
+
+	if code != 0 {
+		return nil, fmt.Errorf("%w: %s exited with %d: %s", ErrCommandFailed, cmd[0], code, stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// each turns the comma separated tables a query listed into statement,
+// nothing for an empty database.
+func each(tables []byte, statement func(all []string) string) string {
+	list := strings.TrimSpace(string(tables))
+	if list == "" || list == "NULL" {
+		return ""
+	}
+
+	return statement(strings.Split(list, ","))
+}
+
+func script(parts ...any) []byte {
+	var res bytes.Buffer
+
+	for _, part := range parts {
+		_, _ = fmt.Fprintf(&res, "%s\n", part)
+	}
+
+	return res.Bytes()
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return "", s, false
+	}
+
+	return s[:i], s[i+len(sep):], true
+}
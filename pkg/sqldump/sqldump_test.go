@@ -0,0 +1,212 @@
+package sqldump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+)
+
+// fakeKratos keeps one file and records restarts.
+type fakeKratos struct {
+	files map[string][]byte
+	calls []string
+}
+
+func (f *fakeKratos) GetContainerID() string {
+	return "kratos-id"
+}
+
+func (f *fakeKratos) CopyFileFromContainer(_ context.Context, path string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.files[path])), nil
+}
+
+func (f *fakeKratos) CopyToContainer(_ context.Context, content []byte, path string, _ int64) error {
+	f.calls = append(f.calls, "copy")
+	f.files[path] = content
+
+	return nil
+}
+
+func (f *fakeKratos) Stop(context.Context, *time.Duration) error {
+	f.calls = append(f.calls, "stop")
+
+	return nil
+}
+
+func (f *fakeKratos) Start(context.Context) error {
+	f.calls = append(f.calls, "start")
+
+	return nil
+}
+
+// fakeTools answers commands by their program with docker framed stdout.
+type fakeTools struct {
+	testcontainers.Container
+
+	out    map[string]string
+	code   int
+	ran    [][]string
+	env    []string
+	copied map[string][]byte
+}
+
+func (f *fakeTools) Exec(_ context.Context, cmd []string, opts ...tcexec.ProcessOption) (int, io.Reader, error) {
+	f.ran = append(f.ran, cmd)
+
+	po := tcexec.NewProcessOptions(cmd)
+	for _, opt := range opts {
+		opt.Apply(po)
+	}
+
+	f.env = po.ExecConfig.Env
+
+	var buf bytes.Buffer
+	_, _ = stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(f.out[cmd[0]]))
+	_, _ = stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte("boom"))
+
+	return f.code, &buf, nil
+}
+
+func (f *fakeTools) CopyToContainer(_ context.Context, content []byte, path string, _ int64) error {
+	f.copied[path] = content
+
+	return nil
+}
+
+func (f *fakeTools) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return nil
+}
+
+func newDumper(t *testing.T, dsn string, tools *fakeTools) (*Dumper, testcontainers.GenericContainerRequest) {
+	t.Helper()
+
+	var req testcontainers.GenericContainerRequest
+
+	dumper, err := New(t.Context(), dsn, &fakeKratos{}, WithContainerConstructor(
+		func(_ context.Context, got testcontainers.GenericContainerRequest) (testcontainers.Container, error) {
+			req = got
+
+			return tools, nil
+		}))
+	require.NoError(t, err)
+
+	return dumper, req
+}
+
+func TestDumper(t *testing.T) {
+	t.Run("should be able to dump postgres rows next to kratos", func(t *testing.T) {
+		tools := &fakeTools{
+			out:    map[string]string{"psql": "public.identities,public.sessions\n", "pg_dump": "COPY rows;\n"},
+			copied: map[string][]byte{},
+		}
+
+		dumper, req := newDumper(t, "postgres://kratos:secret@db:5432/kratos?sslmode=disable&max_conns=20", tools)
+		assert.Equal(t, "postgres:17-alpine", req.Image)
+
+		hc := &container.HostConfig{}
+		req.HostConfigModifier(hc)
+		assert.Equal(t, container.NetworkMode("container:kratos-id"), hc.NetworkMode)
+
+		dump, err := dumper.Dump(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "SET session_replication_role = replica;\n"+
+			"TRUNCATE public.identities, public.sessions CASCADE;\n"+
+			"COPY rows;\n\n", string(dump))
+		assert.Equal(t, "--dbname=postgres://kratos:secret@db:5432/kratos?sslmode=disable", tools.ran[1][1])
+
+		require.NoError(t, dumper.Load(t.Context(), dump))
+		assert.Equal(t, dump, tools.copied[dumpPath])
+		assert.Equal(t, "psql", tools.ran[2][0])
+		assert.Contains(t, tools.ran[2], "--single-transaction")
+		require.NoError(t, dumper.Terminate(t.Context()))
+	})
+
+	t.Run("should be able to dump mysql rows", func(t *testing.T) {
+		tools := &fakeTools{
+			out:    map[string]string{"mysql": "`identities`,`sessions`\n", "mysqldump": "INSERT rows;\n"},
+			copied: map[string][]byte{},
+		}
+
+		dumper, req := newDumper(t, "mysql://kratos:p@ss@tcp(db:3307)/kratos?parseTime=true", tools)
+		assert.Equal(t, "mysql:8.4", req.Image)
+
+		dump, err := dumper.Dump(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "SET FOREIGN_KEY_CHECKS = 0;\n"+
+			"DELETE FROM `identities`;\nDELETE FROM `sessions`;\n"+
+			"INSERT rows;\n\nSET FOREIGN_KEY_CHECKS = 1;\n", string(dump))
+		assert.Equal(t, []string{"MYSQL_PWD=p@ss"}, tools.env)
+		assert.Contains(t, tools.ran[1], "--host=db")
+		assert.Contains(t, tools.ran[1], "--port=3307")
+		assert.Equal(t, "kratos", tools.ran[1][len(tools.ran[1])-1])
+
+		require.NoError(t, dumper.Load(t.Context(), dump))
+		assert.Contains(t, tools.ran[2], "--execute=SOURCE "+dumpPath)
+	})
+
+	t.Run("should be able to swap sqlite file while kratos is stopped", func(t *testing.T) {
+		kratos := &fakeKratos{files: map[string][]byte{"/var/lib/sqlite/db.sqlite": []byte("captured")}}
+
+		dumper, err := New(t.Context(), "sqlite:///var/lib/sqlite/db.sqlite?_fk=true", kratos)
+		require.NoError(t, err)
+
+		dump, err := dumper.Dump(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "captured", string(dump))
+
+		kratos.files["/var/lib/sqlite/db.sqlite"] = []byte("changed")
+
+		require.NoError(t, dumper.Load(t.Context(), dump))
+		assert.Equal(t, []string{"stop", "copy", "start"}, kratos.calls)
+		assert.Equal(t, "captured", string(kratos.files["/var/lib/sqlite/db.sqlite"]))
+		require.NoError(t, dumper.Terminate(t.Context()))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when dsn names no database", func(t *testing.T) {
+			for _, dsn := range []string{"", "memory", "sqlite://file::memory:?cache=shared"} {
+				_, err := New(t.Context(), dsn, &fakeKratos{})
+				require.ErrorIs(t, err, ErrNoDatabase, dsn)
+			}
+		})
+
+		t.Run("when dsn has no dump tools", func(t *testing.T) {
+			for _, dsn := range []string{"cockroach://root@db:26257/kratos", "mysql://kratos@db/kratos"} {
+				_, err := New(t.Context(), dsn, &fakeKratos{})
+				require.ErrorIs(t, err, ErrUnsupportedDSN, dsn)
+			}
+		})
+
+		t.Run("when client container cant start", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+
+			_, err := New(t.Context(), "postgres://db/kratos", &fakeKratos{}, WithPostgresImage("postgres:16"),
+				WithContainerConstructor(func(
+					context.Context, testcontainers.GenericContainerRequest,
+				) (testcontainers.Container, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when command fails", func(t *testing.T) {
+			dumper, _ := newDumper(t, "postgres://db/kratos", &fakeTools{code: 1})
+
+			_, err := dumper.Dump(t.Context())
+			require.ErrorIs(t, err, ErrCommandFailed)
+			assert.True(t, strings.HasSuffix(err.Error(), "boom"))
+		})
+	})
+}
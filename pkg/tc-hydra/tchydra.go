@@ -0,0 +1,260 @@
+package tchydra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var ErrLoginURLNotFound = errors.New("hydra login and consent urls not found")
+
+const (
+	// DefaultAlias is the network alias of Hydra when WithNetwork is given none.
+	DefaultAlias = "hydra"
+
+	publicPort = 4444
+	adminPort  = 4445
+
+	systemSecret = "grokratos-hydra-system-secret-32"
+)
+
+type Option func(*HydraConfig)
+
+type HydraContainer struct {
+	HydraContainer testcontainers.Container
+	PublicURL      string
+	AdminURL       string
+
+	// InternalPublicURL and InternalAdminURL are how containers on the network
+	// joined with WithNetwork reach Hydra; empty without a network.
+	InternalPublicURL string
+	InternalAdminURL  string
+}
+
+func (hc *HydraContainer) PublicConnectionString(ctx context.Context) string {
+	return hc.PublicURL
+}
+
+func (hc *HydraContainer) AdminConnectionString(ctx context.Context) string {
+	return hc.AdminURL
+}
+
+func (hc *HydraContainer) InternalAdminConnectionString(ctx context.Context) string {
+	return hc.InternalAdminURL
+}
+
+func (hc *HydraContainer) Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	err := hc.HydraContainer.Terminate(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to terminate hydra container: %w", err)
+	}
+
+	return nil
+}
+
+type HydraConfig struct {
+	image           string
+	loginURL        string
+	consentURL      string
+	network         string
+	aliases         []string
+	hostAccessPorts []int
+	env             map[string]string
+	publicPort      int
+	adminPort       int
+
+	containerConstructor func(
+		ctx context.Context,
+		req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)
+	publicListenerConstructor func(network string, address string) (net.Listener, error)
+	adminListenerConstructor  func(network string, address string) (net.Listener, error)
+}
+
+func WithImage(image string) Option {
+	return func(c *HydraConfig) {
+		c.image = image
+	}
+}
+
+// WithLoginConsentURLs sets where Hydra sends browsers to sign in and consent, as
+// seen from the browser.
+func WithLoginConsentURLs(login, consent string) Option {
+	return func(c *HydraConfig) {
+		c.loginURL = login
+		c.consentURL = consent
+	}
+}
+
+// WithNetwork attaches Hydra to an existing docker network, reachable from
+// other containers on it by aliases, DefaultAlias when none are given.
+func WithNetwork(name string, aliases ...string) Option {
+	return func(c *HydraConfig) {
+		c.network = name
+		c.aliases = aliases
+	}
+}
+
+func WithHostAccessPorts(ports ...int) Option {
+	return func(c *HydraConfig) {
+		c.hostAccessPorts = append(c.hostAccessPorts, ports...)
+	}
+}
+
+// WithEnv sets an environment variable, e.g. TTL_ACCESS_TOKEN or STRATEGIES_ACCESS_TOKEN.
+func WithEnv(key, value string) Option {
+	return func(c *HydraConfig) {
+		if c.env == nil {
+			c.env = map[string]string{}
+		}
+
+		c.env[key] = value
+	}
+}
+
+func WithContainerConstructor(
+	fn func(ctx context.Context, req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)) Option {
+	return func(c *HydraConfig) {
+		c.containerConstructor = fn
+	}
+}
+
+func WithPublicListenerConstructor(fn func(network string, address string) (net.Listener, error)) Option {
+	return func(c *HydraConfig) {
+		c.publicListenerConstructor = fn
+	}
+}
+
+func WithAdminListenerConstructor(fn func(network string, address string) (net.Listener, error)) Option {
+	return func(c *HydraConfig) {
+		c.adminListenerConstructor = fn
+	}
+}
+
+func Run(ctx context.Context, opts ...Option) (*HydraContainer, error) {
+	cfg := HydraConfig{
+		image:                     "oryd/hydra:v2.2.0",
+		containerConstructor:      testcontainers.GenericContainer,
+		publicListenerConstructor: net.Listen,
+		adminListenerConstructor:  net.Listen,
+	}
+
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+
+	if cfg.loginURL == "" || cfg.consentURL == "" {
+		return nil, ErrLoginURLNotFound
+	}
+
+	publicLn, err := cfg.publicListenerConstructor("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on public port: %w", err)
+	}
+
+	cfg.publicPort = publicLn.Addr().(*net.TCPAddr).Port
+	_ = publicLn.Close()
+
+	adminLn, err := cfg.adminListenerConstructor("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on admin port: %w", err)
+	}
+
+	cfg.adminPort = adminLn.Addr().(*net.TCPAddr).Port
+	_ = adminLn.Close()
+
+	hydra, err := cfg.containerConstructor(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: containerRequest(cfg),
+		Started:          true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start hydra: %w", err)
+	}
+
+	res := &HydraContainer{
+		HydraContainer: hydra,
+		PublicURL:      net.JoinHostPort("localhost", strconv.Itoa(cfg.publicPort)),
+		AdminURL:       net.JoinHostPort("localhost", strconv.Itoa(cfg.adminPort)),
+	}
+
+	if cfg.network != "" {
+		res.InternalPublicURL = net.JoinHostPort(cfg.alias(), strconv.Itoa(publicPort))
+		res.InternalAdminURL = net.JoinHostPort(cfg.alias(), strconv.Itoa(adminPort))
+	}
+
+	return res, nil
+}
+
+func exposed(port int) string {
+	return strconv.Itoa(port) + "/tcp"
+}
+
+func (cfg HydraConfig) alias() string {
+	if len(cfg.aliases) == 0 {
+		return DefaultAlias
+	}
+
+	return cfg.aliases[0]
+}
+
+func containerRequest(cfg HydraConfig) testcontainers.ContainerRequest {
+	// the issuer is what browsers and token clients on the test host see
+	env := map[string]string{
+		"DSN":                          "memory",
+		"LOG_LEVEL":                    "debug",
+		"SECRETS_SYSTEM":               systemSecret,
+		"URLS_SELF_ISSUER":             "http://localhost:" + strconv.Itoa(cfg.publicPort) + "/",
+		"URLS_LOGIN":                   cfg.loginURL,
+		"URLS_CONSENT":                 cfg.consentURL,
+		"SERVE_COOKIES_SAME_SITE_MODE": "Lax",
+	}
+
+	maps.Copy(env, cfg.env)
+
+	var (
+		networks []string
+		aliases  map[string][]string
+	)
+
+	if cfg.network != "" {
+		networks = []string{cfg.network}
+		aliases = map[string][]string{cfg.network: {cfg.alias()}}
+
+		if len(cfg.aliases) > 0 {
+			aliases[cfg.network] = cfg.aliases
+		}
+	}
+
+	return testcontainers.ContainerRequest{
+		Image:           cfg.image,
+		ExposedPorts:    []string{exposed(publicPort), exposed(adminPort)},
+		HostAccessPorts: cfg.hostAccessPorts,
+		Networks:        networks,
+		NetworkAliases:  aliases,
+		Cmd:             []string{"serve", "all", "--dev"},
+		Env:             env,
+		HostConfigModifier: func(hc *container.HostConfig) {
+			hc.PortBindings = nat.PortMap{
+				nat.Port(exposed(publicPort)): []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(cfg.publicPort)}},
+				nat.Port(exposed(adminPort)):  []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(cfg.adminPort)}},
+			}
+		},
+		WaitingFor: wait.ForHTTP("/health/ready").
+			WithPort(nat.Port(exposed(adminPort))).
+			WithStartupTimeout(time.Minute).
+			WithStatusCodeMatcher(func(status int) bool {
+				return status == http.StatusOK
+			}),
+	}
+}
@@ -0,0 +1,111 @@
+package tchydra
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+type fakeContainer struct {
+	testcontainers.Container
+
+	err error
+}
+
+func (f fakeContainer) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return f.err
+}
+
+func TestRun(t *testing.T) {
+	urls := WithLoginConsentURLs("http://127.0.0.1:1/login", "http://127.0.0.1:1/consent")
+
+	t.Run("should be able to run", func(t *testing.T) {
+		var req testcontainers.GenericContainerRequest
+
+		hc, err := Run(t.Context(), urls, WithNetwork("sut"), WithContainerConstructor(func(
+			_ context.Context, got testcontainers.GenericContainerRequest,
+		) (testcontainers.Container, error) {
+			req = got
+
+			return fakeContainer{}, nil
+		}))
+		require.NoError(t, err)
+
+		assert.Equal(t, "oryd/hydra:v2.2.0", req.Image)
+		assert.Equal(t, "http://"+hc.PublicConnectionString(t.Context())+"/", req.Env["URLS_SELF_ISSUER"])
+		assert.NotEqual(t, hc.PublicConnectionString(t.Context()), hc.AdminConnectionString(t.Context()))
+		assert.Equal(t, "hydra:4445", hc.InternalAdminConnectionString(t.Context()))
+		require.NoError(t, hc.Terminate(t.Context()))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when login urls are not specified", func(t *testing.T) {
+			_, err := Run(t.Context())
+			require.ErrorIs(t, err, ErrLoginURLNotFound)
+		})
+
+		t.Run("when cant allocate public port", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), urls, WithPublicListenerConstructor(func(string, string) (net.Listener, error) {
+				return nil, expErr
+			}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when cant allocate admin port", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), urls, WithAdminListenerConstructor(func(string, string) (net.Listener, error) {
+				return nil, expErr
+			}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when run container will be failed", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), urls, WithContainerConstructor(func(
+				context.Context, testcontainers.GenericContainerRequest,
+			) (testcontainers.Container, error) {
+				return nil, expErr
+			}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when terminate will be failed", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			hc := &HydraContainer{HydraContainer: fakeContainer{err: expErr}}
+			require.ErrorIs(t, hc.Terminate(t.Context()), expErr)
+		})
+	})
+}
+
+func TestContainerRequest(t *testing.T) {
+	t.Run("should be able to configure login and consent", func(t *testing.T) {
+		cfg := HydraConfig{publicPort: 5000}
+		WithLoginConsentURLs("http://app/login", "http://app/consent")(&cfg)
+		WithEnv("TTL_ACCESS_TOKEN", "1m")(&cfg)
+		WithHostAccessPorts(8080)(&cfg)
+
+		req := containerRequest(cfg)
+		assert.Equal(t, "http://app/login", req.Env["URLS_LOGIN"])
+		assert.Equal(t, "http://app/consent", req.Env["URLS_CONSENT"])
+		assert.Equal(t, "http://localhost:5000/", req.Env["URLS_SELF_ISSUER"])
+		assert.Equal(t, "1m", req.Env["TTL_ACCESS_TOKEN"])
+		assert.Equal(t, []int{8080}, req.HostAccessPorts)
+		assert.Empty(t, req.Networks)
+	})
+
+	t.Run("should be able to join network with aliases", func(t *testing.T) {
+		var cfg HydraConfig
+		WithNetwork("sut", "oauth2")(&cfg)
+
+		req := containerRequest(cfg)
+		assert.Equal(t, []string{"sut"}, req.Networks)
+		assert.Equal(t, map[string][]string{"sut": {"oauth2"}}, req.NetworkAliases)
+	})
+}
@@ -0,0 +1,278 @@
+package tcketo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNamespacesNotFound = errors.New("keto namespaces not found")
+
+const readOnlyRights int64 = 0644
+
+// ConfigDir is where keto.yml and the namespace config live in the container.
+const ConfigDir = "/etc/config/keto"
+
+const (
+	// DefaultAlias is the network alias of Keto when WithNetwork is given none.
+	DefaultAlias = "keto"
+
+	readPort  = 4466
+	writePort = 4467
+)
+
+type Option func(*KetoConfig)
+
+type KetoContainer struct {
+	KetoContainer testcontainers.Container
+	ReadURL       string
+	WriteURL      string
+}
+
+func (kc *KetoContainer) ReadConnectionString(ctx context.Context) string {
+	return kc.ReadURL
+}
+
+func (kc *KetoContainer) WriteConnectionString(ctx context.Context) string {
+	return kc.WriteURL
+}
+
+func (kc *KetoContainer) Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	err := kc.KetoContainer.Terminate(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to terminate keto container: %w", err)
+	}
+
+	return nil
+}
+
+type KetoConfig struct {
+	image                string
+	namespaces           []string
+	oplPath              string
+	network              string
+	aliases              []string
+	readPort             int
+	writePort            int
+	containerConstructor func(
+		ctx context.Context,
+		req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)
+	readListenerConstructor  func(network string, address string) (net.Listener, error)
+	writeListenerConstructor func(network string, address string) (net.Listener, error)
+}
+
+func WithImage(image string) Option {
+	return func(c *KetoConfig) {
+		c.image = image
+	}
+}
+
+// WithNamespaces declares namespaces by name, for tuples without rewrites.
+func WithNamespaces(names ...string) Option {
+	return func(c *KetoConfig) {
+		c.namespaces = append(c.namespaces, names...)
+	}
+}
+
+// WithOPL declares namespaces with an Ory Permission Language file, e.g.
+// namespaces.keto.ts; it takes precedence over WithNamespaces.
+func WithOPL(path string) Option {
+	return func(c *KetoConfig) {
+		c.oplPath = path
+	}
+}
+
+// WithNetwork attaches Keto to an existing docker network, reachable from
+// other containers on it by aliases, DefaultAlias when none are given.
+func WithNetwork(name string, aliases ...string) Option {
+	return func(c *KetoConfig) {
+		c.network = name
+		c.aliases = aliases
+	}
+}
+
+func WithContainerConstructor(
+	fn func(ctx context.Context, req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)) Option {
+	return func(c *KetoConfig) {
+		c.containerConstructor = fn
+	}
+}
+
+func WithReadListenerConstructor(fn func(network string, address string) (net.Listener, error)) Option {
+	return func(c *KetoConfig) {
+		c.readListenerConstructor = fn
+	}
+}
+
+func WithWriteListenerConstructor(fn func(network string, address string) (net.Listener, error)) Option {
+	return func(c *KetoConfig) {
+		c.writeListenerConstructor = fn
+	}
+}
+
+func Run(ctx context.Context, opts ...Option) (*KetoContainer, error) {
+	cfg := KetoConfig{
+		image:                    "oryd/keto:v0.14.0",
+		containerConstructor:     testcontainers.GenericContainer,
+		readListenerConstructor:  net.Listen,
+		writeListenerConstructor: net.Listen,
+	}
+
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+
+	if len(cfg.namespaces) == 0 && cfg.oplPath == "" {
+		return nil, ErrNamespacesNotFound
+	}
+
+	readLn, err := cfg.readListenerConstructor("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on read port: %w", err)
+	}
+
+	cfg.readPort = readLn.Addr().(*net.TCPAddr).Port
+	_ = readLn.Close()
+
+	writeLn, err := cfg.writeListenerConstructor("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on write port: %w", err)
+	}
+
+	cfg.writePort = writeLn.Addr().(*net.TCPAddr).Port
+	_ = writeLn.Close()
+
+	req, err := containerRequest(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	keto, err := cfg.containerConstructor(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start keto: %w", err)
+	}
+
+	return &KetoContainer{
+		KetoContainer: keto,
+		ReadURL:       net.JoinHostPort("localhost", strconv.Itoa(cfg.readPort)),
+		WriteURL:      net.JoinHostPort("localhost", strconv.Itoa(cfg.writePort)),
+	}, nil
+}
+
+// Config renders keto.yml with an in-memory store and the given namespaces.
+func Config(namespaces []string, oplPath string) ([]byte, error) {
+	var ns any
+
+	if oplPath != "" {
+		ns = map[string]any{"location": "file://" + ConfigDir + "/" + filepath.Base(oplPath)}
+	} else {
+		list := make([]map[string]any, 0, len(namespaces))
+		for i, name := range namespaces {
+			list = append(list, map[string]any{"id": i, "name": name})
+		}
+
+		ns = list
+	}
+
+	doc := map[string]any{
+		"dsn": "memory",
+		"serve": map[string]any{
+			"read":  map[string]any{"host": "0.0.0.0", "port": readPort},
+			"write": map[string]any{"host": "0.0.0.0", "port": writePort},
+		},
+		"namespaces": ns,
+		"log":        map[string]any{"level": "debug"},
+	}
+
+	raw, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal keto config: %w", err)
+	}
+
+	return raw, nil
+}
+
+func exposed(port int) string {
+	return strconv.Itoa(port) + "/tcp"
+}
+
+func (cfg KetoConfig) alias() string {
+	if len(cfg.aliases) == 0 {
+		return DefaultAlias
+	}
+
+	return cfg.aliases[0]
+}
+
+func containerRequest(cfg KetoConfig) (testcontainers.ContainerRequest, error) {
+	conf, err := Config(cfg.namespaces, cfg.oplPath)
+	if err != nil {
+		return testcontainers.ContainerRequest{}, err
+	}
+
+	files := []testcontainers.ContainerFile{{
+		Reader:            bytes.NewReader(conf),
+		ContainerFilePath: ConfigDir + "/keto.yml",
+		FileMode:          readOnlyRights,
+	}}
+
+	if cfg.oplPath != "" {
+		files = append(files, testcontainers.ContainerFile{
+			HostFilePath:      cfg.oplPath,
+			ContainerFilePath: ConfigDir + "/" + filepath.Base(cfg.oplPath),
+			FileMode:          readOnlyRights,
+		})
+	}
+
+	var (
+		networks []string
+		aliases  map[string][]string
+	)
+
+	if cfg.network != "" {
+		networks = []string{cfg.network}
+		aliases = map[string][]string{cfg.network: {cfg.alias()}}
+
+		if len(cfg.aliases) > 0 {
+			aliases[cfg.network] = cfg.aliases
+		}
+	}
+
+	return testcontainers.ContainerRequest{
+		Image:          cfg.image,
+		ExposedPorts:   []string{exposed(readPort), exposed(writePort)},
+		Networks:       networks,
+		NetworkAliases: aliases,
+		Cmd:            []string{"serve", "-c", ConfigDir + "/keto.yml"},
+		Files:          files,
+		HostConfigModifier: func(hc *container.HostConfig) {
+			hc.PortBindings = nat.PortMap{
+				nat.Port(exposed(readPort)):  []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(cfg.readPort)}},
+				nat.Port(exposed(writePort)): []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(cfg.writePort)}},
+			}
+		},
+		WaitingFor: wait.ForHTTP("/health/ready").
+			WithPort(nat.Port(exposed(readPort))).
+			WithStartupTimeout(time.Minute).
+			WithStatusCodeMatcher(func(status int) bool {
+				return status == http.StatusOK
+			}),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package tcketo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"gopkg.in/yaml.v3"
+)
+
+type fakeContainer struct {
+	testcontainers.Container
+
+	err error
+}
+
+func (f fakeContainer) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return f.err
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should be able to run", func(t *testing.T) {
+		var req testcontainers.GenericContainerRequest
+
+		kc, err := Run(t.Context(), WithNamespaces("documents"), WithImage("oryd/keto:latest"),
+			WithContainerConstructor(func(
+				_ context.Context, got testcontainers.GenericContainerRequest,
+			) (testcontainers.Container, error) {
+				req = got
+
+				return fakeContainer{}, nil
+			}))
+		require.NoError(t, err)
+
+		assert.Equal(t, "oryd/keto:latest", req.Image)
+		assert.NotEmpty(t, kc.ReadConnectionString(t.Context()))
+		assert.NotEqual(t, kc.ReadConnectionString(t.Context()), kc.WriteConnectionString(t.Context()))
+		require.NoError(t, kc.Terminate(t.Context()))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when namespaces are not specified", func(t *testing.T) {
+			_, err := Run(t.Context())
+			require.ErrorIs(t, err, ErrNamespacesNotFound)
+		})
+
+		t.Run("when cant allocate read port", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), WithNamespaces("documents"),
+				WithReadListenerConstructor(func(string, string) (net.Listener, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when cant allocate write port", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), WithNamespaces("documents"),
+				WithWriteListenerConstructor(func(string, string) (net.Listener, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when run container will be failed", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), WithNamespaces("documents"),
+				WithContainerConstructor(func(
+					context.Context, testcontainers.GenericContainerRequest,
+				) (testcontainers.Container, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when terminate will be failed", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			kc := &KetoContainer{KetoContainer: fakeContainer{err: expErr}}
+			require.ErrorIs(t, kc.Terminate(t.Context()), expErr)
+		})
+	})
+}
+
+func TestContainerRequest(t *testing.T) {
+	decode := func(t *testing.T, file testcontainers.ContainerFile) map[string]any {
+		t.Helper()
+
+		raw, err := io.ReadAll(file.Reader)
+		require.NoError(t, err)
+
+		var doc map[string]any
+		require.NoError(t, yaml.Unmarshal(raw, &doc))
+
+		return doc
+	}
+
+	t.Run("should be able to declare namespaces by name", func(t *testing.T) {
+		var cfg KetoConfig
+		WithNamespaces("documents", "groups")(&cfg)
+
+		req, err := containerRequest(cfg)
+		require.NoError(t, err)
+		require.Len(t, req.Files, 1)
+		assert.Empty(t, req.Networks)
+
+		doc := decode(t, req.Files[0])
+		assert.Equal(t, []any{
+			map[string]any{"id": 0, "name": "documents"},
+			map[string]any{"id": 1, "name": "groups"},
+		}, doc["namespaces"])
+	})
+
+	t.Run("should be able to mount opl", func(t *testing.T) {
+		var cfg KetoConfig
+		WithOPL("testdata/namespaces.keto.ts")(&cfg)
+		WithNetwork("sut", "permissions")(&cfg)
+
+		req, err := containerRequest(cfg)
+		require.NoError(t, err)
+		require.Len(t, req.Files, 2)
+		assert.Equal(t, ConfigDir+"/namespaces.keto.ts", req.Files[1].ContainerFilePath)
+		assert.Equal(t, map[string][]string{"sut": {"permissions"}}, req.NetworkAliases)
+
+		doc := decode(t, req.Files[0])
+		assert.Equal(t, map[string]any{"location": "file://" + ConfigDir + "/namespaces.keto.ts"}, doc["namespaces"])
+	})
+
+	t.Run("should be able to use default alias", func(t *testing.T) {
+		var cfg KetoConfig
+		WithNamespaces("documents")(&cfg)
+		WithNetwork("sut")(&cfg)
+
+		req, err := containerRequest(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"sut": {DefaultAlias}}, req.NetworkAliases)
+	})
+}
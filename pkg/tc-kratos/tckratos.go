@@ -2,18 +2,28 @@
 package tckratos
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/godepo/grokratos/pkg/kratosversion"
+	"github.com/godepo/grokratos/pkg/sqldump"
 )
 
 var (
@@ -23,6 +33,17 @@ var (
 
 const readOnlyRights int64 = 0644
 
+// ConfigDir is where kratos.yaml and the files next to it live in the container.
+const ConfigDir = "/etc/config/kratos"
+
+const (
+	// DefaultAlias is the network alias of Kratos when WithNetwork is given none.
+	DefaultAlias = "kratos"
+
+	publicPort = "4433"
+	adminPort  = "4434"
+)
+
 type Option func(*KratosConfig)
 
 type KratosContainer struct {
@@ -30,6 +51,17 @@ type KratosContainer struct {
 	PublicURL       string
 	AdminURL        string
 	DSN             string
+
+	// InternalPublicURL and InternalAdminURL are how containers on the network
+	// joined with WithNetwork reach Kratos; empty without a network.
+	InternalPublicURL string
+	InternalAdminURL  string
+
+	// Version is what Kratos reports on /version once it is ready, zero when
+	// it could not be asked.
+	Version kratosversion.Version
+
+	logs func(ctx context.Context, since time.Time) (io.ReadCloser, error)
 }
 
 func (kc *KratosContainer) PublicConnectionString(ctx context.Context) string {
@@ -40,6 +72,23 @@ func (kc *KratosContainer) AdminConnectionString(ctx context.Context) string {
 	return kc.AdminURL
 }
 
+func (kc *KratosContainer) InternalPublicConnectionString(ctx context.Context) string {
+	return kc.InternalPublicURL
+}
+
+func (kc *KratosContainer) InternalAdminConnectionString(ctx context.Context) string {
+	return kc.InternalAdminURL
+}
+
+func (kc *KratosContainer) KratosVersion(ctx context.Context) kratosversion.Version {
+	return kc.Version
+}
+
+// Dumper saves and loads the database Kratos runs on, see sqldump.New.
+func (kc *KratosContainer) Dumper(ctx context.Context, opts ...sqldump.Option) (*sqldump.Dumper, error) {
+	return sqldump.New(ctx, kc.DSN, kc.KratosContainer, opts...)
+}
+
 func (kc *KratosContainer) Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error {
 	err := kc.KratosContainer.Terminate(ctx, opts...)
 	if err != nil {
@@ -49,6 +98,134 @@ func (kc *KratosContainer) Terminate(ctx context.Context, opts ...testcontainers
 	return nil
 }
 
+// Markers Kratos logs after it noticed a change of kratos.yaml. Only the
+// applied one is logged at info level, the others at error level.
+const (
+	ConfigAppliedMarker   = "Configuration change processed successfully"
+	ConfigRejectedMarker  = "The changed configuration is invalid"
+	ConfigImmutableMarker = "A configuration value marked as immutable has changed"
+	ConfigErrorMarker     = "An error occurred while watching config file"
+)
+
+// quietLogLevels drop the info line Kratos logs after applying a config change.
+var quietLogLevels = []string{"warn", "warning", "error", "fatal", "panic"}
+
+// LogsReloads reports whether Kratos at LOG_LEVEL level logs applied config
+// changes, which ConfigReloads relies on. An empty level is the trace default.
+func LogsReloads(level string) bool {
+	return !slices.Contains(quietLogLevels, strings.ToLower(level))
+}
+
+var configRefusedMarkers = [][]byte{
+	[]byte(ConfigRejectedMarker), []byte(ConfigImmutableMarker), []byte(ConfigErrorMarker),
+}
+
+// ConfigReloads are config changes Kratos logged after some point in time.
+type ConfigReloads struct {
+	Applied int
+	// Rejected counts changes Kratos refused and rolled back, invalid ones as
+	// well as ones touching immutable keys.
+	Rejected int
+	// Until is the time of the last log line read, to pass as since next.
+	Until time.Time
+}
+
+// WriteConfig replaces kratos.yaml inside the running container. Kratos
+// watches the file and applies most changes without a restart.
+func (kc *KratosContainer) WriteConfig(ctx context.Context, raw []byte) error {
+	err := kc.KratosContainer.CopyToContainer(ctx, raw, ConfigDir+"/kratos.yaml", readOnlyRights)
+	if err != nil {
+		return fmt.Errorf("failed to copy kratos config: %w", err)
+	}
+
+	return nil
+}
+
+// ConfigReloads counts config changes Kratos logged after since, reading only
+// the log from there on. A zero since reads the whole log.
+func (kc *KratosContainer) ConfigReloads(ctx context.Context, since time.Time) (ConfigReloads, error) {
+	res := ConfigReloads{Until: since}
+
+	logs, err := kc.readLogs(ctx, since)
+	if err != nil {
+		return res, fmt.Errorf("failed to read kratos logs: %w", err)
+	}
+
+	defer func() {
+		_ = logs.Close()
+	}()
+
+	raw, err := io.ReadAll(logs)
+	if err != nil {
+		return res, fmt.Errorf("failed to read kratos logs: %w", err)
+	}
+
+	for line := range bytes.Lines(raw) {
+		// docker prefixes lines with their RFC 3339 timestamp when asked to
+		stamp, msg, _ := bytes.Cut(line, []byte(" "))
+		if at, err := time.Parse(time.RFC3339Nano, string(stamp)); err == nil {
+			if !at.After(since) {
+				continue
+			}
+
+			res.Until = at
+		} else {
+			msg = line
+		}
+
+		switch {
+		case bytes.Contains(msg, []byte(ConfigAppliedMarker)):
+			res.Applied++
+		case slices.ContainsFunc(configRefusedMarkers, func(marker []byte) bool { return bytes.Contains(msg, marker) }):
+			res.Rejected++
+		}
+	}
+
+	return res, nil
+}
+
+func (kc *KratosContainer) readLogs(ctx context.Context, since time.Time) (io.ReadCloser, error) {
+	if kc.logs != nil {
+		return kc.logs(ctx, since)
+	}
+
+	return kc.KratosContainer.Logs(ctx)
+}
+
+// dockerLogs reads the timestamped log of ctr from since on.
+func dockerLogs(ctr testcontainers.Container) func(ctx context.Context, since time.Time) (io.ReadCloser, error) {
+	return func(ctx context.Context, since time.Time) (io.ReadCloser, error) {
+		cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to docker: %w", err)
+		}
+
+		opts := container.LogsOptions{ShowStdout: true, ShowStderr: true, Timestamps: true}
+		if !since.IsZero() {
+			opts.Since = since.Format(time.RFC3339Nano)
+		}
+
+		raw, err := cli.ContainerLogs(ctx, ctr.GetContainerID(), opts)
+		if err != nil {
+			_ = cli.Close()
+
+			return nil, err
+		}
+
+		out, in := io.Pipe()
+
+		go func() {
+			_, err := stdcopy.StdCopy(in, in, raw)
+
+			_ = raw.Close()
+			_ = cli.Close()
+			_ = in.CloseWithError(err)
+		}()
+
+		return out, nil
+	}
+}
+
 type KratosConfig struct {
 	userSchemaPath       string
 	kratosConfig         string
@@ -61,6 +238,16 @@ type KratosConfig struct {
 	frontPort                int
 	adminListenerConstructor func(network string, address string) (net.Listener, error)
 	frontListenerConstructor func(network string, address string) (net.Listener, error)
+	hostAccessPorts          []int
+	files                    []testcontainers.ContainerFile
+	env                      map[string]string
+	args                     []string
+	withoutDev               bool
+	network                  string
+	aliases                  []string
+	networkBaseURLs          bool
+	watchCourier             bool
+	versionQuery             func(ctx context.Context, adminURL string) (kratosversion.Version, error)
 }
 
 func WithUserSchemaPath(path string) func(*KratosConfig) {
@@ -103,6 +290,86 @@ func WithFrontListenerConstructor(
 	}
 }
 
+// WithVersionQuery replaces how Run asks the started Kratos for its version.
+func WithVersionQuery(
+	fn func(ctx context.Context, adminURL string) (kratosversion.Version, error),
+) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.versionQuery = fn
+	}
+}
+
+func WithHostAccessPorts(ports ...int) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.hostAccessPorts = append(c.hostAccessPorts, ports...)
+	}
+}
+
+// WithFile copies hostPath into the container, e.g. a Jsonnet template
+// referenced from kratos.yaml as file:///etc/config/kratos/<name>.
+func WithFile(hostPath, containerPath string) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.files = append(c.files, testcontainers.ContainerFile{
+			HostFilePath:      hostPath,
+			ContainerFilePath: containerPath,
+			FileMode:          readOnlyRights,
+		})
+	}
+}
+
+// WithWatchCourier makes Kratos dispatch queued courier messages itself.
+func WithWatchCourier() func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.watchCourier = true
+	}
+}
+
+// WithEnv sets an environment variable, overriding defaults like LOG_LEVEL or DSN.
+func WithEnv(key, value string) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		if c.env == nil {
+			c.env = map[string]string{}
+		}
+
+		c.env[key] = value
+	}
+}
+
+// WithArgs appends flags to the serve command as given.
+func WithArgs(args ...string) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.args = append(c.args, args...)
+	}
+}
+
+// WithDevMode toggles --dev, which is on by default and "disables critical
+// security features to make development easier" per kratos serve --help. A
+// --dev passed through WithArgs turns it on regardless.
+func WithDevMode(enabled bool) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.withoutDev = !enabled
+	}
+}
+
+// WithNetwork attaches Kratos to an existing docker network, reachable from
+// other containers on it by aliases, DefaultAlias when none are given. Host
+// port bindings stay in place.
+func WithNetwork(name string, aliases ...string) func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.network = name
+		c.aliases = aliases
+	}
+}
+
+// WithNetworkBaseURLs makes Kratos advertise its in-network urls as base urls,
+// so flow actions and redirects point to where containers on the network,
+// rather than the test process, can follow them.
+func WithNetworkBaseURLs() func(*KratosConfig) {
+	return func(c *KratosConfig) {
+		c.networkBaseURLs = true
+	}
+}
+
 func Run(ctx context.Context, opts ...Option) (*KratosContainer, error) {
 	cfg := KratosConfig{
 		kratosConfig:             "",
@@ -111,6 +378,7 @@ func Run(ctx context.Context, opts ...Option) (*KratosContainer, error) {
 		kratosImage:              "oryd/kratos:v1.3.1",
 		adminListenerConstructor: net.Listen,
 		frontListenerConstructor: net.Listen,
+		versionQuery:             QueryVersion,
 	}
 
 	for _, fn := range opts {
@@ -159,37 +427,142 @@ func Run(ctx context.Context, opts ...Option) (*KratosContainer, error) {
 	publicURL := net.JoinHostPort(kratosHost, strconv.Itoa(cfg.frontPort))
 	adminURL := net.JoinHostPort(kratosHost, strconv.Itoa(cfg.adminPort))
 
-	return &KratosContainer{
+	res := &KratosContainer{
 		KratosContainer: kratosContainer,
 		PublicURL:       publicURL,
 		AdminURL:        adminURL,
-	}, nil
+		DSN:             kratosReq.Env["DSN"],
+		logs:            dockerLogs(kratosContainer),
+	}
+
+	if cfg.network != "" {
+		res.InternalPublicURL = net.JoinHostPort(cfg.alias(), publicPort)
+		res.InternalAdminURL = net.JoinHostPort(cfg.alias(), adminPort)
+	}
+
+	// an unknown version stays zero, callers fall back to the image tag
+	if ver, err := cfg.versionQuery(ctx, adminURL); err == nil {
+		res.Version = ver
+	}
+
+	return res, nil
+}
+
+// QueryVersion asks the Kratos admin API at adminURL, a host:port, which
+// release it runs.
+func QueryVersion(ctx context.Context, adminURL string) (kratosversion.Version, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+adminURL+"/version", nil)
+	if err != nil {
+		return kratosversion.Version{}, fmt.Errorf("failed to build version request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return kratosversion.Version{}, fmt.Errorf("failed to query kratos version: %w", err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return kratosversion.Version{}, fmt.Errorf(
+			"%w: version endpoint answered %s", kratosversion.ErrNoVersion, resp.Status,
+		)
+	}
+
+	var body struct {
+		Version string `json:"version"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return kratosversion.Version{}, fmt.Errorf("failed to decode kratos version: %w", err)
+	}
+
+	ver, err := kratosversion.Parse(body.Version)
+	if err != nil {
+		return kratosversion.Version{}, fmt.Errorf("failed to parse kratos version: %w", err)
+	}
+
+	return ver, nil
+}
+
+func (cfg KratosConfig) alias() string {
+	if len(cfg.aliases) == 0 {
+		return DefaultAlias
+	}
+
+	return cfg.aliases[0]
+}
+
+func (cfg KratosConfig) baseURLs() (string, string) {
+	if cfg.network != "" && cfg.networkBaseURLs {
+		return "http://" + net.JoinHostPort(cfg.alias(), publicPort) + "/",
+			"http://" + net.JoinHostPort(cfg.alias(), adminPort) + "/"
+	}
+
+	return "http://localhost:" + strconv.Itoa(cfg.frontPort) + "/",
+		"http://localhost:" + strconv.Itoa(cfg.adminPort) + "/"
 }
 
 func containerRequest(cfg KratosConfig) testcontainers.ContainerRequest {
+	cmd := []string{"serve", "-c", ConfigDir + "/kratos.yaml"}
+	if !cfg.withoutDev {
+		cmd = append(cmd, "--dev")
+	}
+
+	if cfg.watchCourier && !slices.Contains(cfg.args, "--watch-courier") {
+		cmd = append(cmd, "--watch-courier")
+	}
+
+	cmd = append(cmd, cfg.args...)
+
+	publicBaseURL, adminBaseURL := cfg.baseURLs()
+
+	env := map[string]string{
+		"LOG_LEVEL":             "trace",
+		"LOG_FORMAT":            "text",
+		"DSN":                   "memory",
+		"SERVE_PUBLIC_BASE_URL": publicBaseURL,
+		"SERVE_ADMIN_BASE_URL":  adminBaseURL,
+	}
+
+	maps.Copy(env, cfg.env)
+
+	var (
+		networks []string
+		aliases  map[string][]string
+	)
+
+	if cfg.network != "" {
+		networks = []string{cfg.network}
+		aliases = map[string][]string{cfg.network: {cfg.alias()}}
+
+		if len(cfg.aliases) > 0 {
+			aliases[cfg.network] = cfg.aliases
+		}
+	}
+
 	return testcontainers.ContainerRequest{
-		Image:        cfg.kratosImage,
-		ExposedPorts: []string{"4433/tcp", "4434/tcp"},
-		Cmd:          []string{"serve", "-c", "/etc/config/kratos/kratos.yaml", "--dev"},
-		Env: map[string]string{
-			"LOG_LEVEL":             "trace",
-			"LOG_FORMAT":            "text",
-			"DSN":                   "memory",
-			"SERVE_PUBLIC_BASE_URL": "http://localhost:" + strconv.Itoa(cfg.frontPort) + "/",
-			"SERVE_ADMIN_BASE_URL":  "http://localhost:" + strconv.Itoa(cfg.adminPort) + "/",
-		},
-		Files: []testcontainers.ContainerFile{
+		Image:           cfg.kratosImage,
+		ExposedPorts:    []string{publicPort + "/tcp", adminPort + "/tcp"},
+		HostAccessPorts: cfg.hostAccessPorts,
+		Networks:        networks,
+		NetworkAliases:  aliases,
+		Cmd:             cmd,
+		Env:             env,
+		Files: append([]testcontainers.ContainerFile{
 			{
 				HostFilePath:      cfg.kratosConfig,
-				ContainerFilePath: "/etc/config/kratos/kratos.yaml",
+				ContainerFilePath: ConfigDir + "/kratos.yaml",
 				FileMode:          readOnlyRights,
 			},
 			{
 				HostFilePath:      cfg.userSchemaPath,
-				ContainerFilePath: "/etc/config/kratos/user.schema.json",
+				ContainerFilePath: ConfigDir + "/user.schema.json",
 				FileMode:          readOnlyRights,
 			},
-		},
+		}, cfg.files...),
 		HostConfigModifier: func(hc *container.HostConfig) {
 			adminPort, _ := nat.NewPort("tcp", "4434")
 			hc.PortBindings = nat.PortMap{
@@ -3,13 +3,21 @@ package tckratos
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/pkg/kratosversion"
+	"github.com/godepo/grokratos/pkg/sqldump"
 )
 
 func TestStartKratosWithTestContainers(t *testing.T) {
@@ -26,6 +34,48 @@ func TestStartKratosWithTestContainers(t *testing.T) {
 		require.NoError(t, container.Terminate(t.Context()))
 		assert.NotEmpty(t, container.AdminConnectionString(t.Context()))
 		assert.NotEmpty(t, container.PublicConnectionString(t.Context()))
+		assert.Equal(t, "v1.3.1", container.KratosVersion(t.Context()).String())
+	})
+
+	t.Run("should be able to detect version", func(t *testing.T) {
+		ctr := NewMockContainer(t)
+
+		container, err := Run(
+			t.Context(),
+			WithKratosConfig("etc/kratos.yaml"),
+			WithUserSchemaPath("etc/user.schema.json"),
+			WithContainerConstructor(
+				func(context.Context, testcontainers.GenericContainerRequest) (testcontainers.Container, error) {
+					return ctr, nil
+				}),
+			WithVersionQuery(func(_ context.Context, adminURL string) (kratosversion.Version, error) {
+				assert.NotEmpty(t, adminURL)
+
+				return kratosversion.MustParse("v1.2.0"), nil
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, kratosversion.MustParse("v1.2.0"), container.Version)
+		assert.Equal(t, "memory", container.DSN)
+	})
+
+	t.Run("should be able to start when version cant be detected", func(t *testing.T) {
+		ctr := NewMockContainer(t)
+
+		container, err := Run(
+			t.Context(),
+			WithKratosConfig("etc/kratos.yaml"),
+			WithUserSchemaPath("etc/user.schema.json"),
+			WithContainerConstructor(
+				func(context.Context, testcontainers.GenericContainerRequest) (testcontainers.Container, error) {
+					return ctr, nil
+				}),
+			WithVersionQuery(func(context.Context, string) (kratosversion.Version, error) {
+				return kratosversion.Version{}, errors.New(uuid.NewString())
+			}),
+		)
+		require.NoError(t, err)
+		assert.True(t, container.Version.IsZero())
 	})
 	t.Run("should be able to be failed", func(t *testing.T) {
 		t.Run("when is not specified config path", func(t *testing.T) {
@@ -90,6 +140,54 @@ func TestStartKratosWithTestContainers(t *testing.T) {
 	})
 }
 
+func TestQueryVersion(t *testing.T) {
+	serve := func(t *testing.T, status int, body string) string {
+		t.Helper()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/version", r.URL.Path)
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+
+		return strings.TrimPrefix(srv.URL, "http://")
+	}
+
+	t.Run("should be able to read reported version", func(t *testing.T) {
+		ver, err := QueryVersion(t.Context(), serve(t, http.StatusOK, `{"version":"v1.3.1"}`))
+		require.NoError(t, err)
+		assert.Equal(t, kratosversion.MustParse("v1.3.1"), ver)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when endpoint is unavailable", func(t *testing.T) {
+			_, err := QueryVersion(t.Context(), serve(t, http.StatusNotFound, ""))
+			require.ErrorIs(t, err, kratosversion.ErrNoVersion)
+		})
+
+		t.Run("when body is not json", func(t *testing.T) {
+			_, err := QueryVersion(t.Context(), serve(t, http.StatusOK, "v1.3.1"))
+			require.Error(t, err)
+		})
+
+		t.Run("when version is malformed", func(t *testing.T) {
+			_, err := QueryVersion(t.Context(), serve(t, http.StatusOK, `{"version":"master"}`))
+			require.ErrorIs(t, err, kratosversion.ErrNoVersion)
+		})
+
+		t.Run("when host is unreachable", func(t *testing.T) {
+			_, err := QueryVersion(t.Context(), "127.0.0.1:1")
+			require.Error(t, err)
+		})
+
+		t.Run("when host is malformed", func(t *testing.T) {
+			_, err := QueryVersion(t.Context(), "%zz")
+			require.Error(t, err)
+		})
+	})
+}
+
 func TestKratosContainer_Terminate(t *testing.T) {
 	expErr := errors.New(uuid.NewString())
 	mock := NewMockContainer(t)
@@ -102,3 +200,255 @@ func TestKratosContainer_Terminate(t *testing.T) {
 	err := container.Terminate(t.Context())
 	require.ErrorIs(t, err, expErr)
 }
+
+func TestKratosContainer_Dumper(t *testing.T) {
+	t.Run("should be able to pick dump from dsn", func(t *testing.T) {
+		container := &KratosContainer{KratosContainer: NewMockContainer(t), DSN: "sqlite:///var/lib/sqlite/db.sqlite"}
+
+		dumper, err := container.Dumper(t.Context())
+		require.NoError(t, err)
+		assert.NotNil(t, dumper)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when database is in memory", func(t *testing.T) {
+			container := &KratosContainer{KratosContainer: NewMockContainer(t), DSN: "memory"}
+
+			_, err := container.Dumper(t.Context())
+			require.ErrorIs(t, err, sqldump.ErrNoDatabase)
+		})
+	})
+}
+
+func TestContainerRequest(t *testing.T) {
+	t.Run("should be able to expose host ports", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithHostAccessPorts(8080)(&cfg)
+		WithHostAccessPorts(9090)(&cfg)
+
+		req := containerRequest(cfg)
+		assert.Equal(t, []int{8080, 9090}, req.HostAccessPorts)
+		assert.NotContains(t, req.Cmd, "--watch-courier")
+	})
+
+	t.Run("should be able to watch courier", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithWatchCourier()(&cfg)
+		WithWatchCourier()(&cfg)
+
+		req := containerRequest(cfg)
+		assert.Equal(t, []string{"serve", "-c", ConfigDir + "/kratos.yaml", "--dev", "--watch-courier"}, req.Cmd)
+	})
+
+	t.Run("should be able to mount extra files next to config", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithFile("etc/mapper.jsonnet", ConfigDir+"/mapper.jsonnet")(&cfg)
+
+		req := containerRequest(cfg)
+		require.Len(t, req.Files, 3)
+		assert.Equal(t, ConfigDir+"/mapper.jsonnet", req.Files[2].ContainerFilePath)
+	})
+	t.Run("should be able to override env and add args", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithEnv("LOG_LEVEL", "info")(&cfg)
+		WithEnv("SECRETS_COOKIE", "cookie-secret-32-characters-long")(&cfg)
+		WithArgs("--watch-courier", "--sqa-opt-out")(&cfg)
+		WithWatchCourier()(&cfg)
+
+		req := containerRequest(cfg)
+		assert.Equal(t, "info", req.Env["LOG_LEVEL"])
+		assert.Equal(t, "cookie-secret-32-characters-long", req.Env["SECRETS_COOKIE"])
+		assert.Equal(t, "memory", req.Env["DSN"])
+		assert.Equal(t, []string{
+			"serve", "-c", ConfigDir + "/kratos.yaml", "--dev", "--watch-courier", "--sqa-opt-out",
+		}, req.Cmd)
+	})
+
+	t.Run("should be able to pass args verbatim", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithDevMode(false)(&cfg)
+		WithArgs("--config", "/a.yaml", "--config", "/b.yaml")(&cfg)
+		WithArgs("--sqa-opt-out", "false")(&cfg)
+		WithArgs("--sqa-opt-out", "false")(&cfg)
+
+		assert.Equal(t, []string{
+			"serve", "-c", ConfigDir + "/kratos.yaml",
+			"--config", "/a.yaml", "--config", "/b.yaml", "--sqa-opt-out", "false", "--sqa-opt-out", "false",
+		}, containerRequest(cfg).Cmd)
+	})
+
+	t.Run("should be able to keep explicit log level", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithEnv("LOG_LEVEL", "error")(&cfg)
+		assert.Equal(t, "error", containerRequest(cfg).Env["LOG_LEVEL"])
+	})
+
+	t.Run("should be able to run without dev mode", func(t *testing.T) {
+		var cfg KratosConfig
+
+		WithDevMode(false)(&cfg)
+		assert.NotContains(t, containerRequest(cfg).Cmd, "--dev")
+
+		WithDevMode(true)(&cfg)
+		assert.Contains(t, containerRequest(cfg).Cmd, "--dev")
+	})
+
+	t.Run("should be able to join network", func(t *testing.T) {
+		cfg := KratosConfig{frontPort: 4000, adminPort: 4001}
+
+		req := containerRequest(cfg)
+		assert.Empty(t, req.Networks)
+		assert.Empty(t, req.NetworkAliases)
+
+		WithNetwork("sut")(&cfg)
+
+		req = containerRequest(cfg)
+		assert.Equal(t, []string{"sut"}, req.Networks)
+		assert.Equal(t, map[string][]string{"sut": {DefaultAlias}}, req.NetworkAliases)
+		assert.Equal(t, "http://localhost:4000/", req.Env["SERVE_PUBLIC_BASE_URL"])
+		assert.Equal(t, "http://localhost:4001/", req.Env["SERVE_ADMIN_BASE_URL"])
+
+		WithNetwork("sut", "identity", "auth")(&cfg)
+		WithNetworkBaseURLs()(&cfg)
+
+		req = containerRequest(cfg)
+		assert.Equal(t, map[string][]string{"sut": {"identity", "auth"}}, req.NetworkAliases)
+		assert.Equal(t, "http://identity:4433/", req.Env["SERVE_PUBLIC_BASE_URL"])
+		assert.Equal(t, "http://identity:4434/", req.Env["SERVE_ADMIN_BASE_URL"])
+	})
+
+	t.Run("should be able to ignore network base urls without network", func(t *testing.T) {
+		cfg := KratosConfig{frontPort: 4000, adminPort: 4001}
+
+		WithNetworkBaseURLs()(&cfg)
+		assert.Equal(t, "http://localhost:4000/", containerRequest(cfg).Env["SERVE_PUBLIC_BASE_URL"])
+	})
+}
+
+func TestKratosContainer_InternalConnectionString(t *testing.T) {
+	run := func(t *testing.T, opts ...Option) *KratosContainer {
+		t.Helper()
+
+		kc, err := Run(t.Context(), append([]Option{
+			WithKratosConfig("etc/kratos.yaml"),
+			WithUserSchemaPath("etc/user.schema.json"),
+			WithContainerConstructor(func(
+				context.Context, testcontainers.GenericContainerRequest,
+			) (testcontainers.Container, error) {
+				return NewMockContainer(t), nil
+			}),
+			WithVersionQuery(func(context.Context, string) (kratosversion.Version, error) {
+				return kratosversion.MustParse("v1.3.1"), nil
+			}),
+		}, opts...)...)
+		require.NoError(t, err)
+
+		return kc
+	}
+
+	t.Run("should be able to report in-network urls", func(t *testing.T) {
+		kc := run(t, WithNetwork("sut", "identity"))
+
+		assert.Equal(t, "identity:4433", kc.InternalPublicConnectionString(t.Context()))
+		assert.Equal(t, "identity:4434", kc.InternalAdminConnectionString(t.Context()))
+	})
+
+	t.Run("should be able to stay empty without network", func(t *testing.T) {
+		kc := run(t)
+
+		assert.Empty(t, kc.InternalPublicConnectionString(t.Context()))
+		assert.Empty(t, kc.InternalAdminConnectionString(t.Context()))
+	})
+}
+
+func TestKratosContainer_WriteConfig(t *testing.T) {
+	t.Run("should be able to copy config", func(t *testing.T) {
+		mock := NewMockContainer(t)
+		mock.EXPECT().CopyToContainer(t.Context(), []byte("dsn: memory"), ConfigDir+"/kratos.yaml", readOnlyRights).
+			Return(nil)
+
+		container := &KratosContainer{KratosContainer: mock}
+		require.NoError(t, container.WriteConfig(t.Context(), []byte("dsn: memory")))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		expErr := errors.New(uuid.NewString())
+		mock := NewMockContainer(t)
+		mock.EXPECT().CopyToContainer(t.Context(), []byte("dsn: memory"), ConfigDir+"/kratos.yaml", readOnlyRights).
+			Return(expErr)
+
+		container := &KratosContainer{KratosContainer: mock}
+		require.ErrorIs(t, container.WriteConfig(t.Context(), []byte("dsn: memory")), expErr)
+	})
+}
+
+func TestLogsReloads(t *testing.T) {
+	assert.True(t, LogsReloads(""))
+	assert.True(t, LogsReloads("info"))
+	assert.True(t, LogsReloads("debug"))
+	assert.False(t, LogsReloads("WARN"))
+	assert.False(t, LogsReloads("error"))
+}
+
+func TestKratosContainer_ConfigReloads(t *testing.T) {
+	t.Run("should be able to count reloads", func(t *testing.T) {
+		logs := strings.Join([]string{
+			"level=info msg=A change to a configuration file was detected.",
+			"level=info msg=" + ConfigAppliedMarker + ".",
+			"level=error msg=" + ConfigRejectedMarker + " and could not be loaded.",
+			"level=error msg=" + ConfigImmutableMarker + ". Rolling back to the last working configuration revision...",
+			"level=error msg=" + ConfigErrorMarker + " kratos.yaml",
+			"level=info msg=" + ConfigAppliedMarker + ".",
+		}, "\n")
+
+		mock := NewMockContainer(t)
+		mock.EXPECT().Logs(t.Context()).Return(io.NopCloser(strings.NewReader(logs)), nil)
+
+		container := &KratosContainer{KratosContainer: mock}
+
+		got, err := container.ConfigReloads(t.Context(), time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, ConfigReloads{Applied: 2, Rejected: 3}, got)
+	})
+
+	t.Run("should be able to skip lines logged until since", func(t *testing.T) {
+		logs := strings.Join([]string{
+			"2026-01-02T10:00:00.1Z level=error msg=" + ConfigRejectedMarker + ".",
+			"2026-01-02T10:00:01.2Z level=info msg=" + ConfigAppliedMarker + ".",
+			"2026-01-02T10:00:02.3Z level=info msg=" + ConfigAppliedMarker + ".",
+		}, "\n")
+
+		since := time.Date(2026, 1, 2, 10, 0, 1, 200_000_000, time.UTC)
+		container := &KratosContainer{
+			logs: func(_ context.Context, got time.Time) (io.ReadCloser, error) {
+				assert.Equal(t, since, got)
+
+				return io.NopCloser(strings.NewReader(logs)), nil
+			},
+		}
+
+		got, err := container.ConfigReloads(t.Context(), since)
+		require.NoError(t, err)
+		assert.Equal(t, ConfigReloads{
+			Applied: 1,
+			Until:   time.Date(2026, 1, 2, 10, 0, 2, 300_000_000, time.UTC),
+		}, got)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		expErr := errors.New(uuid.NewString())
+		mock := NewMockContainer(t)
+		mock.EXPECT().Logs(t.Context()).Return(nil, expErr)
+
+		container := &KratosContainer{KratosContainer: mock}
+
+		_, err := container.ConfigReloads(t.Context(), time.Time{})
+		require.ErrorIs(t, err, expErr)
+	})
+}
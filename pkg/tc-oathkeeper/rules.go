@@ -0,0 +1,77 @@
+package tcoathkeeper
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Handler names Oathkeeper pipeline handlers used by generated rules.
+const (
+	CookieSession = "cookie_session"
+	BearerToken   = "bearer_token"
+	Anonymous     = "anonymous"
+	Noop          = "noop"
+	Allow         = "allow"
+	Deny          = "deny"
+	Header        = "header"
+)
+
+type (
+	// Rule is an Oathkeeper access rule. Upstreams on the test host are
+	// reachable as http://host.testcontainers.internal:<port> once the port
+	// is passed to WithHostAccessPorts.
+	Rule struct {
+		ID             string    `json:"id"`
+		Match          Match     `json:"match"`
+		Authenticators []Handler `json:"authenticators"`
+		Authorizer     Handler   `json:"authorizer"`
+		Mutators       []Handler `json:"mutators"`
+		Upstream       *Upstream `json:"upstream,omitempty"`
+	}
+
+	Match struct {
+		URL     string   `json:"url"`
+		Methods []string `json:"methods"`
+	}
+
+	Handler struct {
+		Handler string         `json:"handler"`
+		Config  map[string]any `json:"config,omitempty"`
+	}
+
+	Upstream struct {
+		URL          string `json:"url"`
+		PreserveHost bool   `json:"preserve_host,omitempty"`
+		StripPath    string `json:"strip_path,omitempty"`
+	}
+)
+
+// Protect returns a rule proxying matching requests to upstream for callers
+// with a Kratos session cookie or token, passing the identity id to upstream
+// in the X-User header.
+func Protect(id, match, upstream string, methods ...string) Rule {
+	return Rule{
+		ID:             id,
+		Match:          Match{URL: match, Methods: methods},
+		Authenticators: []Handler{{Handler: CookieSession}, {Handler: BearerToken}},
+		Authorizer:     Handler{Handler: Allow},
+		Mutators: []Handler{{
+			Handler: Header,
+			Config:  map[string]any{"headers": map[string]any{"X-User": "{{ print .Subject }}"}},
+		}},
+		Upstream: &Upstream{URL: upstream},
+	}
+}
+
+func marshalRules(rules []Rule) ([]byte, error) {
+	if rules == nil {
+		rules = []Rule{}
+	}
+
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal access rules: %w", err)
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,313 @@
+package tcoathkeeper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrKratosURLNotFound = errors.New("kratos public url not found")
+
+const readOnlyRights int64 = 0644
+
+// ConfigDir is where oathkeeper.yml and rules.json live in the container.
+const ConfigDir = "/etc/config/oathkeeper"
+
+const (
+	// DefaultAlias is the network alias of Oathkeeper when WithNetwork is given none.
+	DefaultAlias = "oathkeeper"
+
+	proxyPort = 4455
+	apiPort   = 4456
+)
+
+type Option func(*OathkeeperConfig)
+
+type OathkeeperContainer struct {
+	OathkeeperContainer testcontainers.Container
+	ProxyURL            string
+	APIURL              string
+}
+
+func (oc *OathkeeperContainer) ProxyConnectionString(ctx context.Context) string {
+	return oc.ProxyURL
+}
+
+func (oc *OathkeeperContainer) APIConnectionString(ctx context.Context) string {
+	return oc.APIURL
+}
+
+func (oc *OathkeeperContainer) Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	err := oc.OathkeeperContainer.Terminate(ctx, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to terminate oathkeeper container: %w", err)
+	}
+
+	return nil
+}
+
+type OathkeeperConfig struct {
+	image                string
+	kratosURL            string
+	rules                []Rule
+	network              string
+	aliases              []string
+	hostAccessPorts      []int
+	proxyPort            int
+	apiPort              int
+	containerConstructor func(
+		ctx context.Context,
+		req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)
+	proxyListenerConstructor func(network string, address string) (net.Listener, error)
+	apiListenerConstructor   func(network string, address string) (net.Listener, error)
+}
+
+func WithImage(image string) Option {
+	return func(c *OathkeeperConfig) {
+		c.image = image
+	}
+}
+
+// WithKratosURL points session authenticators at the Kratos public API as
+// seen from the Oathkeeper container, e.g. http://kratos:4433.
+func WithKratosURL(url string) Option {
+	return func(c *OathkeeperConfig) {
+		c.kratosURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+func WithRules(rules ...Rule) Option {
+	return func(c *OathkeeperConfig) {
+		c.rules = append(c.rules, rules...)
+	}
+}
+
+// WithNetwork attaches Oathkeeper to an existing docker network, reachable
+// from other containers on it by aliases, DefaultAlias when none are given.
+func WithNetwork(name string, aliases ...string) Option {
+	return func(c *OathkeeperConfig) {
+		c.network = name
+		c.aliases = aliases
+	}
+}
+
+// WithHostAccessPorts exposes host ports to Oathkeeper, e.g. an httptest
+// upstream, as host.testcontainers.internal:<port>.
+func WithHostAccessPorts(ports ...int) Option {
+	return func(c *OathkeeperConfig) {
+		c.hostAccessPorts = append(c.hostAccessPorts, ports...)
+	}
+}
+
+func WithContainerConstructor(
+	fn func(ctx context.Context, req testcontainers.GenericContainerRequest,
+	) (testcontainers.Container, error)) Option {
+	return func(c *OathkeeperConfig) {
+		c.containerConstructor = fn
+	}
+}
+
+func WithProxyListenerConstructor(fn func(network string, address string) (net.Listener, error)) Option {
+	return func(c *OathkeeperConfig) {
+		c.proxyListenerConstructor = fn
+	}
+}
+
+func WithAPIListenerConstructor(fn func(network string, address string) (net.Listener, error)) Option {
+	return func(c *OathkeeperConfig) {
+		c.apiListenerConstructor = fn
+	}
+}
+
+func Run(ctx context.Context, opts ...Option) (*OathkeeperContainer, error) {
+	cfg := OathkeeperConfig{
+		image:                    "oryd/oathkeeper:v0.40.9",
+		containerConstructor:     testcontainers.GenericContainer,
+		proxyListenerConstructor: net.Listen,
+		apiListenerConstructor:   net.Listen,
+	}
+
+	for _, fn := range opts {
+		fn(&cfg)
+	}
+
+	if cfg.kratosURL == "" {
+		return nil, ErrKratosURLNotFound
+	}
+
+	proxyLn, err := cfg.proxyListenerConstructor("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on proxy port: %w", err)
+	}
+
+	cfg.proxyPort = proxyLn.Addr().(*net.TCPAddr).Port
+	_ = proxyLn.Close()
+
+	apiLn, err := cfg.apiListenerConstructor("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on api port: %w", err)
+	}
+
+	cfg.apiPort = apiLn.Addr().(*net.TCPAddr).Port
+	_ = apiLn.Close()
+
+	req, err := containerRequest(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	oathkeeper, err := cfg.containerConstructor(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start oathkeeper: %w", err)
+	}
+
+	return &OathkeeperContainer{
+		OathkeeperContainer: oathkeeper,
+		ProxyURL:            net.JoinHostPort("localhost", strconv.Itoa(cfg.proxyPort)),
+		APIURL:              net.JoinHostPort("localhost", strconv.Itoa(cfg.apiPort)),
+	}, nil
+}
+
+// Config renders oathkeeper.yml with session authenticators checking
+// sessions against Kratos whoami.
+func Config(kratosURL string) ([]byte, error) {
+	session := func(extra map[string]any) map[string]any {
+		cfg := map[string]any{
+			"check_session_url": kratosURL + "/sessions/whoami",
+			"preserve_path":     true,
+			"extra_from":        "@this",
+			"subject_from":      "identity.id",
+		}
+
+		for key, val := range extra {
+			cfg[key] = val
+		}
+
+		return map[string]any{"enabled": true, "config": cfg}
+	}
+
+	enabled := map[string]any{"enabled": true}
+
+	doc := map[string]any{
+		"serve": map[string]any{
+			"proxy": map[string]any{"port": proxyPort},
+			"api":   map[string]any{"port": apiPort},
+		},
+		"access_rules": map[string]any{
+			"matching_strategy": "glob",
+			"repositories":      []string{"file://" + ConfigDir + "/rules.json"},
+		},
+		"errors": map[string]any{
+			"fallback": []string{"json"},
+			"handlers": map[string]any{"json": map[string]any{"enabled": true, "config": map[string]any{"verbose": true}}},
+		},
+		"authenticators": map[string]any{
+			Anonymous:     map[string]any{"enabled": true, "config": map[string]any{"subject": "guest"}},
+			Noop:          enabled,
+			CookieSession: session(map[string]any{"only": []string{"ory_kratos_session"}}),
+			BearerToken:   session(nil),
+		},
+		"authorizers": map[string]any{
+			Allow: enabled,
+			Deny:  enabled,
+		},
+		"mutators": map[string]any{
+			Noop:   enabled,
+			Header: map[string]any{"enabled": true, "config": map[string]any{"headers": map[string]any{}}},
+		},
+	}
+
+	raw, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal oathkeeper config: %w", err)
+	}
+
+	return raw, nil
+}
+
+func exposed(port int) string {
+	return strconv.Itoa(port) + "/tcp"
+}
+
+func (cfg OathkeeperConfig) alias() string {
+	if len(cfg.aliases) == 0 {
+		return DefaultAlias
+	}
+
+	return cfg.aliases[0]
+}
+
+func containerRequest(cfg OathkeeperConfig) (testcontainers.ContainerRequest, error) {
+	conf, err := Config(cfg.kratosURL)
+	if err != nil {
+		return testcontainers.ContainerRequest{}, err
+	}
+
+	rules, err := marshalRules(cfg.rules)
+	if err != nil {
+		return testcontainers.ContainerRequest{}, err
+	}
+
+	var (
+		networks []string
+		aliases  map[string][]string
+	)
+
+	if cfg.network != "" {
+		networks = []string{cfg.network}
+		aliases = map[string][]string{cfg.network: {cfg.alias()}}
+
+		if len(cfg.aliases) > 0 {
+			aliases[cfg.network] = cfg.aliases
+		}
+	}
+
+	return testcontainers.ContainerRequest{
+		Image:           cfg.image,
+		ExposedPorts:    []string{exposed(proxyPort), exposed(apiPort)},
+		HostAccessPorts: cfg.hostAccessPorts,
+		Networks:        networks,
+		NetworkAliases:  aliases,
+		Cmd:             []string{"serve", "-c", ConfigDir + "/oathkeeper.yml"},
+		Files: []testcontainers.ContainerFile{
+			{
+				Reader:            bytes.NewReader(conf),
+				ContainerFilePath: ConfigDir + "/oathkeeper.yml",
+				FileMode:          readOnlyRights,
+			},
+			{
+				Reader:            bytes.NewReader(rules),
+				ContainerFilePath: ConfigDir + "/rules.json",
+				FileMode:          readOnlyRights,
+			},
+		},
+		HostConfigModifier: func(hc *container.HostConfig) {
+			hc.PortBindings = nat.PortMap{
+				nat.Port(exposed(proxyPort)): []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(cfg.proxyPort)}},
+				nat.Port(exposed(apiPort)):   []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: strconv.Itoa(cfg.apiPort)}},
+			}
+		},
+		WaitingFor: wait.ForHTTP("/health/ready").
+			WithPort(nat.Port(exposed(apiPort))).
+			WithStartupTimeout(time.Minute).
+			WithStatusCodeMatcher(func(status int) bool {
+				return status == http.StatusOK
+			}),
+	}, nil
+}
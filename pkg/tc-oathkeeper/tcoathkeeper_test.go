@@ -0,0 +1,166 @@
+package tcoathkeeper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"gopkg.in/yaml.v3"
+)
+
+type fakeContainer struct {
+	testcontainers.Container
+
+	err error
+}
+
+func (f fakeContainer) Terminate(context.Context, ...testcontainers.TerminateOption) error {
+	return f.err
+}
+
+func read(t *testing.T, file testcontainers.ContainerFile) []byte {
+	t.Helper()
+
+	raw, err := io.ReadAll(file.Reader)
+	require.NoError(t, err)
+
+	return raw
+}
+
+func TestRun(t *testing.T) {
+	constructor := func(req *testcontainers.GenericContainerRequest) Option {
+		return WithContainerConstructor(func(
+			_ context.Context, got testcontainers.GenericContainerRequest,
+		) (testcontainers.Container, error) {
+			*req = got
+
+			return fakeContainer{}, nil
+		})
+	}
+
+	t.Run("should be able to run", func(t *testing.T) {
+		var req testcontainers.GenericContainerRequest
+
+		oc, err := Run(t.Context(), WithKratosURL("http://kratos:4433/"), constructor(&req))
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, oc.ProxyConnectionString(t.Context()))
+		assert.NotEqual(t, oc.ProxyConnectionString(t.Context()), oc.APIConnectionString(t.Context()))
+		assert.Equal(t, "oryd/oathkeeper:v0.40.9", req.Image)
+		assert.Contains(t, string(read(t, req.Files[0])), "http://kratos:4433/sessions/whoami")
+		require.NoError(t, oc.Terminate(t.Context()))
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when kratos url is not specified", func(t *testing.T) {
+			_, err := Run(t.Context())
+			require.ErrorIs(t, err, ErrKratosURLNotFound)
+		})
+
+		t.Run("when cant allocate proxy port", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), WithKratosURL("http://kratos:4433"),
+				WithProxyListenerConstructor(func(string, string) (net.Listener, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when cant allocate api port", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), WithKratosURL("http://kratos:4433"),
+				WithAPIListenerConstructor(func(string, string) (net.Listener, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when run container will be failed", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := Run(t.Context(), WithKratosURL("http://kratos:4433"),
+				WithContainerConstructor(func(
+					context.Context, testcontainers.GenericContainerRequest,
+				) (testcontainers.Container, error) {
+					return nil, expErr
+				}))
+			require.ErrorIs(t, err, expErr)
+		})
+
+		t.Run("when terminate will be failed", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			oc := &OathkeeperContainer{OathkeeperContainer: fakeContainer{err: expErr}}
+			require.ErrorIs(t, oc.Terminate(t.Context()), expErr)
+		})
+	})
+}
+
+func TestContainerRequest(t *testing.T) {
+	t.Run("should be able to render rules", func(t *testing.T) {
+		cfg := OathkeeperConfig{kratosURL: "http://kratos:4433"}
+		WithRules(Protect("api", "http://<*>/api/<**>", "http://host.testcontainers.internal:8080", "GET"))(&cfg)
+		WithHostAccessPorts(8080)(&cfg)
+
+		req, err := containerRequest(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []int{8080}, req.HostAccessPorts)
+		assert.Empty(t, req.Networks)
+
+		var rules []Rule
+		require.NoError(t, json.Unmarshal(read(t, req.Files[1]), &rules))
+		require.Len(t, rules, 1)
+		assert.Equal(t, "api", rules[0].ID)
+		assert.Equal(t, []string{"GET"}, rules[0].Match.Methods)
+		assert.Equal(t, CookieSession, rules[0].Authenticators[0].Handler)
+		assert.Equal(t, "http://host.testcontainers.internal:8080", rules[0].Upstream.URL)
+	})
+
+	t.Run("should be able to render empty rules", func(t *testing.T) {
+		req, err := containerRequest(OathkeeperConfig{kratosURL: "http://kratos:4433"})
+		require.NoError(t, err)
+		assert.JSONEq(t, "[]", string(read(t, req.Files[1])))
+	})
+
+	t.Run("should be able to join network", func(t *testing.T) {
+		cfg := OathkeeperConfig{kratosURL: "http://kratos:4433"}
+
+		WithNetwork("sut")(&cfg)
+
+		req, err := containerRequest(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"sut"}, req.Networks)
+		assert.Equal(t, map[string][]string{"sut": {DefaultAlias}}, req.NetworkAliases)
+
+		WithNetwork("sut", "edge")(&cfg)
+
+		req, err = containerRequest(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]string{"sut": {"edge"}}, req.NetworkAliases)
+	})
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("should be able to point authenticators at kratos", func(t *testing.T) {
+		raw, err := Config("http://kratos:4433")
+		require.NoError(t, err)
+
+		var doc struct {
+			Authenticators map[string]struct {
+				Enabled bool           `yaml:"enabled"`
+				Config  map[string]any `yaml:"config"`
+			} `yaml:"authenticators"`
+		}
+		require.NoError(t, yaml.Unmarshal(raw, &doc))
+
+		for _, name := range []string{CookieSession, BearerToken} {
+			assert.True(t, doc.Authenticators[name].Enabled, name)
+			assert.Equal(t, "http://kratos:4433/sessions/whoami", doc.Authenticators[name].Config["check_session_url"], name)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+//go:embed etc/body.jsonnet
+var forwardBody []byte
+
+// Hook describes where Kratos calls the receiver. Name is the key requests
+// and scripted responses are looked up by.
+type Hook struct {
+	Name string
+	// Flow is one of registration, login, settings, recovery or verification.
+	Flow string
+	// Before registers a pre-flow hook instead of an after hook.
+	Before bool
+	// Method limits an after hook to one strategy, e.g. password or oidc.
+	Method string
+	// Body is the Jsonnet template of the payload; by default ctx is sent as is.
+	Body []byte
+	// BodyURL points at a template Kratos loads itself, e.g. a file mounted
+	// into the container. It takes precedence over Body.
+	BodyURL      string
+	Parse        bool
+	CanInterrupt bool
+	Ignore       bool
+}
+
+func (h Hook) Path() string {
+	switch {
+	case h.Before:
+		return "selfservice.flows." + h.Flow + ".before.hooks"
+	case h.Method == "":
+		return "selfservice.flows." + h.Flow + ".after.hooks"
+	default:
+		return "selfservice.flows." + h.Flow + ".after." + h.Method + ".hooks"
+	}
+}
+
+// Patch registers hooks as web_hook entries pointing at the receiver. They are
+// placed ahead of the session hook, which Kratos expects to run last.
+func (r *Receiver) Patch(hooks ...Hook) kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		for _, hook := range hooks {
+			if err := insertHook(cfg, hook.Path(), r.hookConfig(hook)); err != nil {
+				return fmt.Errorf("failed to register hook %s: %w", hook.Name, err)
+			}
+		}
+
+		return nil
+	}
+}
+
+func (r *Receiver) hookConfig(hook Hook) map[string]any {
+	body := hook.Body
+	if len(body) == 0 {
+		body = forwardBody
+	}
+
+	bodyURL := hook.BodyURL
+	if bodyURL == "" {
+		bodyURL = "base64://" + base64.StdEncoding.EncodeToString(body)
+	}
+
+	return map[string]any{
+		"hook": "web_hook",
+		"config": map[string]any{
+			"url":           r.URL() + "/hooks/" + hook.Name,
+			"method":        "POST",
+			"body":          bodyURL,
+			"can_interrupt": hook.CanInterrupt,
+			"response": map[string]any{
+				"parse":  hook.Parse,
+				"ignore": hook.Ignore,
+			},
+		},
+	}
+}
+
+func insertHook(cfg *kratosconf.Config, path string, hook map[string]any) error {
+	current, _ := cfg.Get(path)
+	list, _ := current.([]any)
+
+	pos := len(list)
+
+	for i, item := range list {
+		if obj, ok := item.(map[string]any); ok && obj["hook"] == "session" {
+			pos = i
+
+			break
+		}
+	}
+
+	res := make([]any, 0, len(list)+1)
+	res = append(res, list[:pos]...)
+	res = append(res, hook)
+	res = append(res, list[pos:]...)
+
+	if err := cfg.Set(path, res); err != nil {
+		return fmt.Errorf("failed to set %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+func TestHook_Path(t *testing.T) {
+	assert.Equal(t, "selfservice.flows.login.before.hooks", Hook{Flow: "login", Before: true}.Path())
+	assert.Equal(t, "selfservice.flows.settings.after.hooks", Hook{Flow: "settings"}.Path())
+	assert.Equal(t, "selfservice.flows.registration.after.password.hooks",
+		Hook{Flow: "registration", Method: "password"}.Path())
+}
+
+func TestReceiver_Patch(t *testing.T) {
+	rcv := newReceiver(t)
+
+	t.Run("should be able to insert hooks ahead of session", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Append("selfservice.flows.registration.after.password.hooks",
+			map[string]any{"hook": "session"}))
+
+		require.NoError(t, cfg.Apply(rcv.Patch(
+			Hook{Name: "sync", Flow: "registration", Method: "password", Parse: true},
+			Hook{Name: "audit", Flow: "registration", Method: "password", BodyURL: "file:///audit.jsonnet"},
+		)))
+
+		hooks, _ := cfg.Get("selfservice.flows.registration.after.password.hooks")
+		list := hooks.([]any)
+		require.Len(t, list, 3)
+
+		first := list[0].(map[string]any)["config"].(map[string]any)
+		assert.Equal(t, rcv.URL()+"/hooks/sync", first["url"])
+		assert.Equal(t, true, first["response"].(map[string]any)["parse"])
+		second := list[1].(map[string]any)["config"].(map[string]any)
+		assert.Equal(t, rcv.URL()+"/hooks/audit", second["url"])
+		assert.Equal(t, "file:///audit.jsonnet", second["body"])
+		assert.Equal(t, "session", list[2].(map[string]any)["hook"])
+	})
+
+	t.Run("should be able to be failed when flows is not object", func(t *testing.T) {
+		cfg := kratosconf.New()
+		require.NoError(t, cfg.Set("selfservice.flows", "broken"))
+		require.ErrorIs(t, rcv.Patch(Hook{Name: "sync", Flow: "login"})(cfg), kratosconf.ErrNotObject)
+	})
+}
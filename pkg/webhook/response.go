@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type (
+	Response struct {
+		Status int
+		Body   any
+	}
+
+	// Message is a ui message Kratos shows when a hook interrupts the flow.
+	Message struct {
+		ID   int64          `json:"id"`
+		Text string         `json:"text"`
+		Type string         `json:"type"`
+		Ctx  map[string]any `json:"context,omitempty"`
+	}
+
+	fieldMessages struct {
+		InstancePtr string    `json:"instance_ptr"`
+		Messages    []Message `json:"messages"`
+	}
+)
+
+func OK() Response {
+	return Response{Status: http.StatusOK}
+}
+
+// Interrupt fails the flow, attaching messages to the field at instancePtr,
+// for example "#/traits/email". Only hooks with can_interrupt or response.parse
+// make Kratos honour it.
+func Interrupt(status int, instancePtr string, messages ...Message) Response {
+	for i := range messages {
+		if messages[i].Type == "" {
+			messages[i].Type = "error"
+		}
+	}
+
+	return Response{
+		Status: status,
+		Body: map[string]any{
+			"messages": []fieldMessages{{InstancePtr: instancePtr, Messages: messages}},
+		},
+	}
+}
+
+// PatchIdentity replaces identity fields, e.g. traits or metadata_public,
+// for hooks registered with Parse.
+func PatchIdentity(identity map[string]any) Response {
+	return Response{
+		Status: http.StatusOK,
+		Body:   map[string]any{"identity": identity},
+	}
+}
+
+func (r Response) write(w http.ResponseWriter) {
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if r.Body == nil {
+		w.WriteHeader(status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(r.Body)
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godepo/grokratos/internal/hostserver"
+)
+
+const pollInterval = 50 * time.Millisecond
+
+type (
+	Request struct {
+		Hook       string
+		Method     string
+		Header     http.Header
+		Body       []byte
+		ReceivedAt time.Time
+	}
+
+	Option func(*Receiver)
+
+	// Receiver records calls Kratos makes to web_hook hooks and answers them
+	// with scripted responses, 200 with an empty body by default.
+	Receiver struct {
+		listenerConstructor hostserver.ListenerConstructor
+		server              *hostserver.Server
+
+		mu        sync.Mutex
+		requests  []Request
+		consumed  []bool
+		responses map[string]Response
+	}
+)
+
+func WithListenerConstructor(fn hostserver.ListenerConstructor) Option {
+	return func(r *Receiver) {
+		r.listenerConstructor = fn
+	}
+}
+
+func New(opts ...Option) (*Receiver, error) {
+	rcv := &Receiver{
+		listenerConstructor: net.Listen,
+		responses:           map[string]Response{},
+	}
+
+	for _, op := range opts {
+		op(rcv)
+	}
+
+	srv, err := hostserver.Start(rcv.Handler(), rcv.listenerConstructor)
+	if err != nil {
+		return nil, fmt.Errorf("webhook receiver: %w", err)
+	}
+
+	rcv.server = srv
+
+	return rcv, nil
+}
+
+func (r *Receiver) Port() int {
+	return r.server.Port()
+}
+
+// URL is the receiver address as seen from inside the Kratos container.
+func (r *Receiver) URL() string {
+	return r.server.URL()
+}
+
+func (r *Receiver) Close() error {
+	if err := r.server.Close(); err != nil {
+		return fmt.Errorf("webhook receiver: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Receiver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hooks/{name}", r.receive)
+
+	return mux
+}
+
+// Respond scripts the answer for hook until the end of t.
+func (r *Receiver) Respond(t testing.TB, hook string, resp Response) {
+	t.Helper()
+
+	r.mu.Lock()
+	prev, had := r.responses[hook]
+	r.responses[hook] = resp
+	r.mu.Unlock()
+
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if had {
+			r.responses[hook] = prev
+		} else {
+			delete(r.responses, hook)
+		}
+	})
+}
+
+func (r *Receiver) Requests(hook string) []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res []Request
+
+	for _, req := range r.requests {
+		if req.Hook == hook {
+			res = append(res, req)
+		}
+	}
+
+	return res
+}
+
+// Drain marks every recorded call of hook as seen, so WaitFor only returns
+// calls made afterwards.
+func (r *Receiver) Drain(hook string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, req := range r.requests {
+		if req.Hook == hook {
+			r.consumed[i] = true
+		}
+	}
+}
+
+// WaitFor returns the oldest call of hook not returned before.
+func (r *Receiver) WaitFor(ctx context.Context, hook string) (Request, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if req, ok := r.take(hook); ok {
+			return req, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return Request{}, fmt.Errorf("hook %s was not called: %w", hook, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Receiver) receive(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	hook := req.PathValue("name")
+
+	r.mu.Lock()
+	r.requests = append(r.requests, Request{
+		Hook:       hook,
+		Method:     req.Method,
+		Header:     req.Header.Clone(),
+		Body:       body,
+		ReceivedAt: time.Now(),
+	})
+	r.consumed = append(r.consumed, false)
+	resp, ok := r.responses[hook]
+	r.mu.Unlock()
+
+	if !ok {
+		resp = OK()
+	}
+
+	resp.write(w)
+}
+
+func (r *Receiver) take(hook string) (Request, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, req := range r.requests {
+		if !r.consumed[i] && req.Hook == hook {
+			r.consumed[i] = true
+
+			return req, true
+		}
+	}
+
+	return Request{}, false
+}
+
+func (r Request) Decode(to any) error {
+	if err := json.Unmarshal(r.Body, to); err != nil {
+		return fmt.Errorf("failed to decode %s payload: %w", r.Hook, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReceiver(t *testing.T) *Receiver {
+	t.Helper()
+
+	rcv, err := New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = rcv.Close()
+	})
+
+	return rcv
+}
+
+func call(t *testing.T, rcv *Receiver, hook, body string) (int, map[string]any) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost,
+		rcv.server.LocalURL()+"/hooks/"+hook, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("X-Test", "yes")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	res := map[string]any{}
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+
+	return resp.StatusCode, res
+}
+
+func TestReceiver(t *testing.T) {
+	t.Run("should be able to record calls and answer ok", func(t *testing.T) {
+		rcv := newReceiver(t)
+
+		status, _ := call(t, rcv, "sync", `{"identity":{"id":"1"}}`)
+		assert.Equal(t, http.StatusOK, status)
+
+		req, err := rcv.WaitFor(t.Context(), "sync")
+		require.NoError(t, err)
+		assert.Equal(t, "yes", req.Header.Get("X-Test"))
+
+		var payload struct {
+			Identity struct {
+				ID string `json:"id"`
+			} `json:"identity"`
+		}
+		require.NoError(t, req.Decode(&payload))
+		assert.Equal(t, "1", payload.Identity.ID)
+		assert.Len(t, rcv.Requests("sync"), 1)
+		assert.Empty(t, rcv.Requests("other"))
+	})
+
+	t.Run("should be able to skip drained calls", func(t *testing.T) {
+		rcv := newReceiver(t)
+
+		call(t, rcv, "sync", `{"n":1}`)
+		rcv.Drain("sync")
+		call(t, rcv, "sync", `{"n":2}`)
+
+		req, err := rcv.WaitFor(t.Context(), "sync")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"n":2}`, string(req.Body))
+	})
+
+	t.Run("should be able to script responses for a test", func(t *testing.T) {
+		rcv := newReceiver(t)
+
+		t.Run("interrupt", func(t *testing.T) {
+			rcv.Respond(t, "sync", Interrupt(http.StatusBadRequest, "#/traits/email",
+				Message{ID: 4000001, Text: "blocked"}))
+
+			status, body := call(t, rcv, "sync", `{}`)
+			assert.Equal(t, http.StatusBadRequest, status)
+
+			msg := body["messages"].([]any)[0].(map[string]any)
+			assert.Equal(t, "#/traits/email", msg["instance_ptr"])
+			assert.Equal(t, "error", msg["messages"].([]any)[0].(map[string]any)["type"])
+		})
+
+		t.Run("patch", func(t *testing.T) {
+			rcv.Respond(t, "sync", PatchIdentity(map[string]any{"metadata_public": map[string]any{"a": 1}}))
+
+			_, body := call(t, rcv, "sync", `{}`)
+			assert.Contains(t, body, "identity")
+		})
+
+		status, body := call(t, rcv, "sync", `{}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, body)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when hook is not called", func(t *testing.T) {
+			rcv := newReceiver(t)
+
+			ctx, cancel := context.WithTimeout(t.Context(), pollInterval)
+			defer cancel()
+
+			_, err := rcv.WaitFor(ctx, "sync")
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+
+		t.Run("when payload is not json", func(t *testing.T) {
+			require.Error(t, Request{Body: []byte("x")}.Decode(&map[string]any{}))
+		})
+
+		t.Run("when cant listen", func(t *testing.T) {
+			expErr := errors.New(uuid.NewString())
+			_, err := New(WithListenerConstructor(func(string, string) (net.Listener, error) {
+				return nil, expErr
+			}))
+			require.ErrorIs(t, err, expErr)
+		})
+	})
+}
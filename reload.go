@@ -0,0 +1,189 @@
+package grokratos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+)
+
+var (
+	ErrReloadUnsupported = errors.New("kratos container does not support config reload")
+	ErrConfigRejected    = errors.New("kratos rejected the changed config")
+	ErrProbeFailed       = errors.New("config change was not observed by probe")
+)
+
+const (
+	reloadTimeout = 30 * time.Second
+	reloadPoll    = 200 * time.Millisecond
+)
+
+type (
+	// Probe reports whether Kratos behaves according to the changed config,
+	// e.g. by creating a registration flow that must now fail.
+	Probe func(ctx context.Context) error
+
+	configReloader interface {
+		WriteConfig(ctx context.Context, raw []byte) error
+		ConfigReloads(ctx context.Context, since time.Time) (tckratos.ConfigReloads, error)
+	}
+
+	runtimeConfig struct {
+		mu      sync.Mutex
+		current *kratosconf.Config
+		timeout time.Duration
+		// logMark is the time of the last Kratos log line already looked at.
+		logMark time.Time
+		// logLevel is LOG_LEVEL set through WithEnv, empty for the default.
+		logLevel string
+	}
+)
+
+// Reconfigure patches kratos.yaml of the running container, waits until
+// Kratos applied it and reverts the change in t.Cleanup. Tests changing the
+// config must not run in parallel with tests depending on it.
+func (k *Kratos) Reconfigure(t testing.TB, patches ...kratosconf.Patch) error {
+	t.Helper()
+
+	return k.ReconfigureUntil(t, nil, patches...)
+}
+
+// ReconfigureUntil is Reconfigure additionally polling probe until it passes.
+func (k *Kratos) ReconfigureUntil(t testing.TB, probe Probe, patches ...kratosconf.Patch) error {
+	t.Helper()
+
+	reloader, ok := k.Container.(configReloader)
+	if !ok || k.config == nil {
+		return ErrReloadUnsupported
+	}
+
+	if !tckratos.LogsReloads(k.config.logLevel) {
+		return fmt.Errorf("%w: LOG_LEVEL %s hides applied config changes", ErrReloadUnsupported, k.config.logLevel)
+	}
+
+	k.config.mu.Lock()
+	defer k.config.mu.Unlock()
+
+	prev := k.config.current
+
+	next, err := prev.Clone()
+	if err != nil {
+		return err
+	}
+
+	if err := next.Apply(patches...); err != nil {
+		return fmt.Errorf("failed to patch kratos config: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.config.timeout)
+	defer cancel()
+
+	if err := k.config.reload(ctx, reloader, prev, next); err != nil {
+		return err
+	}
+
+	k.config.current = next
+
+	t.Cleanup(func() {
+		k.config.mu.Lock()
+		defer k.config.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), k.config.timeout)
+		defer cancel()
+
+		if err := k.config.reload(ctx, reloader, k.config.current, prev); err != nil {
+			t.Errorf("failed to revert kratos config: %v", err)
+
+			return
+		}
+
+		k.config.current = prev
+	})
+
+	if probe == nil {
+		return nil
+	}
+
+	return poll(ctx, func() (bool, error) {
+		return probe(ctx) == nil, nil
+	}, ErrProbeFailed)
+}
+
+func (rc *runtimeConfig) reload(ctx context.Context, reloader configReloader, from, to *kratosconf.Config) error {
+	before, err := from.Bytes()
+	if err != nil {
+		return err
+	}
+
+	raw, err := to.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(before, raw) {
+		return nil
+	}
+
+	return rc.apply(ctx, reloader, raw)
+}
+
+func (rc *runtimeConfig) apply(ctx context.Context, reloader configReloader, raw []byte) error {
+	// skip what Kratos logged so far, only reloads after the write count
+	seen, err := reloader.ConfigReloads(ctx, rc.logMark)
+	if err != nil {
+		return err
+	}
+
+	rc.logMark = seen.Until
+
+	if err := reloader.WriteConfig(ctx, raw); err != nil {
+		return err
+	}
+
+	var applied, rejected int
+
+	return poll(ctx, func() (bool, error) {
+		got, err := reloader.ConfigReloads(ctx, rc.logMark)
+		if err != nil {
+			return false, err
+		}
+
+		rc.logMark = got.Until
+		applied += got.Applied
+		rejected += got.Rejected
+
+		if rejected > 0 {
+			return false, ErrConfigRejected
+		}
+
+		return applied > 0, nil
+	}, context.DeadlineExceeded)
+}
+
+func poll(ctx context.Context, done func() (bool, error), timeoutErr error) error {
+	ticker := time.NewTicker(reloadPoll)
+	defer ticker.Stop()
+
+	for {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("kratos config reload: %w", timeoutErr)
+		case <-ticker.C:
+		}
+	}
+}
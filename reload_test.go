@@ -0,0 +1,173 @@
+package grokratos
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+)
+
+// reloadingContainer imitates Kratos picking up a copied kratos.yaml.
+type reloadingContainer struct {
+	stubContainer
+
+	mu      sync.Mutex
+	written []string
+	// reloads holds whether each logged reload was rejected, logged a second apart.
+	reloads []bool
+}
+
+func (r *reloadingContainer) WriteConfig(_ context.Context, raw []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.written = append(r.written, string(raw))
+
+	r.reloads = append(r.reloads, strings.Contains(string(raw), "invalid"))
+
+	return nil
+}
+
+func (r *reloadingContainer) ConfigReloads(_ context.Context, since time.Time) (tckratos.ConfigReloads, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := tckratos.ConfigReloads{Until: since}
+
+	for i, rejected := range r.reloads {
+		at := time.Unix(int64(i+1), 0)
+		if !at.After(since) {
+			continue
+		}
+
+		res.Until = at
+
+		if rejected {
+			res.Rejected++
+		} else {
+			res.Applied++
+		}
+	}
+
+	return res, nil
+}
+
+func newReloadable(t *testing.T, container KratosContainer) *Kratos {
+	t.Helper()
+
+	base := kratosconf.New()
+	require.NoError(t, base.Set("session.lifespan", "1h"))
+
+	return &Kratos{
+		Container: container,
+		config:    &runtimeConfig{current: base, timeout: time.Second},
+	}
+}
+
+func lifespan(value string) kratosconf.Patch {
+	return func(cfg *kratosconf.Config) error {
+		return cfg.Set("session.lifespan", value)
+	}
+}
+
+func TestKratos_Reconfigure(t *testing.T) {
+	t.Run("should be able to apply and revert config", func(t *testing.T) {
+		container := &reloadingContainer{}
+		kratos := newReloadable(t, container)
+
+		t.Run("with patched lifespan", func(t *testing.T) {
+			require.NoError(t, kratos.Reconfigure(t, lifespan("1s")))
+
+			val, _ := kratos.config.current.Get("session.lifespan")
+			assert.Equal(t, "1s", val)
+			require.Len(t, container.written, 1)
+			assert.Contains(t, container.written[0], "lifespan: 1s")
+		})
+
+		val, _ := kratos.config.current.Get("session.lifespan")
+		assert.Equal(t, "1h", val)
+		require.Len(t, container.written, 2)
+		assert.Contains(t, container.written[1], "lifespan: 1h")
+	})
+
+	t.Run("should be able to skip unchanged config", func(t *testing.T) {
+		container := &reloadingContainer{}
+		kratos := newReloadable(t, container)
+
+		require.NoError(t, kratos.Reconfigure(t, lifespan("1h")))
+		assert.Empty(t, container.written)
+	})
+
+	t.Run("should be able to ignore earlier rejections", func(t *testing.T) {
+		container := &reloadingContainer{reloads: []bool{true}}
+		kratos := newReloadable(t, container)
+
+		require.NoError(t, kratos.Reconfigure(t, lifespan("1s")))
+		assert.Equal(t, time.Unix(2, 0), kratos.config.logMark)
+	})
+
+	t.Run("should be able to wait for probe", func(t *testing.T) {
+		kratos := newReloadable(t, &reloadingContainer{})
+
+		calls := 0
+		err := kratos.ReconfigureUntil(t, func(context.Context) error {
+			calls++
+			if calls < 2 {
+				return errors.New("not yet")
+			}
+
+			return nil
+		}, lifespan("1s"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("should be able to be failed", func(t *testing.T) {
+		t.Run("when container cant reload", func(t *testing.T) {
+			kratos := newReloadable(t, stubContainer{})
+			require.ErrorIs(t, kratos.Reconfigure(t, lifespan("1s")), ErrReloadUnsupported)
+		})
+
+		t.Run("when log level hides reloads", func(t *testing.T) {
+			container := &reloadingContainer{}
+			kratos := newReloadable(t, container)
+			kratos.config.logLevel = "error"
+
+			require.ErrorIs(t, kratos.Reconfigure(t, lifespan("1s")), ErrReloadUnsupported)
+			assert.Empty(t, container.written)
+		})
+
+		t.Run("when kratos rejects config", func(t *testing.T) {
+			kratos := newReloadable(t, &reloadingContainer{})
+			require.ErrorIs(t, kratos.Reconfigure(t, lifespan("invalid")), ErrConfigRejected)
+
+			val, _ := kratos.config.current.Get("session.lifespan")
+			assert.Equal(t, "1h", val)
+		})
+
+		t.Run("when probe never passes", func(t *testing.T) {
+			kratos := newReloadable(t, &reloadingContainer{})
+			kratos.config.timeout = 300 * time.Millisecond
+
+			err := kratos.ReconfigureUntil(t, func(context.Context) error {
+				return errors.New("never")
+			}, lifespan("1s"))
+			require.ErrorIs(t, err, ErrProbeFailed)
+		})
+
+		t.Run("when patch fails", func(t *testing.T) {
+			kratos := newReloadable(t, &reloadingContainer{})
+			require.Error(t, kratos.Reconfigure(t, func(*kratosconf.Config) error {
+				return errors.New("boom")
+			}))
+		})
+	})
+}
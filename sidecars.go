@@ -0,0 +1,179 @@
+package grokratos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/testcontainers/testcontainers-go"
+
+	"github.com/godepo/grokratos/pkg/courier"
+	"github.com/godepo/grokratos/pkg/hydra"
+	"github.com/godepo/grokratos/pkg/kratosconf"
+	"github.com/godepo/grokratos/pkg/mockoidc"
+	tckratos "github.com/godepo/grokratos/pkg/tc-kratos"
+	"github.com/godepo/grokratos/pkg/webhook"
+)
+
+// sidecars are in-process servers Kratos talks to; they live as long as the container.
+type sidecars struct {
+	options  []tckratos.Option
+	patches  []kratosconf.Patch
+	closers  []io.Closer
+	oidc     map[string]*mockoidc.Provider
+	outbox   *courier.Outbox
+	webhooks *webhook.Receiver
+	hydra    *hydra.Provider
+}
+
+func startSidecars(ctx context.Context, cfg config) (*sidecars, error) {
+	side := &sidecars{oidc: map[string]*mockoidc.Provider{}}
+
+	for _, op := range cfg.oidcProviders {
+		var mapper []byte
+
+		if op.mapperPath != "" {
+			raw, err := os.ReadFile(op.mapperPath)
+			if err != nil {
+				side.Close()
+
+				return nil, fmt.Errorf("failed to read oidc mapper: %w", err)
+			}
+
+			mapper = raw
+		}
+
+		prov, err := mockoidc.New(op.id, mockoidc.WithUsers(op.users...))
+		if err != nil {
+			side.Close()
+
+			return nil, fmt.Errorf("oidc provider %s failed to run: %w", op.id, err)
+		}
+
+		side.oidc[op.id] = prov
+		side.closers = append(side.closers, prov)
+		side.options = append(side.options, tckratos.WithHostAccessPorts(prov.Port()))
+		side.patches = append(side.patches, prov.Patch(mapper))
+	}
+
+	if cfg.phoneSchema {
+		side.patches = append(side.patches, courier.PhoneSchemaPatch())
+	}
+
+	if cfg.smsCourier || cfg.emailCourier {
+		box, err := courier.New()
+		if err != nil {
+			side.Close()
+
+			return nil, fmt.Errorf("courier outbox failed to run: %w", err)
+		}
+
+		side.outbox = box
+		side.closers = append(side.closers, box)
+		side.options = append(side.options, tckratos.WithHostAccessPorts(box.Port()), tckratos.WithWatchCourier())
+
+		if cfg.smsCourier {
+			side.patches = append(side.patches, box.SMSPatch())
+		}
+
+		if cfg.emailCourier {
+			side.patches = append(side.patches, box.EmailPatch())
+		}
+	}
+
+	if len(cfg.webhooks) > 0 {
+		rcv, err := webhook.New()
+		if err != nil {
+			side.Close()
+
+			return nil, fmt.Errorf("webhook receiver failed to run: %w", err)
+		}
+
+		side.webhooks = rcv
+		side.closers = append(side.closers, rcv)
+		side.options = append(side.options, tckratos.WithHostAccessPorts(rcv.Port()))
+		side.patches = append(side.patches, rcv.Patch(cfg.webhooks...))
+	}
+
+	if cfg.hydra {
+		if err := side.startHydra(ctx, cfg); err != nil {
+			side.Close()
+
+			return nil, err
+		}
+	}
+
+	side.patches = append(side.patches, cfg.configPatches...)
+
+	return side, nil
+}
+
+// viaHost returns the url of a host bound addr as seen from containers with the
+// returned port in their host access ports.
+func viaHost(addr string) (string, int, error) {
+	_, raw, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to split %s: %w", addr, err)
+	}
+
+	port, err := strconv.Atoi(raw)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse port of %s: %w", addr, err)
+	}
+
+	return apiScheme + "://" + net.JoinHostPort(testcontainers.HostInternal, raw), port, nil
+}
+
+func (s *sidecars) Close() {
+	for _, closer := range s.closers {
+		_ = closer.Close()
+	}
+}
+
+func (s *sidecars) Terminate(
+	terminate func(context.Context, ...testcontainers.TerminateOption) error,
+) func(context.Context, ...testcontainers.TerminateOption) error {
+	return func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+		defer s.Close()
+
+		return terminate(ctx, opts...)
+	}
+}
+
+// renderConfig applies patches on top of the user config and returns the path
+// of the rendered copy; without patches the original path is used as is.
+func renderConfig(path string, patches []kratosconf.Patch) (string, func(), error) {
+	if len(patches) == 0 || path == "" {
+		return path, func() {}, nil
+	}
+
+	doc, err := kratosconf.Load(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := doc.Apply(patches...); err != nil {
+		return "", nil, fmt.Errorf("failed to patch kratos config: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "grokratos-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+
+	rendered, err := doc.WriteTemp(dir)
+	if err != nil {
+		cleanup()
+
+		return "", nil, err
+	}
+
+	return rendered, cleanup, nil
+}
@@ -0,0 +1,99 @@
+package grokratos
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/kratosconf"
+)
+
+func TestRenderConfig(t *testing.T) {
+	t.Run("should be able to keep path without patches", func(t *testing.T) {
+		path, cleanup, err := renderConfig("pkg/tc-kratos/etc/kratos.yaml", nil)
+		require.NoError(t, err)
+		cleanup()
+		assert.Equal(t, "pkg/tc-kratos/etc/kratos.yaml", path)
+	})
+
+	t.Run("should be able to render patched copy", func(t *testing.T) {
+		path, cleanup, err := renderConfig("pkg/tc-kratos/etc/kratos.yaml", []kratosconf.Patch{
+			func(cfg *kratosconf.Config) error {
+				return cfg.Set("session.lifespan", "1m")
+			},
+		})
+		require.NoError(t, err)
+
+		rendered, err := kratosconf.Load(path)
+		require.NoError(t, err)
+
+		val, _ := rendered.Get("session.lifespan")
+		assert.Equal(t, "1m", val)
+
+		cleanup()
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("should be able to be failed when patch fails", func(t *testing.T) {
+		exp := errors.New("unexpected error")
+		_, _, err := renderConfig("pkg/tc-kratos/etc/kratos.yaml", []kratosconf.Patch{
+			func(*kratosconf.Config) error {
+				return exp
+			},
+		})
+		require.ErrorIs(t, err, exp)
+	})
+}
+
+func TestStartSidecars(t *testing.T) {
+	t.Run("should be able to pass config patches", func(t *testing.T) {
+		cfg := config{}
+		WithLifespans(time.Minute, time.Second)(&cfg)
+
+		side, err := startSidecars(t.Context(), cfg)
+		require.NoError(t, err)
+		t.Cleanup(side.Close)
+
+		path, cleanup, err := renderConfig("pkg/tc-kratos/etc/kratos.yaml", side.patches)
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+
+		rendered, err := kratosconf.Load(path)
+		require.NoError(t, err)
+
+		val, _ := rendered.Get("session.lifespan")
+		assert.Equal(t, "1m0s", val)
+
+		val, _ = rendered.Get("selfservice.flows.login.lifespan")
+		assert.Equal(t, "1s", val)
+	})
+
+	t.Run("should be able to route emails into outbox", func(t *testing.T) {
+		cfg := config{}
+		WithRecovery("code")(&cfg)
+
+		side, err := startSidecars(t.Context(), cfg)
+		require.NoError(t, err)
+		t.Cleanup(side.Close)
+		require.NotNil(t, side.outbox)
+
+		path, cleanup, err := renderConfig("pkg/tc-kratos/etc/kratos.yaml", side.patches)
+		require.NoError(t, err)
+		t.Cleanup(cleanup)
+
+		rendered, err := kratosconf.Load(path)
+		require.NoError(t, err)
+
+		val, _ := rendered.Get("courier.http.request_config.url")
+		assert.Equal(t, side.outbox.URL()+"/email", val)
+
+		val, _ = rendered.Get("selfservice.flows.recovery.use")
+		assert.Equal(t, "code", val)
+
+		_, ok := rendered.Get("courier.channels")
+		assert.False(t, ok)
+	})
+}
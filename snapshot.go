@@ -0,0 +1,41 @@
+package grokratos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/godepo/groat/pkg/ctxgroup"
+
+	"github.com/godepo/grokratos/internal/containersync"
+	"github.com/godepo/grokratos/pkg/snapshot"
+	"github.com/godepo/grokratos/pkg/sqldump"
+)
+
+type dumpableContainer interface {
+	Dumper(ctx context.Context, opts ...sqldump.Option) (*sqldump.Dumper, error)
+}
+
+// snapshotOptions dumps the database named by the Kratos DSN, leaving the
+// memory one to the admin API.
+func snapshotOptions(ctx context.Context, kratosContainer KratosContainer) ([]snapshot.Option, error) {
+	dc, ok := kratosContainer.(dumpableContainer)
+	if !ok {
+		return nil, nil
+	}
+
+	dumper, err := dc.Dumper(ctx)
+	if errors.Is(err, sqldump.ErrNoDatabase) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("kratos snapshot: %w", err)
+	}
+
+	ctxgroup.IncAt(ctx)
+
+	go containersync.Terminator(ctx, dumper.Terminate)()
+
+	return []snapshot.Option{snapshot.WithDumper(dumper)}, nil
+}
@@ -0,0 +1,46 @@
+package grokratos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/godepo/grokratos/pkg/sqldump"
+)
+
+type dumpableStub struct {
+	stubContainer
+	dsn string
+}
+
+func (d dumpableStub) Dumper(ctx context.Context, opts ...sqldump.Option) (*sqldump.Dumper, error) {
+	return sqldump.New(ctx, d.dsn, nil, opts...)
+}
+
+func TestSnapshotOptions(t *testing.T) {
+	t.Run("should be able to dump sql database", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		opts, err := snapshotOptions(ctx, dumpableStub{dsn: "sqlite:///var/lib/sqlite/db.sqlite"})
+		require.NoError(t, err)
+		assert.Len(t, opts, 1)
+	})
+
+	t.Run("should be able to fall back to admin api", func(t *testing.T) {
+		opts, err := snapshotOptions(t.Context(), dumpableStub{dsn: "memory"})
+		require.NoError(t, err)
+		assert.Empty(t, opts)
+
+		opts, err = snapshotOptions(t.Context(), stubContainer{})
+		require.NoError(t, err)
+		assert.Empty(t, opts)
+	})
+
+	t.Run("should be able to be failed when dsn has no dump", func(t *testing.T) {
+		_, err := snapshotOptions(t.Context(), dumpableStub{dsn: "cockroach://root@db:26257/kratos"})
+		require.ErrorIs(t, err, sqldump.ErrUnsupportedDSN)
+	})
+}